@@ -3,107 +3,486 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 )
 
 // Server contains handlers for all supportend endpoints, registers handlers and starts server.
 type Server struct {
 	// Supplied service is used to perform the appropriate operation for each endpoint.
 	svc Service
+	// Middlewares are applied to every request, the first one is the outermost.
+	middlewares []Middleware
+	// Webhooks store is used by webhook endpoints, which are served only if it is provided.
+	webhooks WebhookStore
+	// Event stream is used by the movie change feed, which is served only if it is provided.
+	stream *eventStream
+	// WebSocket is used by the topic subscription endpoint, which is served only if it is provided.
+	ws *movieWebSocket
+	// GraphQL serves GraphQL endpoint, which is served only if it is provided.
+	graphql *GraphQL
+	// Version options configure headers of the deprecated unversioned endpoints.
+	version VersionOptions
+	// Codecs encode and decode bodies of the movie and webhook endpoints.
+	codecs *CodecRegistry
+	// Compression options enable compression of the responses and gzip request bodies,
+	// if they are provided.
+	compression *CompressionOptions
 }
 
 // NewServer creates an instance of the Server.
-func NewServer(svc Service) Server {
+func NewServer(svc Service, middlewares ...Middleware) Server {
 	return Server{
-		svc: svc,
+		svc:         svc,
+		middlewares: middlewares,
+		codecs:      DefaultCodecs(),
 	}
 }
 
-// Start registers all handlers and starts the server using the provided address.
-func (s Server) Start(addr string) error {
-	http.HandleFunc("GET /movies/{id}", s.handleGetMovie)
-	http.HandleFunc("GET /movies", s.handleGetAllMovies)
-	http.HandleFunc("POST /movies", s.handleCreateMovie)
-	http.HandleFunc("PUT /movies/{id}", s.handleUpdateMovie)
-	http.HandleFunc("DELETE /movies/{id}", s.handleDeleteMovie)
-	return http.ListenAndServe(addr, nil)
+// WithCodecs returns a copy of the Server, that negotiates encoding of the bodies
+// of the movie and webhook endpoints using provided registry.
+func (s Server) WithCodecs(codecs *CodecRegistry) Server {
+	s.codecs = codecs
+	return s
+}
+
+// WithCompression returns a copy of the Server, that compresses responses negotiated by
+// Accept-Encoding header and accepts gzip bodies of the movie writes.
+func (s Server) WithCompression(opts CompressionOptions) Server {
+	s.compression = &opts
+	return s
+}
+
+// WithWebhooks returns a copy of the Server, that serves webhook endpoints using provided store.
+func (s Server) WithWebhooks(store WebhookStore) Server {
+	s.webhooks = store
+	return s
+}
+
+// WithEventStream returns a copy of the Server, that streams movie change events published
+// to the broker, resuming clients from the log.
+func (s Server) WithEventStream(broker *EventBroker, log EventLog, opts StreamOptions) Server {
+	s.stream = &eventStream{
+		broker: broker,
+		log:    log,
+		opts:   opts,
+	}
+	return s
+}
+
+// WithWebSocket returns a copy of the Server, that sends movie change events routed
+// by the router to WebSocket clients.
+func (s Server) WithWebSocket(router *TopicRouter, opts WebSocketOptions) Server {
+	s.ws = &movieWebSocket{
+		router: router,
+		opts:   opts,
+	}
+	return s
+}
+
+// WithVersionOptions returns a copy of the Server, that announces deprecation of the
+// unversioned endpoints with provided dates.
+func (s Server) WithVersionOptions(opts VersionOptions) Server {
+	s.version = opts
+	return s
+}
+
+// WithGraphQL returns a copy of the Server, that serves GraphQL queries using provided handler.
+func (s Server) WithGraphQL(g *GraphQL) Server {
+	s.graphql = g
+	return s
+}
+
+// route describes a single endpoint, served by the Server.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+// pattern returns http.ServeMux pattern of the route, e.g. "GET /movies/{id}".
+func (r route) pattern() string {
+	return r.method + " " + r.path
+}
+
+// routes returns all endpoints supported by the Server: API endpoints under the version
+// prefix, their deprecated unversioned aliases and the documentation.
+func (s Server) routes() []route {
+	api := s.apiRoutes()
+	routes := []route{}
+	for _, r := range api {
+		routes = append(routes, route{r.method, apiVersionPrefix + r.path, s.versioned(r.handler)})
+	}
+	for _, r := range api {
+		routes = append(routes, route{r.method, r.path, s.unversioned(r.handler)})
+	}
+	return append(routes, s.docsRoutes()...)
+}
+
+// docsRoutes returns endpoints of the API documentation, which are not versioned.
+func (s Server) docsRoutes() []route {
+	return []route{
+		{http.MethodGet, "/openapi.json", s.handleOpenAPI},
+		{http.MethodGet, "/docs", s.handleDocs},
+	}
+}
+
+// apiRoutes returns API endpoints of the current version without the version prefix.
+func (s Server) apiRoutes() []route {
+	routes := []route{
+		{http.MethodGet, "/movies/{id}", s.negotiated(s.handleGetMovie)},
+		{http.MethodGet, "/movies", s.negotiated(s.handleGetAllMovies)},
+		{http.MethodPost, "/movies", s.negotiated(s.decompressed(s.handleCreateMovie))},
+		{http.MethodPut, "/movies/{id}", s.negotiated(s.decompressed(s.handleUpdateMovie))},
+		{http.MethodDelete, "/movies/{id}", s.negotiated(s.handleDeleteMovie)},
+	}
+	if s.stream != nil {
+		routes = append(routes, route{http.MethodGet, "/movies/stream", s.handleMovieStream})
+	}
+	if s.ws != nil {
+		routes = append(routes, route{http.MethodGet, "/movies/ws", s.handleMovieWebSocket})
+	}
+	if s.graphql != nil {
+		routes = append(
+			routes,
+			route{http.MethodGet, "/graphql", s.graphql.ServeHTTP},
+			route{http.MethodPost, "/graphql", s.graphql.ServeHTTP},
+		)
+	}
+	if s.webhooks != nil {
+		routes = append(
+			routes,
+			route{http.MethodPost, "/webhooks", s.negotiated(s.handleCreateWebhook)},
+			route{http.MethodGet, "/webhooks", s.negotiated(s.handleGetWebhooks)},
+			route{http.MethodDelete, "/webhooks/{id}", s.negotiated(s.handleDeleteWebhook)},
+			route{http.MethodGet, "/webhooks/{id}/deliveries", s.negotiated(s.handleGetWebhookDeliveries)},
+		)
+	}
+	return routes
+}
+
+// Handler registers all handlers and wraps them with the middleware stack.
+// Compression, if enabled, is the innermost middleware.
+func (s Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, r := range s.routes() {
+		mux.HandleFunc(r.pattern(), r.handler)
+	}
+	middlewares := s.middlewares
+	if s.compression != nil {
+		middlewares = append(slices.Clip(middlewares), Compress(*s.compression))
+	}
+	return Chain(mux, middlewares...)
+}
+
+// Start registers all handlers and starts the server using the provided address and timeouts.
+// When ctx is done, the server stops accepting connections and waits for active requests
+// up to the shutdown timeout, after which the remaining connections are closed.
+func (s Server) Start(ctx context.Context, cfg HTTPConfig) error {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           s.Handler(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+		return fmt.Errorf("error shutting down server: %w", err)
+	}
+	return nil
 }
 
 // handleGetMovie call Service to get movie with provided by path value id.
-// If successful, the fetched movie is written to the response body.
+// If successful, the fetched movie is written to the response body. If fields query
+// parameter is provided, only the listed fields are fetched and written.
 func (s Server) handleGetMovie(w http.ResponseWriter, r *http.Request) {
-	movie, err := s.svc.GetMovie(context.Background(), r.PathValue("id"))
+	fields, err := parseMovieFields(r.URL.Query().Get("fields"))
 	if err != nil {
-		writeJson(w, http.StatusUnprocessableEntity, map[string]any{"error": err.Error()})
+		writeBody(w, r, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	movie, err := s.svc.GetMovie(WithMovieFields(r.Context(), fields), r.PathValue("id"))
+	if err != nil {
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
+		return
+	}
+	if fields != nil {
+		writeBody(w, r, http.StatusOK, NewPartialMovie(*movie, fields))
 		return
 	}
-	writeJson(w, http.StatusOK, movie)
+	writeBody(w, r, http.StatusOK, movie)
 }
 
 // handleGetAllMovies calls Service to get all the movies that are currently stored.
-// If successful, the fetched movies are written to the response body.
-func (s Server) handleGetAllMovies(w http.ResponseWriter, _ *http.Request) {
-	movies, err := s.svc.GetAllMovies(context.Background())
+// If successful, the fetched movies are written to the response body. If limit or offset
+// query parameter is provided, only the requested page is written, and the number of all
+// movies is written to the X-Total-Count header. If fields query parameter is provided,
+// only the listed fields are fetched and written.
+func (s Server) handleGetAllMovies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	paged := query.Has("limit") || query.Has("offset")
+	limit, offset := 0, 0
+	if paged {
+		var err error
+		limit, offset, err = parsePage(query.Get("limit"), query.Get("offset"))
+		if err != nil {
+			writeBody(w, r, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+	}
+	fields, err := parseMovieFields(query.Get("fields"))
+	if err != nil {
+		writeBody(w, r, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	ctx := WithMovieFields(r.Context(), fields)
+	var movies []Movie
+	if paged {
+		var total int
+		movies, total, err = s.svc.ListMovies(ctx, MovieQuery{Limit: limit, Offset: offset})
+		if err == nil {
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		}
+	} else {
+		movies, err = s.svc.GetAllMovies(ctx)
+	}
 	if err != nil {
-		writeJson(w, http.StatusUnprocessableEntity, map[string]any{"error": err.Error()})
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
 		return
 	}
-	writeJson(w, http.StatusOK, movies)
+	if fields != nil {
+		partial := make([]PartialMovie, 0, len(movies))
+		for _, m := range movies {
+			partial = append(partial, NewPartialMovie(m, fields))
+		}
+		writeBody(w, r, http.StatusOK, partial)
+		return
+	}
+	writeBody(w, r, http.StatusOK, movies)
+}
+
+// parsePage parses limit and offset query parameters, limit is 100 by default.
+func parsePage(limitParam, offsetParam string) (int, int, error) {
+	limit, offset := 100, 0
+	if limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n <= 0 || n > 1000 {
+			return 0, 0, errors.New("limit must be between 1 and 1000")
+		}
+		limit = n
+	}
+	if offsetParam != "" {
+		n, err := strconv.Atoi(offsetParam)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+		offset = n
+	}
+	return limit, offset, nil
 }
 
 // handleCreateMovie calls Service to create a new movie, using the data provided.
 // in the request body. If successful, id of the created movie is written to the response body.
 func (s Server) handleCreateMovie(w http.ResponseWriter, r *http.Request) {
 	movie := &Movie{}
-	err := json.NewDecoder(r.Body).Decode(movie)
+	err := readBody(r, movie)
 	if err != nil {
-		writeJson(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		writeBody(w, r, readBodyStatus(err), map[string]any{"error": err.Error()})
 		return
 	}
 
-	id, err := s.svc.CreateMovie(context.Background(), movie)
+	id, err := s.svc.CreateMovie(r.Context(), movie)
 	if err != nil {
-		writeJson(w, http.StatusUnprocessableEntity, map[string]any{"error": err.Error()})
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
 		return
 	}
-	writeJson(w, http.StatusCreated, map[string]any{"id": id})
+	writeBody(w, r, http.StatusCreated, map[string]any{"id": id})
 }
 
 // handleUpdateMovie calls Service to update a movie, using the data provided in the body.
 // and id provided in the request path value. If successful, nothing will be returned.
 func (s Server) handleUpdateMovie(w http.ResponseWriter, r *http.Request) {
 	movie := &Movie{}
-	err := json.NewDecoder(r.Body).Decode(movie)
+	err := readBody(r, movie)
 	if err != nil {
-		writeJson(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		writeBody(w, r, readBodyStatus(err), map[string]any{"error": err.Error()})
 		return
 	}
 
-	err = s.svc.UpdateMovie(context.Background(), r.PathValue("id"), movie)
+	err = s.svc.UpdateMovie(r.Context(), r.PathValue("id"), movie)
 	if err != nil {
-		writeJson(w, http.StatusUnprocessableEntity, map[string]any{"error": err.Error()})
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
 		return
 	}
-	writeJson(w, http.StatusNoContent, map[string]any{})
+	writeBody(w, r, http.StatusNoContent, map[string]any{})
 }
 
 // handleDeleteMovie calls Service to delete a movie, using id provided in the request path value.
 // If successful, nothing will be returned.
 func (s Server) handleDeleteMovie(w http.ResponseWriter, r *http.Request) {
-	err := s.svc.DeleteMovie(context.Background(), r.PathValue("id"))
+	err := s.svc.DeleteMovie(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
+		return
+	}
+	writeBody(w, r, http.StatusNoContent, map[string]any{})
+}
+
+// handleCreateWebhook registers subscription, using the data provided in the request body.
+// Secret is generated, if it is not provided. If successful, the subscription with its secret
+// is written to the response body, secret is never returned again.
+func (s Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	sub := &WebhookSubscription{}
+	err := readBody(r, sub)
+	if err != nil {
+		writeBody(w, r, readBodyStatus(err), map[string]any{"error": err.Error()})
+		return
+	}
+	err = sub.Validate()
+	if err != nil {
+		writeBody(w, r, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if sub.Secret == "" {
+		sub.Secret, err = newWebhookSecret()
+		if err != nil {
+			writeBody(w, r, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+			return
+		}
+	}
+
+	err = s.webhooks.CreateSubscription(r.Context(), sub)
+	if err != nil {
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
+		return
+	}
+	writeBody(w, r, http.StatusCreated, sub)
+}
+
+// handleGetWebhooks writes all subscriptions without their secrets to the response body.
+func (s Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.webhooks.Subscriptions(r.Context())
+	if err != nil {
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	writeBody(w, r, http.StatusOK, subs)
+}
+
+// handleDeleteWebhook deletes subscription with id provided in the request path value,
+// pending deliveries of the subscription are dropped.
+func (s Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := s.webhooks.DeleteSubscription(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		writeBody(w, r, http.StatusNotFound, map[string]any{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
+		return
+	}
+	writeBody(w, r, http.StatusNoContent, map[string]any{})
+}
+
+// handleGetWebhookDeliveries writes the latest deliveries of the subscription with id
+// provided in the request path value. Number of deliveries is limited by the limit query
+// parameter, 50 by default.
+func (s Server) handleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			writeBody(w, r, http.StatusBadRequest, map[string]any{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := s.webhooks.Deliveries(r.Context(), r.PathValue("id"), limit)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		writeBody(w, r, http.StatusNotFound, map[string]any{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		writeJson(w, http.StatusUnprocessableEntity, map[string]any{"error": err.Error()})
+		writeBody(w, r, http.StatusUnprocessableEntity, errorBody(err))
 		return
 	}
-	writeJson(w, http.StatusNoContent, map[string]any{})
+	writeBody(w, r, http.StatusOK, deliveries)
+}
+
+// errorCodes are machine-readable codes of the errors, which clients may handle,
+// so they do not depend on the error messages.
+var errorCodes = map[error]string{
+	ErrMovieNotFound:        "movie_not_found",
+	ErrNothingToUpdate:      "nothing_to_update",
+	ErrSubscriptionNotFound: "subscription_not_found",
+}
+
+// errorBody returns response body with the error message and its code, if it has one.
+func errorBody(err error) map[string]any {
+	body := map[string]any{"error": err.Error()}
+	for target, code := range errorCodes {
+		if errors.Is(err, target) {
+			body["code"] = code
+			break
+		}
+	}
+	return body
 }
 
 // writeJson is responsible for writing status code and response body.
 func writeJson(w http.ResponseWriter, s int, v any) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(s)
-	w.Header().Add("Content-Type", "application/json")
 	err := json.NewEncoder(w).Encode(v)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// problem is an RFC 9457 problem details response body.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// writeProblem is responsible for writing problem details response with provided status code.
+func writeProblem(w http.ResponseWriter, r *http.Request, s int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(s)
+	err := json.NewEncoder(w).Encode(problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(s),
+		Status:   s,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/pashagolub/pgxmock/v3"
 )
@@ -82,10 +84,11 @@ func TestHandleCreateMovie(t *testing.T) {
 	r := httptest.NewRequest(http.MethodPost, "/movies", &buf)
 	s := NewServer(NewMovieService(NewMovieDatabase(mock)))
 
-	rows := mock.NewRows([]string{"id"}).AddRow(id)
+	rows := mock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...)
 	value := testMovieRow(id)[1:]
 	mock.ExpectBegin()
 	mock.ExpectQuery("insert into").WithArgs(value...).WillReturnRows(rows)
+	expectOutboxEvent(mock, MovieCreated)
 	mock.ExpectCommit()
 	s.handleCreateMovie(w, r)
 
@@ -117,9 +120,10 @@ func TestHandleUpdateMovie(t *testing.T) {
 	s := NewServer(NewMovieService(NewMovieDatabase(mock)))
 
 	mock.ExpectBegin()
-	mock.ExpectExec("update movie").
+	mock.ExpectQuery("update movie").
 		WithArgs(movie.Name, id.String()).
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		WillReturnRows(mock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...))
+	expectOutboxEvent(mock, MovieUpdated)
 	mock.ExpectCommit()
 	s.handleUpdateMovie(w, r)
 
@@ -147,6 +151,7 @@ func TestHandleDeleteMovie(t *testing.T) {
 	mock.ExpectExec("delete from movie").
 		WithArgs(id.String()).
 		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	expectOutboxEvent(mock, MovieDeleted)
 	mock.ExpectCommit()
 	s.handleDeleteMovie(w, r)
 
@@ -180,3 +185,24 @@ func TestWriteJson(t *testing.T) {
 		t.Errorf("wrong status value returned in response; expected: ok, got: %s", resStatus)
 	}
 }
+
+func TestServerStartShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- NewServer(NewMovieService(NewMemoryDatabase())).Start(
+			ctx,
+			HTTPConfig{Addr: "127.0.0.1:0", ShutdownTimeout: time.Second},
+		)
+	}()
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("wrong error; expected: nil, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server was not stopped")
+	}
+}
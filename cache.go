@@ -0,0 +1,463 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache is responsible for storing encoded values by key.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get fetches value by key, reporting whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value by key, replacing the previous one.
+	Set(ctx context.Context, key string, value []byte) error
+	// Delete removes values by keys, missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// CacheOptions describes the size and lifetime of the cached entries.
+type CacheOptions struct {
+	// Size is the maximum number of entries, the least recently used entry is evicted,
+	// when it is exceeded.
+	Size int
+	// TTL is the time after which entry expires, entries never expire, if it is not positive.
+	TTL time.Duration
+}
+
+// CacheStats contains counters of the cache usage.
+// Entries and Evictions describe the in-process storage of the cache, if it has one.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Errors    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// cacheStatser is implemented by caches, that know the number of the stored entries.
+type cacheStatser interface {
+	stats() (entries int, evictions uint64)
+}
+
+// CachingService implements Service interface and caches movies returned by the wrapped Service.
+// Single movies are cached by id and lists by their normalized parameters.
+// Create, Update and Delete calls invalidate affected entries, concurrent misses of the same
+// entry are coalesced into a single call of the wrapped Service.
+//
+// Lists are cached under the keys containing the list version, which is replaced on every write,
+// so all lists are invalidated at once, without searching for their keys.
+// Cache errors are not returned to the caller, the wrapped Service is used instead.
+type CachingService struct {
+	next  Service
+	cache Cache
+	group *singleflight.Group
+	// mu and gen prevent values fetched before invalidation from being cached after it.
+	mu     *sync.RWMutex
+	gen    *atomic.Uint64
+	hits   *atomic.Uint64
+	misses *atomic.Uint64
+	errors *atomic.Uint64
+}
+
+// NewCachingService creates an instance of the CachingService.
+// Unlike the other constructors it returns the struct, so its Stats can be read.
+func NewCachingService(next Service, cache Cache) CachingService {
+	return CachingService{
+		next:   next,
+		cache:  cache,
+		group:  &singleflight.Group{},
+		mu:     &sync.RWMutex{},
+		gen:    &atomic.Uint64{},
+		hits:   &atomic.Uint64{},
+		misses: &atomic.Uint64{},
+		errors: &atomic.Uint64{},
+	}
+}
+
+// Stats returns current counters of the cache usage.
+func (cs CachingService) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:   cs.hits.Load(),
+		Misses: cs.misses.Load(),
+		Errors: cs.errors.Load(),
+	}
+	if c, ok := cs.cache.(cacheStatser); ok {
+		stats.Entries, stats.Evictions = c.stats()
+	}
+	return stats
+}
+
+// LogStats logs counters of the cache usage every interval until ctx is canceled.
+func (cs CachingService) LogStats(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stats := cs.Stats()
+		logger.LogAttrs(
+			ctx,
+			slog.LevelInfo,
+			"cache stats",
+			slog.Uint64("hits", stats.Hits),
+			slog.Uint64("misses", stats.Misses),
+			slog.Uint64("errors", stats.Errors),
+			slog.Uint64("evictions", stats.Evictions),
+			slog.Int("entries", stats.Entries),
+		)
+	}
+}
+
+// GetMovie does not cache movies with only some of the fields requested, since they can not be
+// invalidated along with the whole movie.
+func (cs CachingService) GetMovie(ctx context.Context, id string) (*Movie, error) {
+	if MovieFieldsFromContext(ctx) != nil {
+		return cs.next.GetMovie(ctx, id)
+	}
+	movie := Movie{}
+	err := cs.load(ctx, movieKey(id), &movie, func(ctx context.Context) (any, error) {
+		return cs.next.GetMovie(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &movie, nil
+}
+
+func (cs CachingService) GetAllMovies(ctx context.Context) ([]Movie, error) {
+	movies := []Movie{}
+	params := []string{}
+	if fields := MovieFieldsFromContext(ctx); fields != nil {
+		params = append(params, "fields="+strings.Join(fields, ","))
+	}
+	err := cs.load(ctx, cs.listKey(ctx, params...), &movies, func(ctx context.Context) (any, error) {
+		return cs.next.GetAllMovies(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// cachedMoviePage is the cached result of ListMovies.
+type cachedMoviePage struct {
+	Movies []Movie `json:"movies"`
+	Total  int     `json:"total"`
+}
+
+func (cs CachingService) ListMovies(ctx context.Context, q MovieQuery) ([]Movie, int, error) {
+	page := cachedMoviePage{}
+	params := movieQueryParams(q)
+	if fields := MovieFieldsFromContext(ctx); fields != nil {
+		params = append(params, "fields="+strings.Join(fields, ","))
+	}
+	err := cs.load(ctx, cs.listKey(ctx, params...), &page, func(ctx context.Context) (any, error) {
+		movies, total, err := cs.next.ListMovies(ctx, q)
+		return cachedMoviePage{Movies: movies, Total: total}, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page.Movies, page.Total, nil
+}
+
+func (cs CachingService) CreateMovie(ctx context.Context, m *Movie) (string, error) {
+	defer cs.invalidate(ctx)
+	return cs.next.CreateMovie(ctx, m)
+}
+
+func (cs CachingService) UpdateMovie(ctx context.Context, id string, m *Movie) error {
+	defer cs.invalidate(ctx, movieKey(id))
+	return cs.next.UpdateMovie(ctx, id, m)
+}
+
+func (cs CachingService) DeleteMovie(ctx context.Context, id string) error {
+	defer cs.invalidate(ctx, movieKey(id))
+	return cs.next.DeleteMovie(ctx, id)
+}
+
+// invalidate removes provided keys along with the list version, so all lists are invalidated too.
+func (cs CachingService) invalidate(ctx context.Context, keys ...string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.gen.Add(1)
+	err := cs.cache.Delete(context.WithoutCancel(ctx), append(keys, listVersionKey)...)
+	if err != nil {
+		cs.errors.Add(1)
+	}
+}
+
+// load decodes cached value by key into dst, or fetches, caches and decodes it on miss.
+// Values are encoded as JSON, so decoded value never shares data with the cached one.
+// Concurrent misses share the same fetch, which is not canceled, when one of the callers is gone.
+func (cs CachingService) load(
+	ctx context.Context,
+	key string,
+	dst any,
+	fetch func(ctx context.Context) (any, error),
+) error {
+	data, ok, err := cs.cache.Get(ctx, key)
+	if err != nil {
+		cs.errors.Add(1)
+	}
+	if ok && json.Unmarshal(data, dst) == nil {
+		cs.hits.Add(1)
+		return nil
+	}
+	cs.misses.Add(1)
+
+	gen := cs.gen.Load()
+	v, err, _ := cs.group.Do(fmt.Sprintf("%s@%d", key, gen), func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		v, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		cs.store(ctx, key, data, gen)
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(v.([]byte), dst)
+}
+
+// store caches value, only if there were no invalidations since the generation gen.
+func (cs CachingService) store(ctx context.Context, key string, data []byte, gen uint64) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if cs.gen.Load() != gen {
+		return
+	}
+	if err := cs.cache.Set(ctx, key, data); err != nil {
+		cs.errors.Add(1)
+	}
+}
+
+// listKey returns cache key of the movie list with the current list version.
+// New version is generated, if there is no version in the cache.
+func (cs CachingService) listKey(ctx context.Context, params ...string) string {
+	version, ok, err := cs.cache.Get(ctx, listVersionKey)
+	if err != nil {
+		cs.errors.Add(1)
+	}
+	if !ok {
+		version = newListVersion()
+		if err := cs.cache.Set(ctx, listVersionKey, version); err != nil {
+			cs.errors.Add(1)
+		}
+	}
+	return listKey(string(version), params...)
+}
+
+const (
+	movieKeyPrefix = "movie:"
+	listKeyPrefix  = "movies:"
+	listVersionKey = "movies-version"
+)
+
+// movieKey returns cache key of the movie, ids are normalized,
+// so different spellings of the same UUID share the entry.
+func movieKey(id string) string {
+	if movieId, err := uuid.FromString(id); err == nil {
+		id = movieId.String()
+	}
+	return movieKeyPrefix + id
+}
+
+// listKey returns cache key of the movie list, parameters are sorted,
+// so the same query always has the same key.
+func listKey(version string, params ...string) string {
+	params = slices.Clone(params)
+	slices.Sort(params)
+	return listKeyPrefix + version + ":" + strings.Join(params, "&")
+}
+
+// movieQueryParams returns key parameters of the query, values are escaped,
+// so they do not clash with separators of the key.
+func movieQueryParams(q MovieQuery) []string {
+	params := []string{"limit=" + strconv.Itoa(q.Limit), "offset=" + strconv.Itoa(q.Offset)}
+	list := func(name string, values []string) {
+		if values == nil {
+			return
+		}
+		escaped := make([]string, len(values))
+		for i, v := range values {
+			escaped[i] = url.QueryEscape(v)
+		}
+		params = append(params, name+"="+strings.Join(escaped, ","))
+	}
+	list("ids", q.IDs)
+	list("directors", q.Directors)
+	f := q.Filter
+	if f.Query != "" {
+		params = append(params, "query="+url.QueryEscape(f.Query))
+	}
+	if f.Genre != "" {
+		params = append(params, "genre="+url.QueryEscape(f.Genre))
+	}
+	if f.MinReleaseYear != 0 {
+		params = append(params, "min_release_year="+strconv.Itoa(f.MinReleaseYear))
+	}
+	if f.MaxReleaseYear != 0 {
+		params = append(params, "max_release_year="+strconv.Itoa(f.MaxReleaseYear))
+	}
+	if f.MinRating != nil {
+		params = append(params, "min_rating="+f.MinRating.String())
+	}
+	if q.Sort.Field != "" {
+		params = append(params, "sort="+url.QueryEscape(q.Sort.Field), "desc="+strconv.FormatBool(q.Sort.Desc))
+	}
+	return params
+}
+
+// newListVersion generates random version of the movie lists.
+func newListVersion() []byte {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return []byte(fmt.Sprint(time.Now().UnixNano()))
+	}
+	return []byte(hex.EncodeToString(b))
+}
+
+// MemoryCache is an in-process implementation of the Cache interface,
+// entries are lost on exit and are not shared between instances of the service.
+type MemoryCache struct {
+	lru *lruCache
+}
+
+// NewMemoryCache creates an instance of the MemoryCache.
+func NewMemoryCache(opts CacheOptions) Cache {
+	return MemoryCache{
+		lru: newLRUCache(opts.Size, opts.TTL),
+	}
+}
+
+func (mc MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	v, ok := mc.lru.get(key)
+	return v, ok, nil
+}
+
+func (mc MemoryCache) Set(_ context.Context, key string, value []byte) error {
+	mc.lru.set(key, value)
+	return nil
+}
+
+func (mc MemoryCache) Delete(_ context.Context, keys ...string) error {
+	mc.lru.remove(keys...)
+	return nil
+}
+
+func (mc MemoryCache) stats() (int, uint64) {
+	return mc.lru.stats()
+}
+
+// lruCache is a concurrency-safe cache, bounded by the number of entries, with expiring entries.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	now   func() time.Time
+	items map[string]*list.Element
+	// order keeps the most recently used entries at the front.
+	order     *list.List
+	evictions uint64
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:  size,
+		ttl:   ttl,
+		now:   time.Now,
+		items: map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+func (c *lruCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *lruCache) set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 {
+		return
+	}
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = c.now().Add(c.ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value = &lruEntry{key: key, value: value, expires: expires}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		c.evictions++
+	}
+}
+
+func (c *lruCache) remove(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.removeElement(el)
+		}
+	}
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
+
+func (c *lruCache) stats() (entries int, evictions uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.evictions
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingService wraps Service and counts calls of the read methods.
+// Reads are blocked until release is closed, if it is not nil.
+type countingService struct {
+	Service
+	gets    *atomic.Int32
+	lists   *atomic.Int32
+	release chan struct{}
+}
+
+func newCountingService() countingService {
+	return countingService{
+		Service: NewMovieService(NewMemoryDatabase()),
+		gets:    &atomic.Int32{},
+		lists:   &atomic.Int32{},
+	}
+}
+
+func (cs countingService) GetMovie(ctx context.Context, id string) (*Movie, error) {
+	cs.gets.Add(1)
+	if cs.release != nil {
+		<-cs.release
+	}
+	return cs.Service.GetMovie(ctx, id)
+}
+
+func (cs countingService) GetAllMovies(ctx context.Context) ([]Movie, error) {
+	cs.lists.Add(1)
+	return cs.Service.GetAllMovies(ctx)
+}
+
+func (cs countingService) ListMovies(ctx context.Context, q MovieQuery) ([]Movie, int, error) {
+	cs.lists.Add(1)
+	return cs.Service.ListMovies(ctx, q)
+}
+
+func TestCachingServiceGetMovie(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	cs := NewCachingService(next, NewMemoryCache(CacheOptions{Size: 10}))
+	id, err := cs.CreateMovie(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error creating: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		movie, err := cs.GetMovie(ctx, id)
+		if err != nil {
+			t.Fatalf("error fetching: %v", err)
+		}
+		// Returned movie must not share data with the cached one.
+		movie.Genres[0] = "changed"
+	}
+
+	if n := next.gets.Load(); n != 1 {
+		t.Errorf("wrong number of calls; expected: 1, got: %d", n)
+	}
+	movie, _ := cs.GetMovie(ctx, id)
+	if movie.Genres[0] == "changed" {
+		t.Errorf("cached movie was modified by the caller")
+	}
+	stats := cs.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("wrong stats; expected: 3 hits, 1 miss, 1 entry, got: %+v", stats)
+	}
+}
+
+func TestCachingServiceLogStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cs := NewCachingService(newCountingService(), NewMemoryCache(CacheOptions{Size: 10}))
+	id, err := cs.CreateMovie(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error creating: %v", err)
+	}
+	if _, err := cs.GetMovie(ctx, id); err != nil {
+		t.Fatalf("error getting: %v", err)
+	}
+
+	var buf syncBuffer
+	done := make(chan struct{})
+	go func() {
+		cs.LogStats(ctx, slog.New(slog.NewTextHandler(&buf, nil)), time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	if out := buf.String(); !strings.Contains(out, "msg=\"cache stats\" hits=0 misses=1") {
+		t.Errorf("wrong logged stats; expected: hits=0 misses=1, got: %q", out)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestCachingServiceMovieFields(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	cs := NewCachingService(next, NewMemoryCache(CacheOptions{Size: 10}))
+	id, err := cs.CreateMovie(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error creating: %v", err)
+	}
+	partial := WithMovieFields(ctx, []string{"id", "name"})
+
+	for i := 0; i < 2; i++ {
+		cs.GetMovie(partial, id)
+		cs.GetAllMovies(ctx)
+		cs.GetAllMovies(partial)
+	}
+	// Partial movies are not cached by id, lists are cached separately for every set of fields.
+	if gets, lists := next.gets.Load(), next.lists.Load(); gets != 2 || lists != 2 {
+		t.Errorf("wrong number of calls; expected: 2 gets, 2 lists, got: %d gets, %d lists", gets, lists)
+	}
+}
+
+func TestCachingServiceInvalidation(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	cs := NewCachingService(next, NewMemoryCache(CacheOptions{Size: 10}))
+
+	id, _ := cs.CreateMovie(ctx, testMovie())
+	cs.GetMovie(ctx, id)
+	cs.GetAllMovies(ctx)
+
+	if _, err := cs.CreateMovie(ctx, testMovie()); err != nil {
+		t.Fatalf("error creating: %v", err)
+	}
+	movies, _ := cs.GetAllMovies(ctx)
+	if len(movies) != 2 {
+		t.Errorf("list was not invalidated on create; expected: 2 movies, got: %d", len(movies))
+	}
+
+	if err := cs.UpdateMovie(ctx, id, &Movie{Name: "updated"}); err != nil {
+		t.Fatalf("error updating: %v", err)
+	}
+	movie, _ := cs.GetMovie(ctx, id)
+	if movie.Name != "updated" {
+		t.Errorf("movie was not invalidated on update; expected: updated, got: %s", movie.Name)
+	}
+	movies, _ = cs.GetAllMovies(ctx)
+	i := slices.IndexFunc(movies, func(m Movie) bool { return m.Id.String() == id })
+	if i < 0 || movies[i].Name != "updated" {
+		t.Errorf("list was not invalidated on update; expected: updated, got: %v", movies)
+	}
+
+	if err := cs.DeleteMovie(ctx, id); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	if _, err := cs.GetMovie(ctx, id); err == nil {
+		t.Errorf("movie was not invalidated on delete")
+	}
+	if n := next.lists.Load(); n != 3 {
+		t.Errorf("wrong number of list calls; expected: 3, got: %d", n)
+	}
+}
+
+func TestCachingServiceListMovies(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	cs := NewCachingService(next, NewMemoryCache(CacheOptions{Size: 10}))
+	for i := 0; i < 3; i++ {
+		cs.CreateMovie(ctx, testMovie())
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, q := range []MovieQuery{{Limit: 2}, {Limit: 2, Offset: 2}} {
+			movies, total, err := cs.ListMovies(ctx, q)
+			if err != nil || total != 3 || len(movies) != min(q.Limit, total-q.Offset) {
+				t.Errorf("wrong page %+v; got: %d of %d movies, error: %v", q, len(movies), total, err)
+			}
+		}
+	}
+	if n := next.lists.Load(); n != 2 {
+		t.Errorf("wrong number of list calls; expected: 2, got: %d", n)
+	}
+
+	// Queries differing only by filter do not share the entry.
+	for _, q := range []MovieQuery{{Filter: MovieFilter{Query: "a,b"}}, {Filter: MovieFilter{Query: "a"}, Directors: []string{"b"}}} {
+		cs.ListMovies(ctx, q)
+	}
+	if n := next.lists.Load(); n != 4 {
+		t.Errorf("wrong number of list calls; expected: 4, got: %d", n)
+	}
+}
+
+func TestCachingServiceCoalescesMisses(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	cs := NewCachingService(next, NewMemoryCache(CacheOptions{Size: 10}))
+	id, _ := cs.CreateMovie(ctx, testMovie())
+	next.release = make(chan struct{})
+	cs.next = next
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cs.GetMovie(ctx, id); err != nil {
+				t.Errorf("error fetching: %v", err)
+			}
+		}()
+	}
+	// Give all callers time to join the first call.
+	time.Sleep(50 * time.Millisecond)
+	close(next.release)
+	wg.Wait()
+
+	if n := next.gets.Load(); n != 1 {
+		t.Errorf("wrong number of calls; expected: 1, got: %d", n)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	now := time.Now()
+	c := newLRUCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.set("a", []byte("1"))
+	c.set("b", []byte("2"))
+	c.get("a")
+	c.set("c", []byte("3"))
+	if _, ok := c.get("b"); ok {
+		t.Errorf("least recently used entry was not evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Errorf("recently used entry was evicted")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get("a"); ok {
+		t.Errorf("expired entry was returned")
+	}
+
+	c.remove("c")
+	if _, ok := c.get("c"); ok {
+		t.Errorf("removed entry was returned")
+	}
+	if _, evictions := c.stats(); evictions != 1 {
+		t.Errorf("wrong number of evictions; expected: 1, got: %d", evictions)
+	}
+}
+
+func TestCachingServiceDropsStaleLoad(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingService()
+	cs := NewCachingService(next, NewMemoryCache(CacheOptions{Size: 10}))
+	id, _ := cs.CreateMovie(ctx, testMovie())
+	next.release = make(chan struct{})
+	cs.next = next
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cs.GetMovie(ctx, id)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := cs.UpdateMovie(ctx, id, &Movie{Name: "updated"}); err != nil {
+		t.Fatalf("error updating: %v", err)
+	}
+	close(next.release)
+	<-done
+
+	movie, err := cs.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+	if movie.Name != "updated" {
+		t.Errorf("movie loaded before update was cached; expected: updated, got: %s", movie.Name)
+	}
+}
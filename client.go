@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Alieksieiev0/movie-microservice/client"
+)
+
+// ClientService implements Service interface using the client of the remote microservice,
+// so the microservice itself can serve another instance through its decorators. Movies of the
+// client are converted into Movie, and errors of the client are wrapped with the matching errors
+// of the Database. It is not available to other modules, since this package cannot be imported.
+type ClientService struct {
+	client *client.Client
+}
+
+// NewClientService creates an instance of the ClientService.
+func NewClientService(c *client.Client) Service {
+	return ClientService{
+		client: c,
+	}
+}
+
+func (cs ClientService) GetMovie(ctx context.Context, id string) (*Movie, error) {
+	movie, err := cs.client.GetMovie(ctx, id)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	return (*Movie)(movie), nil
+}
+
+func (cs ClientService) GetAllMovies(ctx context.Context) ([]Movie, error) {
+	movies, err := cs.client.GetAllMovies(ctx)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	return convertMovies(movies), nil
+}
+
+// ListMovies fetches the page from the API, if the query only pages movies. Otherwise, since
+// the API does not filter or sort movies, all of them are fetched and selected locally.
+func (cs ClientService) ListMovies(ctx context.Context, q MovieQuery) ([]Movie, int, error) {
+	paged := q.IDs == nil && q.Directors == nil && q.Filter == (MovieFilter{}) && q.Sort.Field == ""
+	if paged && q.Limit > 0 {
+		movies, total, err := cs.client.ListMovies(ctx, q.Limit, q.Offset)
+		if err != nil {
+			return nil, 0, clientError(err)
+		}
+		return convertMovies(movies), total, nil
+	}
+
+	movies, err := cs.client.GetAllMovies(ctx)
+	if err != nil {
+		return nil, 0, clientError(err)
+	}
+	page, total := SelectMovies(convertMovies(movies), q)
+	return page, total, nil
+}
+
+func (cs ClientService) CreateMovie(ctx context.Context, movie *Movie) (string, error) {
+	id, err := cs.client.CreateMovie(ctx, (*client.Movie)(movie))
+	return id, clientError(err)
+}
+
+func (cs ClientService) UpdateMovie(ctx context.Context, id string, movie *Movie) error {
+	return clientError(cs.client.UpdateMovie(ctx, id, (*client.Movie)(movie)))
+}
+
+func (cs ClientService) DeleteMovie(ctx context.Context, id string) error {
+	return clientError(cs.client.DeleteMovie(ctx, id))
+}
+
+// convertMovies converts movies of the client into Movie.
+func convertMovies(movies []client.Movie) []Movie {
+	converted := make([]Movie, len(movies))
+	for i, m := range movies {
+		converted[i] = Movie(m)
+	}
+	return converted
+}
+
+// clientError wraps error of the client with the matching error of the Database,
+// so callers of the Service check them the same way.
+func clientError(err error) error {
+	switch {
+	case errors.Is(err, client.ErrMovieNotFound):
+		return fmt.Errorf("%w: %w", ErrMovieNotFound, err)
+	case errors.Is(err, client.ErrNothingToUpdate):
+		return fmt.Errorf("%w: %w", ErrNothingToUpdate, err)
+	}
+	return err
+}
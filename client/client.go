@@ -0,0 +1,309 @@
+// Package client is a typed Go client of the movie microservice HTTP API.
+//
+// Movie type and errors of the package do not depend on the microservice, which is
+// a main package and cannot be imported, so the client is used on its own, e.g. by moviectl.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+// Movie is a movie, as it is returned by the API.
+type Movie struct {
+	Id          uuid.UUID       `json:"id"`
+	Name        string          `json:"name"`
+	ReleaseYear int             `json:"release_year"`
+	Rating      decimal.Decimal `json:"rating"`
+	Genres      []string        `json:"genres"`
+	Director    string          `json:"director"`
+}
+
+// ErrMovieNotFound is returned, when movie with provided id does not exist.
+var ErrMovieNotFound = errors.New("entity with such id does not exist")
+
+// ErrNothingToUpdate is returned, when update does not contain any fields.
+var ErrNothingToUpdate = errors.New("no fields to update")
+
+// Codes of the errors written by the API.
+const (
+	CodeMovieNotFound   = "movie_not_found"
+	CodeNothingToUpdate = "nothing_to_update"
+)
+
+// APIError is returned, when the API responds with an error status.
+type APIError struct {
+	StatusCode int
+	// Code is the machine-readable code of the error, empty if the API did not provide it.
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// Is reports, whether the error is caused by ErrMovieNotFound or ErrNothingToUpdate,
+// according to the error code.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrMovieNotFound:
+		return e.Code == CodeMovieNotFound
+	case ErrNothingToUpdate:
+		return e.Code == CodeNothingToUpdate
+	}
+	return false
+}
+
+// Options configure the Client, zero values are replaced with the defaults.
+type Options struct {
+	// HTTPClient performs requests, http.DefaultClient by default.
+	HTTPClient *http.Client
+	// Token is sent as bearer token in Authorization header, if it is not empty.
+	Token string
+	// MaxRetries is the number of retries of idempotent requests, 3 by default.
+	// Negative value disables retries.
+	MaxRetries int
+	// Backoff before the first retry, 100ms by default. It is doubled with every retry.
+	MinBackoff time.Duration
+	// MaxBackoff limits backoff and Retry-After delay, 5s by default.
+	MaxBackoff time.Duration
+}
+
+// Client calls version 1 of the movie API at the base URL.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	opts    Options
+}
+
+// NewClient creates an instance of the Client, base URL is the address the API is served
+// on, e.g. http://localhost:3000.
+func NewClient(baseURL string, opts Options) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    opts.HTTPClient,
+		opts:    opts,
+	}
+}
+
+// GetMovie fetches movie using provided id.
+func (c *Client) GetMovie(ctx context.Context, id string) (*Movie, error) {
+	movie := &Movie{}
+	_, err := c.do(ctx, http.MethodGet, "/v1/movies/"+url.PathEscape(id), nil, movie)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching movie: %w", err)
+	}
+	return movie, nil
+}
+
+// GetAllMovies fetches all stored movies.
+func (c *Client) GetAllMovies(ctx context.Context) ([]Movie, error) {
+	movies := []Movie{}
+	_, err := c.do(ctx, http.MethodGet, "/v1/movies", nil, &movies)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching movies: %w", err)
+	}
+	return movies, nil
+}
+
+// CreateMovie creates movie using provided Movie struct, id of the movie is ignored.
+// Create requests are not retried, because they are not idempotent.
+func (c *Client) CreateMovie(ctx context.Context, movie *Movie) (string, error) {
+	created := struct {
+		Id string `json:"id"`
+	}{}
+	_, err := c.do(ctx, http.MethodPost, "/v1/movies", movie, &created)
+	if err != nil {
+		return "", fmt.Errorf("error creating movie: %w", err)
+	}
+	return created.Id, nil
+}
+
+// UpdateMovie updates movie with provided id using provided Movie struct.
+// Zero fields are not updated, nil genres are not updated, and empty genres remove all genres.
+func (c *Client) UpdateMovie(ctx context.Context, id string, movie *Movie) error {
+	_, err := c.do(ctx, http.MethodPut, "/v1/movies/"+url.PathEscape(id), movie, nil)
+	if err != nil {
+		return fmt.Errorf("error updating movie: %w", err)
+	}
+	return nil
+}
+
+// DeleteMovie deletes movie with provided id.
+func (c *Client) DeleteMovie(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/v1/movies/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting movie: %w", err)
+	}
+	return nil
+}
+
+// ListMovies fetches a page of movies and the number of all stored movies.
+func (c *Client) ListMovies(ctx context.Context, limit, offset int) ([]Movie, int, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+	movies := []Movie{}
+	header, err := c.do(ctx, http.MethodGet, "/v1/movies?"+query.Encode(), nil, &movies)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching movies: %w", err)
+	}
+	total, err := strconv.Atoi(header.Get("X-Total-Count"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error parsing total count: %v", err)
+	}
+	return movies, total, nil
+}
+
+// do sends the request with JSON encoded body and decodes JSON response into v, if it is
+// not nil. Idempotent requests are retried on network errors and retryable statuses.
+func (c *Client) do(ctx context.Context, method, path string, body, v any) (http.Header, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding request: %v", err)
+		}
+	}
+
+	retries := c.opts.MaxRetries
+	if method == http.MethodPost || retries < 0 {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, method, path, payload)
+		retry := attempt < retries && (err != nil || retryableStatus(res.StatusCode))
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			return res.Header, decodeResponse(res, v)
+		}
+
+		delay := c.backoff(attempt)
+		if err == nil {
+			if after, ok := retryAfter(res); ok {
+				delay = min(after, c.opts.MaxBackoff)
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send performs a single attempt of the request.
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	return res, nil
+}
+
+// backoff returns delay before the retry, doubled with every attempt and jittered,
+// so clients do not retry at the same time.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := min(c.opts.MinBackoff<<attempt, c.opts.MaxBackoff)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryableStatus reports, whether the request may succeed, if it is repeated.
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns delay from the Retry-After header in seconds.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// decodeResponse decodes successful response into v, or returns APIError
+// with the message from the error or problem details body.
+func decodeResponse(res *http.Response, v any) error {
+	if res.StatusCode >= http.StatusBadRequest {
+		body := struct {
+			Error  string `json:"error"`
+			Code   string `json:"code"`
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		}{}
+		json.NewDecoder(res.Body).Decode(&body)
+		msg := body.Error
+		if msg == "" {
+			msg = body.Detail
+		}
+		if msg == "" {
+			msg = body.Title
+		}
+		if msg == "" {
+			msg = http.StatusText(res.StatusCode)
+		}
+		return &APIError{StatusCode: res.StatusCode, Code: body.Code, Message: msg}
+	}
+	if v == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
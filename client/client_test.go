@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testOptions() Options {
+	return Options{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+}
+
+func TestClientRetries(t *testing.T) {
+	calls := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"name": "test", "rating": "8.5"}]`))
+	}))
+	defer srv.Close()
+
+	movies, err := NewClient(srv.URL, testOptions()).GetAllMovies(context.Background())
+	if err != nil || len(movies) != 1 || movies[0].Rating.String() != "8.5" {
+		t.Fatalf("wrong movies; got: %v, error: %v", movies, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("wrong number of attempts; expected: 3, got: %d", calls.Load())
+	}
+}
+
+func TestClientDoesNotRetryCreate(t *testing.T) {
+	calls := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"title": "Internal Server Error", "status": 500, "detail": "panic"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, testOptions()).CreateMovie(context.Background(), &Movie{})
+	apiErr := &APIError{}
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Message != "panic" {
+		t.Errorf("wrong error; expected: 500 panic, got: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("wrong number of attempts; expected: 1, got: %d", calls.Load())
+	}
+}
+
+func TestClientRetriesStopWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	opts := Options{MaxRetries: 100, MinBackoff: 5 * time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	err := NewClient(srv.URL, opts).DeleteMovie(ctx, "id")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error; expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		err      *APIError
+		target   error
+		expected bool
+	}{
+		{&APIError{StatusCode: 422, Code: CodeMovieNotFound, Message: "movie is missing"}, ErrMovieNotFound, true},
+		{&APIError{StatusCode: 422, Code: CodeNothingToUpdate}, ErrNothingToUpdate, true},
+		{&APIError{StatusCode: 422, Code: CodeNothingToUpdate}, ErrMovieNotFound, false},
+		{&APIError{StatusCode: 422, Message: "error: " + ErrMovieNotFound.Error()}, ErrMovieNotFound, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, tt.target); got != tt.expected {
+			t.Errorf("wrong match of %+v with %v; expected: %v, got: %v", tt.err, tt.target, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import "context"
+
+// MovieIterator fetches movies page by page, while they are iterated:
+//
+//	it := c.Movies(100)
+//	for it.Next(ctx) {
+//		movie := it.Movie()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type MovieIterator struct {
+	client   *Client
+	pageSize int
+	offset   int
+	total    int
+	page     []Movie
+	current  int
+	done     bool
+	err      error
+}
+
+// Movies returns iterator over all stored movies, fetching pageSize movies at once.
+func (c *Client) Movies(pageSize int) *MovieIterator {
+	return &MovieIterator{
+		client:   c,
+		pageSize: pageSize,
+		current:  -1,
+	}
+}
+
+// Next advances the iterator to the next movie, fetching the next page if needed.
+// It returns false, when there are no movies left or fetching failed.
+func (it *MovieIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if it.current+1 < len(it.page) {
+		it.current++
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	it.page, it.total, it.err = it.client.ListMovies(ctx, it.pageSize, it.offset)
+	if it.err != nil {
+		return false
+	}
+	it.offset += len(it.page)
+	it.done = len(it.page) < it.pageSize || it.offset >= it.total
+	it.current = 0
+	return len(it.page) > 0
+}
+
+// Movie returns the current movie.
+func (it *MovieIterator) Movie() Movie {
+	return it.page[it.current]
+}
+
+// Total returns the number of all stored movies, as reported with the last fetched page.
+func (it *MovieIterator) Total() int {
+	return it.total
+}
+
+// Err returns the error, that stopped the iteration.
+func (it *MovieIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/Alieksieiev0/movie-microservice/client"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(NewServer(NewMovieService(NewMemoryDatabase())).Handler())
+	defer srv.Close()
+	ctx := context.Background()
+	c := NewClientService(client.NewClient(srv.URL, client.Options{}))
+
+	id, err := c.CreateMovie(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error creating movie: %v", err)
+	}
+	movie, err := c.GetMovie(ctx, id)
+	if err != nil {
+		t.Fatalf("error fetching movie: %v", err)
+	}
+	expectSameMovie(t, movie, testMovie())
+
+	err = c.UpdateMovie(ctx, id, &Movie{Rating: decimal.RequireFromString("7.5")})
+	if err != nil {
+		t.Fatalf("error updating movie: %v", err)
+	}
+	movie, _ = c.GetMovie(ctx, id)
+	if movie.Name != "test" || !movie.Rating.Equal(decimal.RequireFromString("7.5")) {
+		t.Errorf("wrong updated movie; expected: test with 7.5 rating, got: %v", movie)
+	}
+
+	err = c.UpdateMovie(ctx, id, &Movie{})
+	if !errors.Is(err, ErrNothingToUpdate) {
+		t.Errorf("wrong error of empty update; expected: %v, got: %v", ErrNothingToUpdate, err)
+	}
+
+	if err := c.DeleteMovie(ctx, id); err != nil {
+		t.Fatalf("error deleting movie: %v", err)
+	}
+	_, err = c.GetMovie(ctx, id)
+	apiErr := &client.APIError{}
+	if !errors.Is(err, ErrMovieNotFound) || !errors.As(err, &apiErr) || apiErr.StatusCode != 422 {
+		t.Errorf("wrong error of missing movie; expected: 422 %v, got: %v", ErrMovieNotFound, err)
+	}
+}
+
+func TestClientMovieIterator(t *testing.T) {
+	ctx := context.Background()
+	svc := NewMovieService(NewMemoryDatabase())
+	for i := 0; i < 5; i++ {
+		svc.CreateMovie(ctx, testMovie())
+	}
+	srv := httptest.NewServer(NewServer(svc).Handler())
+	defer srv.Close()
+	c := client.NewClient(srv.URL, client.Options{})
+
+	all, err := c.GetAllMovies(ctx)
+	if err != nil || len(all) != 5 {
+		t.Fatalf("wrong movies; expected: 5, got: %d, error: %v", len(all), err)
+	}
+
+	it := c.Movies(2)
+	ids := []string{}
+	for it.Next(ctx) {
+		ids = append(ids, it.Movie().Id.String())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("error iterating movies: %v", err)
+	}
+	if len(ids) != len(all) || it.Total() != len(all) {
+		t.Fatalf("wrong number of iterated movies; expected: %d, got: %d of %d", len(all), len(ids), it.Total())
+	}
+	for i := range all {
+		if ids[i] != all[i].Id.String() {
+			t.Errorf("wrong order of iterated movies; expected: %s at %d, got: %s", all[i].Id, i, ids[i])
+		}
+	}
+}
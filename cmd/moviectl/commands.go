@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Alieksieiev0/movie-microservice/client"
+)
+
+// listPageSize is the number of movies fetched at once by list and export.
+const listPageSize = 100
+
+// getMovie prints movie with provided id.
+func getMovie(e *env, args []string) error {
+	if len(args) != 1 {
+		return usageError{"usage: get <id>"}
+	}
+	movie, err := e.client.GetMovie(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	if e.format == "table" {
+		return printMovies(e, []client.Movie{*movie})
+	}
+	return printValue(e, movie)
+}
+
+// listMovies prints all movies, optionally filtered by genre and sorted by field.
+// Field, prefixed with "-", sorts in descending order.
+func listMovies(e *env, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	genre := fs.String("genre", "", "print only movies of the genre, case insensitive")
+	sortBy := fs.String("sort", "", "sort by name, release_year or rating, prefix - for descending order")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+	if fs.NArg() != 0 {
+		return usageError{"usage: list [--genre genre] [--sort [-]field]"}
+	}
+	field, desc := strings.CutPrefix(*sortBy, "-")
+	compare, ok := movieComparators[field]
+	if !ok && field != "" {
+		return usageError{fmt.Sprintf("unknown sort field: %s", field)}
+	}
+
+	movies, err := fetchMovies(e.client, func(m client.Movie) bool {
+		return *genre == "" || slices.ContainsFunc(m.Genres, func(g string) bool { return strings.EqualFold(g, *genre) })
+	})
+	if err != nil {
+		return err
+	}
+	if compare != nil {
+		slices.SortStableFunc(movies, func(a, b client.Movie) int {
+			if desc {
+				return compare(b, a)
+			}
+			return compare(a, b)
+		})
+	}
+	return printMovies(e, movies)
+}
+
+// movieComparators are the fields, movies can be sorted by.
+var movieComparators = map[string]func(a, b client.Movie) int{
+	"name":         func(a, b client.Movie) int { return strings.Compare(a.Name, b.Name) },
+	"release_year": func(a, b client.Movie) int { return cmp.Compare(a.ReleaseYear, b.ReleaseYear) },
+	"rating":       func(a, b client.Movie) int { return a.Rating.Cmp(b.Rating) },
+}
+
+// createMovie creates movie from the JSON file and prints its id.
+func createMovie(e *env, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	file := fs.String("f", "", "JSON file with the movie, - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+	if *file == "" || fs.NArg() != 0 {
+		return usageError{"usage: create -f <file>"}
+	}
+	movie := &client.Movie{}
+	if err := readJSON(e, *file, movie); err != nil {
+		return err
+	}
+
+	id, err := e.client.CreateMovie(context.Background(), movie)
+	if err != nil {
+		return err
+	}
+	if e.format == "table" {
+		_, err = fmt.Fprintln(e.stdout, id)
+		return err
+	}
+	return printValue(e, map[string]string{"id": id})
+}
+
+// updateMovie updates movie with fields from the JSON file, missing fields are not updated.
+func updateMovie(e *env, args []string) error {
+	usage := usageError{"usage: update <id> -f <file>"}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return usage
+	}
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	file := fs.String("f", "", "JSON file with the updated fields, - for stdin")
+	if err := fs.Parse(args[1:]); err != nil {
+		return usageError{err.Error()}
+	}
+	if *file == "" || fs.NArg() != 0 {
+		return usage
+	}
+	movie := &client.Movie{}
+	if err := readJSON(e, *file, movie); err != nil {
+		return err
+	}
+	return e.client.UpdateMovie(context.Background(), args[0], movie)
+}
+
+// deleteMovies deletes movies with provided ids, stopping at the first error.
+func deleteMovies(e *env, args []string) error {
+	if len(args) == 0 {
+		return usageError{"usage: delete <id>..."}
+	}
+	for _, id := range args {
+		if err := e.client.DeleteMovie(context.Background(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importMovies creates movies from the JSON file, containing an array of movies,
+// stopping at the first error. Ids of the created movies are printed.
+func importMovies(e *env, args []string) error {
+	if len(args) != 1 {
+		return usageError{"usage: import <file>"}
+	}
+	movies := []client.Movie{}
+	if err := readJSON(e, args[0], &movies); err != nil {
+		return err
+	}
+
+	ids := []string{}
+	for i := range movies {
+		id, err := e.client.CreateMovie(context.Background(), &movies[i])
+		if err != nil {
+			return fmt.Errorf("error importing movie %q, %d of %d movies imported: %w", movies[i].Name, i, len(movies), err)
+		}
+		ids = append(ids, id)
+	}
+	if e.format == "table" {
+		_, err := fmt.Fprintf(e.stdout, "%d movies imported\n", len(ids))
+		return err
+	}
+	return printValue(e, map[string][]string{"ids": ids})
+}
+
+// exportMovies writes all movies into the JSON file, which can be imported back.
+func exportMovies(e *env, args []string) error {
+	if len(args) != 1 {
+		return usageError{"usage: export <file>"}
+	}
+	movies, err := fetchMovies(e.client, nil)
+	if err != nil {
+		return err
+	}
+
+	w, closeFile := e.stdout, func() error { return nil }
+	if args[0] != "-" {
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		w, closeFile = f, f.Close
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(movies)
+	if closeErr := closeFile(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing movies: %v", err)
+	}
+	return nil
+}
+
+// fetchMovies fetches all movies page by page, keeping only the ones matching the filter.
+func fetchMovies(c *client.Client, filter func(client.Movie) bool) ([]client.Movie, error) {
+	ctx := context.Background()
+	movies := []client.Movie{}
+	it := c.Movies(listPageSize)
+	for it.Next(ctx) {
+		if filter == nil || filter(it.Movie()) {
+			movies = append(movies, it.Movie())
+		}
+	}
+	return movies, it.Err()
+}
+
+// readJSON decodes the JSON file into v, "-" stands for stdin.
+func readJSON(e *env, path string, v any) error {
+	r := e.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return usageError{fmt.Sprintf("error decoding %s: %v", path, err)}
+	}
+	return nil
+}
+
+// isNetworkError reports, whether the request failed before the response was received.
+func isNetworkError(err error) bool {
+	urlErr := &url.Error{}
+	return errors.As(err, &urlErr)
+}
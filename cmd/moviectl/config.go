@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profile is a named set of connection settings.
+type profile struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token"`
+}
+
+// config is the content of the config file:
+//
+//	current: prod
+//	profiles:
+//	  prod:
+//	    server: https://movies.example.com
+//	    token: secret
+type config struct {
+	Current  string             `yaml:"current"`
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+// defaultConfigPath returns path of the config file in the user config directory,
+// it is overridden by MOVIECTL_CONFIG.
+func defaultConfigPath() string {
+	if path := os.Getenv("MOVIECTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "moviectl", "config.yaml")
+}
+
+// loadProfile reads profile with provided name from the config file, current profile is
+// used, if name is empty. Missing config file is not an error, if no profile is requested,
+// so the server can be provided by flags only.
+func loadProfile(path, name string) (profile, error) {
+	cfg := config{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && name == "":
+		return profile{}, nil
+	case err != nil:
+		return profile{}, fmt.Errorf("error reading config: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return profile{}, fmt.Errorf("error decoding config %s: %v", path, err)
+	}
+
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		return profile{}, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("profile %q does not exist in %s", name, path)
+	}
+	return p, nil
+}
@@ -0,0 +1,172 @@
+// Command moviectl manages the movie catalog through the HTTP API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Alieksieiev0/movie-microservice/client"
+)
+
+// Exit codes reflect the type of the error, so scripts can react to them.
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+	exitNotFound
+	exitInvalid
+	exitUnauthorized
+	exitServer
+	exitUnavailable
+)
+
+// usageError is returned, when command is called with wrong arguments.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// command is a single subcommand of moviectl.
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(env *env, args []string) error
+}
+
+// env is shared by all commands, it is created from the global flags and the profile.
+type env struct {
+	client *client.Client
+	format string
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// commands returns all subcommands supported by moviectl.
+func commands() []command {
+	return []command{
+		{"get", "get <id>", "print movie", getMovie},
+		{"list", "list [--genre genre] [--sort [-]field]", "print movies, sorted by name, release_year or rating", listMovies},
+		{"create", "create -f <file>", "create movie from JSON file, - for stdin", createMovie},
+		{"update", "update <id> -f <file>", "update movie with fields from JSON file, - for stdin", updateMovie},
+		{"delete", "delete <id>...", "delete movies", deleteMovies},
+		{"import", "import <file>", "create movies from JSON array file, - for stdin", importMovies},
+		{"export", "export <file>", "write all movies to JSON file, - for stdout", exportMovies},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run parses global flags, finds subcommand by the first argument and runs it with the rest
+// of arguments. It returns exit code, reflecting the error.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("moviectl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { printUsage(stderr, fs) }
+	configPath := fs.String("config", defaultConfigPath(), "path to the config file with profiles")
+	profileName := fs.String("profile", os.Getenv("MOVIECTL_PROFILE"), "name of the profile, current profile of the config by default")
+	server := fs.String("server", os.Getenv("MOVIECTL_SERVER"), "URL of the server, overrides the profile")
+	token := fs.String("token", os.Getenv("MOVIECTL_TOKEN"), "API token, overrides the profile")
+	format := fs.String("o", "table", "output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		printUsage(stderr, fs)
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" && *format != "yaml" {
+		fmt.Fprintf(stderr, "moviectl: unknown output format: %s\n", *format)
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+	for _, c := range commands() {
+		if c.name != name {
+			continue
+		}
+		profile, err := loadProfile(*configPath, *profileName)
+		if err != nil {
+			fmt.Fprintf(stderr, "moviectl: %v\n", err)
+			return exitUsage
+		}
+		if *server != "" {
+			profile.Server = *server
+		}
+		if *token != "" {
+			profile.Token = *token
+		}
+		if profile.Server == "" {
+			fmt.Fprintln(stderr, "moviectl: server URL must be provided by the profile, -server flag or MOVIECTL_SERVER")
+			return exitUsage
+		}
+
+		e := &env{
+			client: client.NewClient(profile.Server, client.Options{Token: profile.Token}),
+			format: *format,
+			stdin:  stdin,
+			stdout: stdout,
+		}
+		err = c.run(e, fs.Args()[1:])
+		if err != nil {
+			fmt.Fprintf(stderr, "moviectl: %v\n", err)
+		}
+		return exitCode(err)
+	}
+	fmt.Fprintf(stderr, "moviectl: unknown command: %s\n", name)
+	printUsage(stderr, fs)
+	return exitUsage
+}
+
+// printUsage writes the list of all subcommands and global flags.
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: moviectl [flags] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.usage, c.description)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nFlags:")
+	fs.PrintDefaults()
+}
+
+// exitCode converts error returned by the command into exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.As(err, &usageError{}) {
+		return exitUsage
+	}
+	apiErr := &client.APIError{}
+	if !errors.As(err, &apiErr) {
+		if errors.Is(err, context.DeadlineExceeded) || isNetworkError(err) {
+			return exitUnavailable
+		}
+		return exitError
+	}
+	switch {
+	case errors.Is(err, client.ErrMovieNotFound) || apiErr.StatusCode == http.StatusNotFound:
+		return exitNotFound
+	case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+		return exitUnauthorized
+	case apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError:
+		return exitServer
+	}
+	return exitInvalid
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+
+	"github.com/Alieksieiev0/movie-microservice/client"
+)
+
+// fakeAPI is an in-memory implementation of the movie endpoints, used by moviectl.
+type fakeAPI struct {
+	mu     sync.Mutex
+	movies []client.Movie
+	tokens []string
+}
+
+func (f *fakeAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	notFound := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": "error fetching movie: " + client.ErrMovieNotFound.Error(),
+			"code":  client.CodeMovieNotFound,
+		})
+	}
+	mux.HandleFunc("GET /v1/movies", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(f.movies)))
+		json.NewEncoder(w).Encode(f.movies[min(offset, len(f.movies)):min(offset+limit, len(f.movies))])
+	})
+	mux.HandleFunc("GET /v1/movies/{id}", func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range f.movies {
+			if m.Id.String() == r.PathValue("id") {
+				json.NewEncoder(w).Encode(m)
+				return
+			}
+		}
+		notFound(w)
+	})
+	mux.HandleFunc("POST /v1/movies", func(w http.ResponseWriter, r *http.Request) {
+		m := client.Movie{}
+		json.NewDecoder(r.Body).Decode(&m)
+		m.Id = uuid.Must(uuid.NewV4())
+		f.movies = append(f.movies, m)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"id": m.Id})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.tokens = append(f.tokens, r.Header.Get("Authorization"))
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// runMoviectl runs moviectl with the server and stdin, returning exit code and output.
+func runMoviectl(t *testing.T, server, stdin string, args ...string) (int, string) {
+	t.Setenv("MOVIECTL_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(append([]string{"-server", server}, args...), strings.NewReader(stdin), stdout, stderr)
+	if code != exitOK {
+		return code, stderr.String()
+	}
+	return code, stdout.String()
+}
+
+func TestMoviectl(t *testing.T) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api.handler())
+	defer srv.Close()
+
+	movies := `[
+		{"name": "Heat", "release_year": 1995, "rating": "8.3", "genres": ["Crime"], "director": "Michael Mann"},
+		{"name": "Alien", "release_year": 1979, "rating": "8.5", "genres": ["Horror"], "director": "Ridley Scott"}
+	]`
+	if code, out := runMoviectl(t, srv.URL, movies, "import", "-"); code != exitOK || out != "2 movies imported\n" {
+		t.Fatalf("wrong import result; expected: 2 movies imported, got: %d %s", code, out)
+	}
+	movie := `{"name": "Thief", "release_year": 1981, "rating": "7.4", "genres": ["crime"], "director": "Michael Mann"}`
+	if code, out := runMoviectl(t, srv.URL, movie, "create", "-f", "-"); code != exitOK || len(out) != 37 {
+		t.Fatalf("wrong create result; expected: id, got: %d %s", code, out)
+	}
+
+	code, out := runMoviectl(t, srv.URL, "", "-o", "json", "list", "--genre", "Crime", "--sort", "-release_year")
+	listed := []client.Movie{}
+	json.Unmarshal([]byte(out), &listed)
+	if code != exitOK || len(listed) != 2 || listed[0].Name != "Heat" || listed[1].Name != "Thief" {
+		t.Errorf("wrong listed movies; expected: Heat and Thief, got: %d %s", code, out)
+	}
+
+	code, out = runMoviectl(t, srv.URL, "", "-o", "yaml", "get", api.movies[1].Id.String())
+	expected := "id: " + api.movies[1].Id.String() + "\nname: Alien\nrelease_year: 1979\nrating: \"8.5\"\n"
+	if code != exitOK || !strings.HasPrefix(out, expected) {
+		t.Errorf("wrong yaml output; expected prefix: %q, got: %d %q", expected, code, out)
+	}
+
+	code, out = runMoviectl(t, srv.URL, "", "list")
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); code != exitOK || len(lines) != 4 || !strings.HasPrefix(lines[0], "ID") {
+		t.Errorf("wrong table output; expected header and 3 rows, got: %d %s", code, out)
+	}
+}
+
+func TestMoviectlExitCodes(t *testing.T) {
+	srv := httptest.NewServer((&fakeAPI{}).handler())
+	defer srv.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		server string
+		args   []string
+		code   int
+	}{
+		{"not found", srv.URL, []string{"get", "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}, exitNotFound},
+		{"unknown command", srv.URL, []string{"unknown"}, exitUsage},
+		{"missing arguments", srv.URL, []string{"update", "id"}, exitUsage},
+		{"unknown sort field", srv.URL, []string{"list", "--sort", "director"}, exitUsage},
+		{"unreachable server", closed.URL, []string{"list"}, exitUnavailable},
+	}
+	for _, tt := range tests {
+		if code, _ := runMoviectl(t, tt.server, "", tt.args...); code != tt.code {
+			t.Errorf("%s: wrong exit code; expected: %d, got: %d", tt.name, tt.code, code)
+		}
+	}
+}
+
+func TestMoviectlProfile(t *testing.T) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api.handler())
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "current: local\nprofiles:\n  local:\n    server: " + srv.URL + "\n    token: secret\n"
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("error writing config: %v", err)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if code := run([]string{"-config", path, "list"}, nil, stdout, stderr); code != exitOK {
+		t.Fatalf("wrong exit code; expected: %d, got: %d %s", exitOK, code, stderr)
+	}
+	if len(api.tokens) == 0 || api.tokens[0] != "Bearer secret" {
+		t.Errorf("wrong authorization; expected: Bearer secret, got: %v", api.tokens)
+	}
+
+	if code := run([]string{"-config", path, "-profile", "prod", "list"}, nil, stdout, stderr); code != exitUsage {
+		t.Errorf("wrong exit code of missing profile; expected: %d, got: %d", exitUsage, code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Alieksieiev0/movie-microservice/client"
+)
+
+// printMovies writes movies in the requested format.
+func printMovies(e *env, movies []client.Movie) error {
+	if e.format == "table" {
+		tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tYEAR\tRATING\tGENRES\tDIRECTOR")
+		for _, m := range movies {
+			fmt.Fprintf(
+				tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+				m.Id, m.Name, m.ReleaseYear, m.Rating.StringFixed(1), strings.Join(m.Genres, ", "), m.Director,
+			)
+		}
+		return tw.Flush()
+	}
+	return printValue(e, movies)
+}
+
+// printValue writes value as JSON or YAML.
+func printValue(e *env, v any) error {
+	if e.format == "yaml" {
+		return writeYAML(e.stdout, v)
+	}
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML writes value as YAML with the same field names and order as in JSON.
+// JSON is valid YAML, so it is decoded into nodes, which are written in block style.
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(data, node); err != nil {
+		return err
+	}
+	resetStyle(node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// resetStyle clears flow and quoting styles of the node and its children,
+// strings which would be read as other types are still quoted.
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		resetStyle(n)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrUnsupportedMediaType is returned, when request body is encoded with unsupported media type.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Codec encodes response bodies and decodes request bodies of a single media type.
+type Codec interface {
+	// MediaType is written to Content-Type header of the responses.
+	MediaType() string
+	// Encode writes v to the writer.
+	Encode(w io.Writer, v any) error
+	// Decode reads v from the reader.
+	Decode(r io.Reader, v any) error
+}
+
+// CodecRegistry selects codec by Accept and Content-Type headers. Every codec is registered
+// by its media type, aliases and the structured syntax suffix, e.g. application/vnd.movies.v1+json
+// is served by the codec of application/json. The first registered codec is the default one.
+type CodecRegistry struct {
+	codecs []Codec
+	byType map[string]Codec
+}
+
+// NewCodecRegistry creates an instance of the CodecRegistry with provided codecs.
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	r := &CodecRegistry{byType: map[string]Codec{}}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+	return r
+}
+
+// DefaultCodecs returns registry of JSON (default), XML, MessagePack and CBOR codecs.
+func DefaultCodecs() *CodecRegistry {
+	r := NewCodecRegistry(JSONCodec{})
+	r.Register(XMLCodec{}, "text/xml")
+	r.Register(MessagePackCodec{}, "application/x-msgpack", "application/vnd.msgpack")
+	r.Register(CBORCodec{})
+	return r
+}
+
+// Register adds codec, selected by its media type and aliases. Codec, registered earlier
+// with the same media type, is replaced.
+func (r *CodecRegistry) Register(c Codec, aliases ...string) {
+	i := slices.IndexFunc(r.codecs, func(registered Codec) bool { return registered.MediaType() == c.MediaType() })
+	if i >= 0 {
+		r.codecs[i] = c
+	} else {
+		r.codecs = append(r.codecs, c)
+	}
+	for _, t := range append([]string{c.MediaType()}, aliases...) {
+		r.byType[strings.ToLower(t)] = c
+	}
+}
+
+// Default returns the first registered codec.
+func (r *CodecRegistry) Default() Codec {
+	return r.codecs[0]
+}
+
+// MediaTypes returns media types of all registered codecs.
+func (r *CodecRegistry) MediaTypes() []string {
+	types := make([]string, len(r.codecs))
+	for i, c := range r.codecs {
+		types[i] = c.MediaType()
+	}
+	return types
+}
+
+// lookup returns codec of the media type, trying structured syntax suffix, if the
+// media type itself is not registered.
+func (r *CodecRegistry) lookup(mediaType string) (Codec, bool) {
+	if c, ok := r.byType[mediaType]; ok {
+		return c, true
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		c, ok := r.byType["application/"+mediaType[i+1:]]
+		return c, ok
+	}
+	if strings.HasPrefix(mediaType, "application/vnd.movies.") {
+		return r.Default(), true
+	}
+	return nil, false
+}
+
+// Negotiate returns codec of the most preferred media type of the Accept header.
+// Default codec is returned for missing header and wildcards.
+func (r *CodecRegistry) Negotiate(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return r.Default(), true
+	}
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	ranges := []mediaRange{}
+	for _, s := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, mr := range ranges {
+		if mr.mediaType == "*/*" || mr.mediaType == "application/*" {
+			return r.Default(), true
+		}
+		if c, ok := r.lookup(mr.mediaType); ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// ForContentType returns codec of the Content-Type header, default codec is returned
+// for missing header.
+func (r *CodecRegistry) ForContentType(contentType string) (Codec, bool) {
+	if contentType == "" {
+		return r.Default(), true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	return r.lookup(mediaType)
+}
+
+// negotiated returns handler, that responds with 406, if none of the media types accepted
+// by the client is supported. Otherwise, the selected codec is stored in the request context,
+// so readBody and writeBody use it.
+func (s Server) negotiated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		codec, ok := s.codecs.Negotiate(strings.Join(r.Header.Values("Accept"), ","))
+		if !ok {
+			writeJson(w, http.StatusNotAcceptable, map[string]any{
+				"error": "none of the accepted media types is supported, supported: " + strings.Join(s.codecs.MediaTypes(), ", "),
+			})
+			return
+		}
+		ctx := context.WithValue(r.Context(), codecKey, codec)
+		ctx = context.WithValue(ctx, codecsKey, s.codecs)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// readBody decodes request body into v with the codec of the Content-Type header.
+// ErrUnsupportedMediaType is returned, if there is no such codec, and ErrRequestTooLarge,
+// if decompressed body exceeds the limit.
+func readBody(r *http.Request, v any) error {
+	codecs, ok := r.Context().Value(codecsKey).(*CodecRegistry)
+	if !ok {
+		codecs = DefaultCodecs()
+	}
+	contentType := r.Header.Get("Content-Type")
+	codec, ok := codecs.ForContentType(contentType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedMediaType, contentType)
+	}
+	err := codec.Decode(r.Body, v)
+	if body, ok := r.Body.(*decompressedBody); ok && body.err() != nil {
+		return body.err()
+	}
+	return err
+}
+
+// readBodyStatus returns status code of the response to the body, which was not read.
+func readBodyStatus(err error) int {
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		return http.StatusUnsupportedMediaType
+	}
+	if errors.Is(err, ErrRequestTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// writeBody is responsible for writing status code and response body, encoded with the
+// codec negotiated for the request, JSON is used by default.
+func writeBody(w http.ResponseWriter, r *http.Request, s int, v any) {
+	codec, ok := r.Context().Value(codecKey).(Codec)
+	if !ok {
+		writeJson(w, s, v)
+		return
+	}
+	w.Header().Set("Content-Type", codec.MediaType())
+	w.WriteHeader(s)
+	if s == http.StatusNoContent {
+		return
+	}
+	err := codec.Encode(w, v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// JSONCodec encodes values as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) MediaType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (JSONCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// XMLCodec encodes values as XML with element names from xml struct tags. Root element is
+// named after the type, e.g. movie for Movie, and movies for []Movie, maps are encoded as
+// response element with a child element for every key.
+type XMLCodec struct{}
+
+func (XMLCodec) MediaType() string {
+	return "application/xml"
+}
+
+func (XMLCodec) Encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := encodeXML(enc, reflect.ValueOf(v), xmlName(reflect.TypeOf(v))); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func (XMLCodec) Decode(r io.Reader, v any) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// encodeXML writes value as element with provided name.
+func encodeXML(enc *xml.Encoder, v reflect.Value, name string) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, k := range keys {
+			if err := encodeXML(enc, v.MapIndex(k), k.String()); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		item := xmlName(v.Type().Elem())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeXML(enc, v.Index(i), item); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	}
+	return enc.EncodeElement(v.Interface(), start)
+}
+
+// xmlName returns element name of the type: name from the tag of XMLName field or snake case
+// name of the named structs, plural of the element name for slices, response for maps, and item
+// for the other types.
+func xmlName(t reflect.Type) string {
+	if t == nil {
+		return "response"
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Slice:
+		name := xmlName(t.Elem())
+		if strings.HasSuffix(name, "y") {
+			return strings.TrimSuffix(name, "y") + "ies"
+		}
+		return name + "s"
+	case t.Kind() == reflect.Map:
+		return "response"
+	case t.Kind() != reflect.Struct:
+		return "item"
+	}
+	if f, ok := t.FieldByName("XMLName"); ok && f.Type == reflect.TypeOf(xml.Name{}) {
+		if name, _, _ := strings.Cut(f.Tag.Get("xml"), ","); name != "" {
+			return name
+		}
+	}
+	if t.Name() == "" {
+		return "item"
+	}
+	name := []rune{}
+	for i, r := range t.Name() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				name = append(name, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		name = append(name, r)
+	}
+	return string(name)
+}
+
+// MessagePackCodec encodes values as MessagePack with the same structure as JSON, so field
+// names are taken from json tags, and decimals and UUIDs are encoded as strings.
+type MessagePackCodec struct{}
+
+func (MessagePackCodec) MediaType() string {
+	return "application/msgpack"
+}
+
+func (MessagePackCodec) Encode(w io.Writer, v any) error {
+	generic, err := toPortable(v)
+	if err != nil {
+		return err
+	}
+	return msgpack.NewEncoder(w).Encode(generic)
+}
+
+func (MessagePackCodec) Decode(r io.Reader, v any) error {
+	var generic any
+	if err := msgpack.NewDecoder(r).Decode(&generic); err != nil {
+		return err
+	}
+	return fromPortable(generic, v)
+}
+
+// cborDecMode decodes maps with string keys, so they can be converted to JSON.
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]any(nil)),
+}.DecMode()
+
+// CBORCodec encodes values as CBOR with the same structure as JSON, so field names
+// are taken from json tags, and decimals and UUIDs are encoded as strings.
+type CBORCodec struct{}
+
+func (CBORCodec) MediaType() string {
+	return "application/cbor"
+}
+
+func (CBORCodec) Encode(w io.Writer, v any) error {
+	generic, err := toPortable(v)
+	if err != nil {
+		return err
+	}
+	return cbor.NewEncoder(w).Encode(generic)
+}
+
+func (CBORCodec) Decode(r io.Reader, v any) error {
+	var generic any
+	if err := cborDecMode.NewDecoder(r).Decode(&generic); err != nil {
+		return err
+	}
+	return fromPortable(generic, v)
+}
+
+// toPortable converts value into maps, slices, strings and numbers of its JSON representation,
+// so binary formats encode it exactly as JSON does. Integers are kept as integers.
+func toPortable(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return portableNumbers(generic), nil
+}
+
+// portableNumbers replaces json.Number values with int64 or float64.
+func portableNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, item := range v {
+			v[k] = portableNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = portableNumbers(item)
+		}
+	}
+	return v
+}
+
+// fromPortable decodes value, decoded by binary format, into v through its JSON representation.
+func fromPortable(generic, v any) error {
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/shopspring/decimal"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestCodecRegistryNegotiate(t *testing.T) {
+	codecs := DefaultCodecs()
+	tests := []struct {
+		accept    string
+		mediaType string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/xml", "application/xml"},
+		{"application/x-msgpack", "application/msgpack"},
+		{"application/vnd.movies.v1+cbor", "application/cbor"},
+		{"application/vnd.movies.v1", "application/json"},
+		{"application/json; version=1", "application/json"},
+		{"application/xml;q=0.5, application/cbor", "application/cbor"},
+		{"text/html, application/*;q=0.1", "application/json"},
+		{"text/html", ""},
+		{"application/cbor;q=0", ""},
+	}
+	for _, tt := range tests {
+		codec, ok := codecs.Negotiate(tt.accept)
+		mediaType := ""
+		if ok {
+			mediaType = codec.MediaType()
+		}
+		if mediaType != tt.mediaType {
+			t.Errorf("wrong codec for %q; expected: %q, got: %q", tt.accept, tt.mediaType, mediaType)
+		}
+	}
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	h := NewServer(NewMovieService(NewMemoryDatabase())).Handler()
+	rating := decimal.RequireFromString("8.5")
+
+	for _, codec := range []Codec{JSONCodec{}, XMLCodec{}, MessagePackCodec{}, CBORCodec{}} {
+		mediaType := codec.MediaType()
+		body := &bytes.Buffer{}
+		movie := testMovie()
+		movie.Rating = rating
+		if err := codec.Encode(body, movie); err != nil {
+			t.Fatalf("%s: error encoding movie: %v", mediaType, err)
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies", body)
+		r.Header.Set("Content-Type", mediaType)
+		r.Header.Set("Accept", mediaType)
+		h.ServeHTTP(w, r)
+		created := struct {
+			Id string `json:"id" xml:"id"`
+		}{}
+		if err := codec.Decode(w.Body, &created); w.Code != http.StatusCreated || err != nil {
+			t.Fatalf("%s: movie was not created; status: %d, error: %v", mediaType, w.Code, err)
+		}
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/v1/movies/"+created.Id, nil)
+		r.Header.Set("Accept", mediaType)
+		h.ServeHTTP(w, r)
+		if ct := w.Header().Get("Content-Type"); ct != mediaType {
+			t.Errorf("%s: wrong content type; expected: %s, got: %s", mediaType, mediaType, ct)
+		}
+		fetched := &Movie{}
+		if err := codec.Decode(bytes.NewReader(w.Body.Bytes()), fetched); err != nil {
+			t.Fatalf("%s: error decoding movie: %v", mediaType, err)
+		}
+		if fetched.Id.String() != created.Id || !fetched.Rating.Equal(rating) || len(fetched.Genres) != 1 {
+			t.Errorf("%s: wrong movie; expected: %s with 8.5 rating, got: %+v", mediaType, created.Id, fetched)
+		}
+
+		// Decimals and UUIDs have the same representation as in JSON.
+		var generic map[string]any
+		switch codec.(type) {
+		case MessagePackCodec:
+			msgpack.Unmarshal(w.Body.Bytes(), &generic)
+		case CBORCodec:
+			cbor.Unmarshal(w.Body.Bytes(), &generic)
+		case XMLCodec:
+			if !strings.Contains(w.Body.String(), "<movie><id>"+created.Id+"</id>") ||
+				!strings.Contains(w.Body.String(), "<rating>8.5</rating>") {
+				t.Errorf("wrong xml movie; got: %s", w.Body.String())
+			}
+		}
+		if generic != nil && (generic["id"] != created.Id || generic["rating"] != "8.5") {
+			t.Errorf("%s: wrong representation of id and rating; got: %v", mediaType, generic)
+		}
+	}
+}
+
+func TestXMLCodecLists(t *testing.T) {
+	body := &bytes.Buffer{}
+	movies := []Movie{*testMovie(), *testMovie()}
+	if err := (XMLCodec{}).Encode(body, movies); err != nil {
+		t.Fatalf("error encoding movies: %v", err)
+	}
+	decoded := struct {
+		XMLName xml.Name `xml:"movies"`
+		Movies  []Movie  `xml:"movie"`
+	}{}
+	if err := xml.Unmarshal(body.Bytes(), &decoded); err != nil || len(decoded.Movies) != 2 {
+		t.Errorf("wrong movies; expected: 2, got: %d, error: %v, body: %s", len(decoded.Movies), err, body)
+	}
+
+	body.Reset()
+	(XMLCodec{}).Encode(body, map[string]any{"error": "failed"})
+	if !strings.HasSuffix(body.String(), "<response><error>failed</error></response>") {
+		t.Errorf("wrong error body; got: %s", body)
+	}
+}
+
+func TestUnsupportedMediaTypes(t *testing.T) {
+	h := NewServer(NewMovieService(NewMemoryDatabase())).Handler()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.Header.Set("Accept", "text/html")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("wrong status of unsupported accept; expected: %d, got: %d", http.StatusNotAcceptable, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/movies", strings.NewReader("name=test"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("wrong status of unsupported content type; expected: %d, got: %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+}
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+// seedMovies contains sample movies, that are inserted by seed command.
+//
+//go:embed seeds/movies.json
+var seedMovies []byte
+
+// command is a single subcommand of the service binary.
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) error
+}
+
+// commands returns all subcommands supported by the binary.
+func commands() []command {
+	return []command{
+		{"serve", "serve [flags]", "start the HTTP server (default)", serve},
+		{"migrate", "migrate [flags] up|down|status|to N", "manage database schema", migrate},
+		{"relay", "relay [flags]", "publish movie change events from the outbox", relay},
+		{"seed", "seed [flags]", "insert sample movies", seed},
+		{"import", "import [flags] <file>", "insert movies from JSON file, - for stdin", importMovies},
+		{"export", "export [flags] <file>", "write all movies to JSON file, - for stdout", exportMovies},
+		{"check-config", "check-config [flags]", "validate and print configuration", checkConfig},
+		{"routes", "routes", "print registered HTTP endpoints", printRoutes},
+	}
+}
+
+// runCommand finds subcommand by the first argument and runs it with the rest of arguments.
+// Server is started, if the first argument is a flag or no arguments were provided.
+func runCommand(args []string) error {
+	if len(args) == 0 || len(args[0]) > 0 && args[0][0] == '-' {
+		return serve(args)
+	}
+	for _, c := range commands() {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	if args[0] == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command: %s", args[0])
+}
+
+// printUsage writes the list of all subcommands.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: movie-microservice <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.usage, c.description)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nRun movie-microservice <command> -h to see the list of flags.")
+}
+
+// setup loads configuration and creates logger, that are shared by all commands.
+func setup(args []string) (Config, []string, *slog.Logger, error) {
+	cfg, args, err := LoadConfig(args)
+	if err != nil {
+		return Config{}, nil, nil, err
+	}
+
+	level, err := ParseLogLevel(cfg.Log.Level)
+	if err != nil {
+		return Config{}, nil, nil, err
+	}
+	logger, err := NewLogger(os.Stderr, cfg.Log.Format, level)
+	if err != nil {
+		return Config{}, nil, nil, err
+	}
+	slog.SetDefault(logger)
+	logger.Debug("configuration loaded", slog.String("config", cfg.String()))
+	return cfg, args, logger, nil
+}
+
+// withDatabase loads configuration, opens configured movie storage and runs fn,
+// releasing the storage afterwards.
+func withDatabase(args []string, fn func(ctx context.Context, args []string, db Database) error) error {
+	ctx := context.Background()
+	cfg, args, logger, err := setup(args)
+	if err != nil {
+		return err
+	}
+
+	db, closeDB, err := openDatabase(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	return fn(ctx, args, db)
+}
+
+// serve opens configured movie storage and starts the HTTP server until the process is interrupted.
+// Servers are stopped gracefully, so that the storage and cache are released afterwards.
+func serve(args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cfg, _, logger, err := setup(args)
+	if err != nil {
+		return err
+	}
+
+	db, closeDB, err := openDatabase(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	svc := NewMovieService(db)
+	if cfg.Features.Cache {
+		cache, closeCache, err := openCache(ctx, cfg.Cache, logger)
+		if err != nil {
+			return err
+		}
+		defer closeCache()
+		cs := NewCachingService(svc, cache)
+		if cfg.Cache.StatsInterval > 0 {
+			go cs.LogStats(ctx, logger.With(slog.String("component", "cache")), cfg.Cache.StatsInterval)
+		}
+		svc = cs
+	}
+	if cfg.Features.OutboxRelay {
+		r, closeSink, err := newOutboxRelay(cfg, db, logger)
+		if err != nil {
+			return err
+		}
+		defer closeSink()
+		go r.Run(ctx)
+	}
+	loggingService := NewLoggingService(logger.With(slog.String("component", "service")), svc)
+	versionOpts, err := cfg.API.VersionOptions()
+	if err != nil {
+		return err
+	}
+	s := NewServer(
+		loggingService,
+		DefaultMiddlewares(logger.With(slog.String("component", "http")), cfg.Features)...,
+	).WithVersionOptions(versionOpts)
+	if cfg.Features.Compression {
+		s = s.WithCompression(cfg.Compression.Options())
+	}
+	if cfg.Features.GraphQL {
+		g, err := NewGraphQL(loggingService, cfg.GraphQL.Options())
+		if err != nil {
+			return err
+		}
+		s = s.WithGraphQL(g)
+	}
+	if cfg.Features.Webhooks {
+		// Events are enqueued for subscriptions by the relay, which reads them from the outbox.
+		mdb, ok := db.(MovieDatabase)
+		if !ok {
+			return fmt.Errorf("webhooks are not supported by %s store", cfg.Store)
+		}
+		store := NewPgWebhookStore(mdb.conn)
+		deliverer := NewWebhookDeliverer(
+			store,
+			cfg.Webhooks.Options(),
+			logger.With(slog.String("component", "webhooks")),
+		)
+		go deliverer.Run(ctx)
+		s = s.WithWebhooks(store)
+	}
+	// Change events are received from PostgreSql, gRPC Watch is not supported by the other stores.
+	var broker *EventBroker
+	var eventLog EventLog
+	pool, isPostgres := postgresPool(db)
+	if (cfg.Features.Stream || cfg.Features.WebSocket) && !isPostgres {
+		return fmt.Errorf("movie change events are not supported by %s store", cfg.Store)
+	}
+	streamLogger := logger.With(slog.String("component", "stream"))
+	if isPostgres && (cfg.Features.Stream || cfg.Features.WebSocket || cfg.Features.GRPC) {
+		broker = NewEventBroker(max(cfg.Stream.Buffer, cfg.WebSocket.Buffer))
+		eventLog = NewPgEventLog(pool, cfg.Stream.GapTimeout)
+		listener := NewPgEventListener(pool, eventLog, broker, cfg.Stream.GapTimeout, streamLogger)
+		go func() {
+			err := listener.Run(ctx)
+			if err != nil {
+				logger.Error("error listening for movie events", slog.String("error", err.Error()))
+			}
+		}()
+	}
+	if cfg.Features.Stream {
+		s = s.WithEventStream(broker, eventLog, cfg.Stream.Options())
+	}
+	if cfg.Features.WebSocket {
+		router := NewTopicRouter(cfg.WebSocket.Buffer)
+		go router.Run(ctx, broker, streamLogger)
+		s = s.WithWebSocket(router, cfg.WebSocket.Options())
+	}
+
+	// Failure of either server stops the other one as well.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 2)
+	servers := 1
+	if cfg.Features.GRPC {
+		servers++
+		gs := NewGRPCServer(loggingService)
+		if broker != nil {
+			gs = gs.WithWatch(broker, eventLog)
+		}
+		go func() {
+			if err := gs.Start(ctx, cfg.GRPC.Addr, cfg.HTTP.ShutdownTimeout); err != nil {
+				errs <- fmt.Errorf("error serving gRPC: %w", err)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	go func() {
+		errs <- s.Start(ctx, cfg.HTTP)
+	}()
+
+	var serveErr error
+	for range servers {
+		serveErr = errors.Join(serveErr, <-errs)
+		cancel()
+	}
+	logger.Info("servers stopped")
+	return serveErr
+}
+
+// postgresPool returns connection pool of the PostgreSql store.
+func postgresPool(db Database) (*pgxpool.Pool, bool) {
+	mdb, ok := db.(MovieDatabase)
+	if !ok {
+		return nil, false
+	}
+	pool, ok := mdb.conn.(*pgxpool.Pool)
+	return pool, ok
+}
+
+// openDatabase creates Database implementation selected by the store setting.
+// Pending migrations are applied, if auto migration is enabled.
+// Returned function releases resources held by the Database.
+func openDatabase(ctx context.Context, cfg Config, logger *slog.Logger) (Database, func(), error) {
+	switch cfg.Store {
+	case "memory":
+		logger.Warn("movies are stored in memory and will be lost on exit")
+		return NewMemoryDatabase(), func() {}, nil
+	case "postgres":
+		pool, err := ConnectDB(ctx, cfg.Database, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.Features.AutoMigrate {
+			err = migratePostgres(ctx, pool, []string{"up"})
+			if err != nil {
+				pool.Close()
+				return nil, nil, err
+			}
+		}
+		return NewMovieDatabase(pool), pool.Close, nil
+	case "sqlite":
+		db, err := OpenSQLite(cfg.SQLite.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.Features.AutoMigrate {
+			err = migrateSQLite(ctx, db, []string{"up"})
+			if err != nil {
+				db.Close()
+				return nil, nil, err
+			}
+		}
+		return NewSQLiteMovieDatabase(db), func() { db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported store: %s", cfg.Store)
+	}
+}
+
+// openCache creates Cache implementation selected by the cache backend setting.
+// Returned function releases resources held by the Cache.
+func openCache(ctx context.Context, cfg CacheConfig, logger *slog.Logger) (Cache, func(), error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewMemoryCache(cfg.Options()), func() {}, nil
+	case "redis":
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing redis url: %v", err)
+		}
+		client := redis.NewClient(opts)
+		if err := client.Ping(ctx).Err(); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("unable to connect to redis: %v", err)
+		}
+
+		cache := NewRedisCache(client, cfg.Options())
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := cache.Run(ctx, logger); err != nil {
+				logger.Error("cache invalidations are not received", slog.String("error", err.Error()))
+			}
+		}()
+		return cache, func() {
+			cancel()
+			<-done
+			client.Close()
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported cache backend: %s", cfg.Backend)
+	}
+}
+
+// migrate runs migrate subcommand: up, down, status or to N.
+func migrate(args []string) error {
+	ctx := context.Background()
+	cfg, args, logger, err := setup(args)
+	if err != nil {
+		return err
+	}
+
+	switch cfg.Store {
+	case "postgres":
+		pool, err := ConnectDB(ctx, cfg.Database, logger)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		return migratePostgres(ctx, pool, args)
+	case "sqlite":
+		db, err := OpenSQLite(cfg.SQLite.Path)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return migrateSQLite(ctx, db, args)
+	default:
+		return fmt.Errorf("migrations are not supported by %s store", cfg.Store)
+	}
+}
+
+// migratePostgres acquires single connection from the pool and runs migration command on it.
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	migrations, err := EmbeddedMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return runMigrations(ctx, NewMigrator(conn, migrations), args)
+}
+
+// migrateSQLite runs migration command on SQLite database.
+func migrateSQLite(ctx context.Context, db *sql.DB, args []string) error {
+	migrations, err := SQLiteMigrations()
+	if err != nil {
+		return err
+	}
+	return runMigrations(ctx, NewSQLiteMigrator(db, migrations), args)
+}
+
+// runMigrations runs migration command: up, down, status or to N.
+func runMigrations(ctx context.Context, m Migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down|status|to N")
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: migrate to N")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid migration version: %s", args[1])
+		}
+		return m.To(ctx, version)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-30s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
+
+// relay publishes movie change events from the outbox until the process is interrupted.
+func relay(args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cfg, _, logger, err := setup(args)
+	if err != nil {
+		return err
+	}
+
+	db, closeDB, err := openDatabase(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	r, closeSink, err := newOutboxRelay(cfg, db, logger)
+	if err != nil {
+		return err
+	}
+	defer closeSink()
+	return r.Run(ctx)
+}
+
+// newOutboxRelay creates OutboxRelay with the configured sink.
+// Events are written into the outbox only by PostgreSql store.
+// Returned function releases resources held by the sink.
+func newOutboxRelay(cfg Config, db Database, logger *slog.Logger) (OutboxRelay, func(), error) {
+	mdb, ok := db.(MovieDatabase)
+	if !ok {
+		return OutboxRelay{}, nil, fmt.Errorf("outbox is not supported by %s store", cfg.Store)
+	}
+
+	logger = logger.With(slog.String("component", "outbox"))
+	var sink EventSink
+	closeSink := func() {}
+	switch cfg.Outbox.Sink {
+	case "log":
+		sink = NewLogSink(logger)
+	case "webhook":
+		sink = NewWebhookSink(&http.Client{Timeout: 10 * time.Second}, cfg.Outbox.WebhookURL)
+	case "webhooks":
+		sink = NewWebhookDispatcher(NewPgWebhookStore(mdb.conn))
+	case "nats":
+		conn, err := nats.Connect(cfg.Outbox.NATSURL, nats.Name("movie-microservice"), nats.MaxReconnects(-1))
+		if err != nil {
+			return OutboxRelay{}, nil, fmt.Errorf("unable to connect to nats: %v", err)
+		}
+		sink = NewBrokerSink(NewNATSPublisher(conn), cfg.Outbox.TopicPrefix)
+		closeSink = func() {
+			// Drain waits for pending messages, unlike Close.
+			if err := conn.Drain(); err != nil {
+				conn.Close()
+			}
+		}
+	default:
+		return OutboxRelay{}, nil, fmt.Errorf("unsupported outbox sink: %s", cfg.Outbox.Sink)
+	}
+	return NewOutboxRelay(mdb.conn, sink, cfg.Outbox.RelayOptions(), logger), closeSink, nil
+}
+
+// seed inserts sample movies into the database.
+func seed(args []string) error {
+	return withDatabase(args, func(ctx context.Context, _ []string, db Database) error {
+		movies := []Movie{}
+		err := json.Unmarshal(seedMovies, &movies)
+		if err != nil {
+			return fmt.Errorf("error decoding seed movies: %v", err)
+		}
+		return insertMovies(ctx, db, movies)
+	})
+}
+
+// importMovies inserts movies from the JSON file, containing an array of movies.
+func importMovies(args []string) error {
+	return withDatabase(args, func(ctx context.Context, args []string, db Database) error {
+		if len(args) != 1 {
+			return fmt.Errorf("usage: import <file>")
+		}
+		r, err := openInput(args[0])
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		movies := []Movie{}
+		err = json.NewDecoder(r).Decode(&movies)
+		if err != nil {
+			return fmt.Errorf("error decoding movies: %v", err)
+		}
+		return insertMovies(ctx, db, movies)
+	})
+}
+
+// exportMovies writes all stored movies into the JSON file.
+func exportMovies(args []string) error {
+	return withDatabase(args, func(ctx context.Context, args []string, db Database) error {
+		if len(args) != 1 {
+			return fmt.Errorf("usage: export <file>")
+		}
+		movies, err := db.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+
+		w, err := openOutput(args[0])
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(movies)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("error writing movies: %v", err)
+		}
+		slog.Info("movies exported", slog.Int("count", len(movies)), slog.String("file", args[0]))
+		return nil
+	})
+}
+
+// insertMovies inserts every movie into the database, stopping at the first error.
+func insertMovies(ctx context.Context, db Database, movies []Movie) error {
+	for i := range movies {
+		_, err := db.Insert(ctx, &movies[i])
+		if err != nil {
+			return fmt.Errorf("error inserting movie %q: %v", movies[i].Name, err)
+		}
+	}
+	slog.Info("movies inserted", slog.Int("count", len(movies)))
+	return nil
+}
+
+// checkConfig validates configuration and prints it with secrets masked.
+func checkConfig(args []string) error {
+	cfg, _, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	fmt.Print(cfg.String())
+	return nil
+}
+
+// printRoutes prints all endpoints registered by the Server.
+func printRoutes(_ []string) error {
+	for _, r := range NewServer(nil).
+		WithWebhooks(NewMemoryWebhookStore()).
+		WithEventStream(NewEventBroker(0), nil, StreamOptions{}).
+		WithWebSocket(NewTopicRouter(0), WebSocketOptions{}).
+		WithGraphQL(&GraphQL{}).
+		routes() {
+		fmt.Printf("%-7s %s\n", r.method, r.path)
+	}
+	return nil
+}
+
+// openInput opens file for reading, "-" stands for stdin.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// openOutput creates file for writing, "-" stands for stdout.
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// nopWriteCloser is a wrapper around io.Writer with no-op Close method.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestSeedMovies(t *testing.T) {
+	movies := []Movie{}
+	if err := json.Unmarshal(seedMovies, &movies); err != nil {
+		t.Fatalf("error decoding seed movies: %v", err)
+	}
+	for _, m := range movies {
+		if m.Name == "" || m.ReleaseYear == 0 || m.Genres == nil || m.Director == "" {
+			t.Errorf("seed movie has empty required fields: %+v", m)
+		}
+	}
+}
+
+func TestInsertMovies(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	mdb := NewMovieDatabase(mock)
+
+	movies := []Movie{*testMovie(), *testMovie()}
+	for range movies {
+		id := testUUID(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("insert into").
+			WithArgs(testMovieRow(id)[1:]...).
+			WillReturnRows(mock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...))
+		expectOutboxEvent(mock, MovieCreated)
+		mock.ExpectCommit()
+	}
+
+	if err := insertMovies(context.Background(), mdb, movies); err != nil {
+		t.Errorf("error was not expected while inserting: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	if err := runCommand([]string{"unknown"}); err == nil {
+		t.Errorf("error was expected for unknown command")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrRequestTooLarge is returned, when decompressed request body exceeds the limit.
+var ErrRequestTooLarge = errors.New("request body too large")
+
+// CompressionOptions configure compression of the responses and decompression of the requests.
+type CompressionOptions struct {
+	// MinSize is the minimum size of the response body in bytes, that is compressed.
+	// Smaller responses are sent as is, since compression would not make them much smaller.
+	MinSize int
+	// MaxRequestSize limits the size of the decompressed request body in bytes,
+	// so a small compressed body can not exhaust the memory of the service.
+	MaxRequestSize int64
+}
+
+// encoder is a compressing writer, that can be reused for the next response.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encodings are content codings of the responses in order of preference.
+var encodings = []string{"zstd", "br", "gzip"}
+
+// encoderPools reuse encoders of the content codings, since creating them is expensive.
+var encoderPools = map[string]*sync.Pool{
+	"zstd": {New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	"gzip": {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+}
+
+// Compress compresses response bodies with the content coding negotiated by Accept-Encoding
+// header: zstd, br or gzip. Bodies smaller than the minimum size, Server-Sent Events and
+// WebSocket connections are not compressed.
+func Compress(opts CompressionOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(strings.Join(r.Header.Values("Accept-Encoding"), ","))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: opts.MinSize, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding returns the supported content coding with the highest quality in
+// Accept-Encoding header, preferred one is chosen among the equal ones. Empty string is
+// returned, if none of them is accepted, so response is not compressed.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the beginning of the response body, until it reaches the minimum
+// size, and then decides, whether the response is compressed. Headers are sent only after
+// the decision is made.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	status      int
+	wroteHeader bool
+	buf         []byte
+	// decided is set, when headers are sent, enc is set only if the response is compressed.
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.wroteHeader {
+		return
+	}
+	if status == http.StatusSwitchingProtocols {
+		cw.decided = true
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if status < http.StatusOK {
+		// Informational responses, e.g. 103 Early Hints, are sent right away.
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	cw.wroteHeader = true
+	if !cw.compressible() {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader && !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// FlushError sends the buffered body to the client, the response is compressed, if possible,
+// since the size of the streamed body is not known.
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		if err := cw.start(cw.compressible()); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Flush allows handlers to flush the response using http.Flusher.
+func (cw *compressWriter) Flush() {
+	_ = cw.FlushError()
+}
+
+// Hijack allows WebSocket connections to take over the underlying connection,
+// which is never compressed.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if cw.enc != nil {
+		return nil, nil, fmt.Errorf("error hijacking connection: response is compressed")
+	}
+	cw.decided = true
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible reports, whether the response with the status and headers set so far
+// can be compressed.
+func (cw *compressWriter) compressible() bool {
+	switch cw.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType != "text/event-stream"
+}
+
+// start sends headers and the buffered body, compressing it, if requested.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		if h.Get("Content-Type") == "" {
+			// Content type can not be detected by http.ResponseWriter from the compressed body.
+			h.Set("Content-Type", http.DetectContentType(cw.buf))
+		}
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends the rest of the response, after handler returns. Body smaller than
+// the minimum size is sent as is.
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.wroteHeader {
+		_ = cw.start(cw.compressible() && len(cw.buf) >= cw.minSize)
+	}
+	if cw.enc == nil {
+		return
+	}
+	_ = cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+}
+
+// decompressed returns handler, that decompresses request body with gzip Content-Encoding.
+// Decompressed body is limited by the compression options, and other content codings are
+// rejected with 415, as well as gzip ones, if compression is not enabled.
+func (s Server) decompressed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		switch {
+		case encoding == "" || encoding == "identity":
+		case (encoding == "gzip" || encoding == "x-gzip") && s.compression != nil:
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				writeBody(w, r, http.StatusBadRequest, map[string]any{
+					"error": fmt.Sprintf("error decompressing request body: %v", err),
+				})
+				return
+			}
+			// MaxBytesReader also makes the server close the connection, once the limit is
+			// exceeded, so the rest of the compressed body is not read.
+			body := struct {
+				io.Reader
+				io.Closer
+			}{zr, r.Body}
+			r.Body = &decompressedBody{
+				ReadCloser: http.MaxBytesReader(w, body, s.compression.MaxRequestSize),
+				limit:      s.compression.MaxRequestSize,
+			}
+		default:
+			if s.compression != nil {
+				w.Header().Set("Accept-Encoding", "gzip")
+			}
+			writeBody(w, r, http.StatusUnsupportedMediaType, map[string]any{
+				"error": fmt.Sprintf("%v: content encoding %s", ErrUnsupportedMediaType, encoding),
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decompressedBody reads gzip request body limited by http.MaxBytesReader, and records
+// whether the limit was exceeded, since decoders may not return the error of the reader.
+type decompressedBody struct {
+	io.ReadCloser
+	limit    int64
+	exceeded bool
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded = true
+		return n, ErrRequestTooLarge
+	}
+	return n, err
+}
+
+// err returns ErrRequestTooLarge, if the limit was exceeded, while decoding failed
+// with the error of the decoder.
+func (b *decompressedBody) err() error {
+	if b.exceeded {
+		return fmt.Errorf("%w: decompressed body exceeds %d bytes", ErrRequestTooLarge, b.limit)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"zstd;q=0.5, br;q=0.8, gzip", "gzip"},
+		{"GZIP;q=0.1", "gzip"},
+		{"*", "zstd"},
+		{"*;q=0.5, zstd;q=0, br;q=0", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip;q=invalid", ""},
+	}
+	for _, tt := range tests {
+		encoding := negotiateEncoding(tt.acceptEncoding)
+		if encoding != tt.encoding {
+			t.Errorf("wrong encoding for %q; expected: %q, got: %q", tt.acceptEncoding, tt.encoding, encoding)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"Inception","genres":["Action","Sci-Fi"]}`, 100)
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", strconv.Itoa(len(large)))
+			for i := 0; i < len(large); i += 1000 {
+				io.WriteString(w, large[i:min(i+1000, len(large))])
+			}
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"id":"1"}`)
+		case "/stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, large)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}), Compress(CompressionOptions{MinSize: 1024}))
+
+	decoders := map[string]func(r io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for encoding, decode := range decoders {
+		// Every encoder is used twice to check, that encoders are reset after they are pooled.
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/large", nil)
+			r.Header.Set("Accept-Encoding", encoding)
+			h.ServeHTTP(w, r)
+			if ce := w.Header().Get("Content-Encoding"); ce != encoding {
+				t.Fatalf("wrong content encoding; expected: %s, got: %q", encoding, ce)
+			}
+			if cl := w.Header().Get("Content-Length"); cl != "" {
+				t.Errorf("%s: content length was not removed; got: %s", encoding, cl)
+			}
+			if w.Body.Len() >= len(large) {
+				t.Errorf("%s: body was not compressed; size: %d", encoding, w.Body.Len())
+			}
+			dr, err := decode(w.Body)
+			if err != nil {
+				t.Fatalf("%s: error decompressing body: %v", encoding, err)
+			}
+			body, err := io.ReadAll(dr)
+			if err != nil || string(body) != large {
+				t.Errorf("%s: wrong body; error: %v, size: %d", encoding, err, len(body))
+			}
+		}
+	}
+
+	for _, path := range []string{"/small", "/stream", "/empty"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Encoding", "gzip, br, zstd")
+		h.ServeHTTP(w, r)
+		if ce := w.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("%s: response was compressed; content encoding: %s", path, ce)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s: wrong vary header; expected: Accept-Encoding, got: %q", path, vary)
+		}
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, "{}\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("error flushing response: %v", err)
+		}
+	}), Compress(CompressionOptions{MinSize: 1024}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(w, r)
+	if !w.Flushed || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("streamed response was not compressed and flushed; content encoding: %q", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil || string(body) != "{}\n" {
+		t.Errorf("wrong body; expected: %q, got: %q, error: %v", "{}\n", body, err)
+	}
+}
+
+func TestDecompressedRequests(t *testing.T) {
+	gzipped := func(s string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		io.WriteString(zw, s)
+		zw.Close()
+		return buf
+	}
+	movie, err := json.Marshal(testMovie())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewMovieService(NewMemoryDatabase())
+	opts := CompressionOptions{MinSize: 1024, MaxRequestSize: 1024}
+
+	tests := []struct {
+		name     string
+		server   Server
+		encoding string
+		body     io.Reader
+		status   int
+	}{
+		{"gzip", NewServer(svc).WithCompression(opts), "gzip", gzipped(string(movie)), http.StatusCreated},
+		{"identity", NewServer(svc).WithCompression(opts), "identity", bytes.NewReader(movie), http.StatusCreated},
+		{
+			"too large",
+			NewServer(svc).WithCompression(opts),
+			"gzip",
+			gzipped(`{"name":"` + strings.Repeat("a", 1<<20) + `"}`),
+			http.StatusRequestEntityTooLarge,
+		},
+		{"malformed", NewServer(svc).WithCompression(opts), "gzip", bytes.NewReader(movie), http.StatusBadRequest},
+		{"unsupported", NewServer(svc).WithCompression(opts), "br", bytes.NewReader(movie), http.StatusUnsupportedMediaType},
+		{"disabled", NewServer(svc), "gzip", gzipped(string(movie)), http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies", tt.body)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Content-Encoding", tt.encoding)
+		tt.server.Handler().ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: wrong status; expected: %d, got: %d, body: %s", tt.name, tt.status, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,765 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jackc/pgx/v5/tracelog"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config contains all settings of the service.
+//
+// Values are loaded in the following order, every next source overriding the previous one:
+// defaults, optional YAML/TOML file, environment variables, command-line flags.
+// Field tags describe the name of the environment variable (env), the name of the flag (flag),
+// its description (usage) and whether the value should be masked when printed (secret).
+type Config struct {
+	Store       string            `yaml:"store" toml:"store" env:"STORE" flag:"store" usage:"movie storage: postgres, sqlite or memory"`
+	HTTP        HTTPConfig        `yaml:"http" toml:"http"`
+	API         APIConfig         `yaml:"api" toml:"api"`
+	Compression CompressionConfig `yaml:"compression" toml:"compression"`
+	GRPC        GRPCConfig        `yaml:"grpc" toml:"grpc"`
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	SQLite      SQLiteConfig      `yaml:"sqlite" toml:"sqlite"`
+	Cache       CacheConfig       `yaml:"cache" toml:"cache"`
+	Outbox      OutboxConfig      `yaml:"outbox" toml:"outbox"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks" toml:"webhooks"`
+	Stream      StreamConfig      `yaml:"stream" toml:"stream"`
+	WebSocket   WebSocketConfig   `yaml:"websocket" toml:"websocket"`
+	GraphQL     GraphQLConfig     `yaml:"graphql" toml:"graphql"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	Features    FeaturesConfig    `yaml:"features" toml:"features"`
+}
+
+// HTTPConfig contains settings of the HTTP server.
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr" toml:"addr" env:"HTTP_ADDR" flag:"addr" usage:"address to listen on"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT" flag:"read-timeout" usage:"maximum duration for reading the entire request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"read-header-timeout" usage:"maximum duration for reading request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" flag:"write-timeout" usage:"maximum duration before timing out writes of the response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" flag:"idle-timeout" usage:"maximum duration to wait for the next request on keep-alive connection"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"maximum duration to wait for active requests, when servers are stopped"`
+}
+
+// APIConfig contains settings of the API versions.
+type APIConfig struct {
+	Deprecation string `yaml:"deprecation" toml:"deprecation" env:"API_DEPRECATION" flag:"api-deprecation" usage:"date (YYYY-MM-DD) since which unversioned endpoints are deprecated, empty to omit"`
+	Sunset      string `yaml:"sunset" toml:"sunset" env:"API_SUNSET" flag:"api-sunset" usage:"date (YYYY-MM-DD) after which unversioned endpoints may stop responding, empty to omit"`
+}
+
+// CompressionConfig contains settings of the HTTP compression.
+type CompressionConfig struct {
+	MinSize        int   `yaml:"min_size" toml:"min_size" env:"COMPRESSION_MIN_SIZE" flag:"compression-min-size" usage:"minimum size in bytes of the response body, that is compressed"`
+	MaxRequestSize int64 `yaml:"max_request_size" toml:"max_request_size" env:"COMPRESSION_MAX_REQUEST_SIZE" flag:"compression-max-request-size" usage:"maximum size in bytes of the decompressed gzip request body"`
+}
+
+// GRPCConfig contains settings of the gRPC server.
+type GRPCConfig struct {
+	Addr string `yaml:"addr" toml:"addr" env:"GRPC_ADDR" flag:"grpc-addr" usage:"address gRPC server listens on"`
+}
+
+// DatabaseConfig contains settings of the database connection pool and its logging.
+type DatabaseConfig struct {
+	URL               string        `yaml:"url" toml:"url" env:"DATABASE_URL" flag:"database-url" usage:"PostgreSql connection string, PG* variables are used if empty" secret:"true"`
+	MaxConns          int32         `yaml:"max_conns" toml:"max_conns" env:"DB_MAX_CONNS" flag:"db-max-conns" usage:"maximum size of the connection pool"`
+	MinConns          int32         `yaml:"min_conns" toml:"min_conns" env:"DB_MIN_CONNS" flag:"db-min-conns" usage:"minimum size of the connection pool"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime" toml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME" flag:"db-max-conn-lifetime" usage:"duration after which connection is closed"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time" toml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME" flag:"db-max-conn-idle-time" usage:"duration after which idle connection is closed"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" toml:"health_check_period" env:"DB_HEALTH_CHECK_PERIOD" flag:"db-health-check-period" usage:"duration between checks of idle connections"`
+	ConnectAttempts   int           `yaml:"connect_attempts" toml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS" flag:"db-connect-attempts" usage:"number of attempts to reach the database on startup"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" toml:"connect_backoff" env:"DB_CONNECT_BACKOFF" flag:"db-connect-backoff" usage:"delay before the second attempt, doubled for every next one"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff" toml:"connect_max_backoff" env:"DB_CONNECT_MAX_BACKOFF" flag:"db-connect-max-backoff" usage:"maximum delay between attempts"`
+	LogLevel          string        `yaml:"log_level" toml:"log_level" env:"DB_LOG_LEVEL" flag:"db-log-level" usage:"trace, debug, info, warn, error or none"`
+	SlowQuery         time.Duration `yaml:"slow_query" toml:"slow_query" env:"DB_SLOW_QUERY" flag:"db-slow-query" usage:"log only queries slower than the threshold, if positive"`
+	LogSampleRate     float64       `yaml:"log_sample_rate" toml:"log_sample_rate" env:"DB_LOG_SAMPLE_RATE" flag:"db-log-sample-rate" usage:"fraction of successful queries to log, from 0 to 1"`
+	RedactArgs        bool          `yaml:"redact_args" toml:"redact_args" env:"DB_LOG_REDACT_ARGS" flag:"db-log-redact-args" usage:"replace query arguments with placeholder in logs"`
+}
+
+// SQLiteConfig contains settings of the SQLite store.
+type SQLiteConfig struct {
+	Path string `yaml:"path" toml:"path" env:"SQLITE_PATH" flag:"sqlite-path" usage:"path to SQLite database file"`
+}
+
+// CacheConfig contains settings of the movie cache, that is used if the cache feature is enabled.
+type CacheConfig struct {
+	Backend       string        `yaml:"backend" toml:"backend" env:"CACHE_BACKEND" flag:"cache-backend" usage:"cache storage: memory or redis"`
+	RedisURL      string        `yaml:"redis_url" toml:"redis_url" env:"REDIS_URL" flag:"redis-url" usage:"Redis connection string, used by redis cache backend" secret:"true"`
+	Size          int           `yaml:"size" toml:"size" env:"CACHE_SIZE" flag:"cache-size" usage:"maximum number of entries cached in process"`
+	TTL           time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL" flag:"cache-ttl" usage:"time after which cached entry expires, never if zero"`
+	StatsInterval time.Duration `yaml:"stats_interval" toml:"stats_interval" env:"CACHE_STATS_INTERVAL" flag:"cache-stats-interval" usage:"interval between logged cache statistics, never if zero"`
+}
+
+// OutboxConfig contains settings of the relay, that publishes movie change events from the outbox.
+type OutboxConfig struct {
+	Sink            string        `yaml:"sink" toml:"sink" env:"OUTBOX_SINK" flag:"outbox-sink" usage:"where events are published: log, webhook, webhooks or nats"`
+	WebhookURL      string        `yaml:"webhook_url" toml:"webhook_url" env:"OUTBOX_WEBHOOK_URL" flag:"outbox-webhook-url" usage:"URL, events are posted to by webhook sink" secret:"true"`
+	NATSURL         string        `yaml:"nats_url" toml:"nats_url" env:"OUTBOX_NATS_URL" flag:"outbox-nats-url" usage:"NATS server URL, events are published to by nats sink" secret:"true"`
+	TopicPrefix     string        `yaml:"topic_prefix" toml:"topic_prefix" env:"OUTBOX_TOPIC_PREFIX" flag:"outbox-topic-prefix" usage:"prefix of the subjects, events are published to by nats sink"`
+	BatchSize       int           `yaml:"batch_size" toml:"batch_size" env:"OUTBOX_BATCH_SIZE" flag:"outbox-batch-size" usage:"maximum number of events fetched at once"`
+	PollInterval    time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"OUTBOX_POLL_INTERVAL" flag:"outbox-poll-interval" usage:"delay between fetches, when there are no pending events"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff" env:"OUTBOX_RETRY_BACKOFF" flag:"outbox-retry-backoff" usage:"delay before the second attempt to publish event, doubled for every next one"`
+	MaxRetryBackoff time.Duration `yaml:"max_retry_backoff" toml:"max_retry_backoff" env:"OUTBOX_MAX_RETRY_BACKOFF" flag:"outbox-max-retry-backoff" usage:"maximum delay between attempts to publish event"`
+	MaxAttempts     int           `yaml:"max_attempts" toml:"max_attempts" env:"OUTBOX_MAX_ATTEMPTS" flag:"outbox-max-attempts" usage:"number of attempts, after which event becomes dead"`
+	PublishTimeout  time.Duration `yaml:"publish_timeout" toml:"publish_timeout" env:"OUTBOX_PUBLISH_TIMEOUT" flag:"outbox-publish-timeout" usage:"maximum duration of publishing a batch of events"`
+	Retention       time.Duration `yaml:"retention" toml:"retention" env:"OUTBOX_RETENTION" flag:"outbox-retention" usage:"time after which published and dead events are removed by the relay, never if zero"`
+}
+
+// WebhooksConfig contains settings of the webhook deliveries.
+type WebhooksConfig struct {
+	BatchSize        int           `yaml:"batch_size" toml:"batch_size" env:"WEBHOOKS_BATCH_SIZE" flag:"webhooks-batch-size" usage:"maximum number of deliveries sent at once"`
+	PollInterval     time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"WEBHOOKS_POLL_INTERVAL" flag:"webhooks-poll-interval" usage:"delay between fetches, when there are no due deliveries"`
+	Timeout          time.Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOKS_TIMEOUT" flag:"webhooks-timeout" usage:"maximum duration of a single delivery attempt"`
+	MaxAttempts      int           `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOKS_MAX_ATTEMPTS" flag:"webhooks-max-attempts" usage:"number of attempts, after which delivery becomes dead"`
+	RetryBackoff     time.Duration `yaml:"retry_backoff" toml:"retry_backoff" env:"WEBHOOKS_RETRY_BACKOFF" flag:"webhooks-retry-backoff" usage:"delay before the second attempt, doubled for every next one"`
+	MaxRetryBackoff  time.Duration `yaml:"max_retry_backoff" toml:"max_retry_backoff" env:"WEBHOOKS_MAX_RETRY_BACKOFF" flag:"webhooks-max-retry-backoff" usage:"maximum delay between attempts"`
+	AllowPrivateURLs bool          `yaml:"allow_private_urls" toml:"allow_private_urls" env:"WEBHOOKS_ALLOW_PRIVATE_URLS" flag:"webhooks-allow-private-urls" usage:"deliver webhooks to loopback, link-local and private addresses"`
+}
+
+// StreamConfig contains settings of the movie change feed.
+type StreamConfig struct {
+	Buffer       int           `yaml:"buffer" toml:"buffer" env:"STREAM_BUFFER" flag:"stream-buffer" usage:"number of events buffered for a client, before it is disconnected as too slow"`
+	Heartbeat    time.Duration `yaml:"heartbeat" toml:"heartbeat" env:"STREAM_HEARTBEAT" flag:"stream-heartbeat" usage:"interval between heartbeats sent to idle clients"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"STREAM_WRITE_TIMEOUT" flag:"stream-write-timeout" usage:"maximum duration of a single write, before client is disconnected"`
+	ReplayBatch  int           `yaml:"replay_batch" toml:"replay_batch" env:"STREAM_REPLAY_BATCH" flag:"stream-replay-batch" usage:"number of missed events fetched at once, when client resumes"`
+	GapTimeout   time.Duration `yaml:"gap_timeout" toml:"gap_timeout" env:"STREAM_GAP_TIMEOUT" flag:"stream-gap-timeout" usage:"maximum duration events are held back, until the event with the lower id is committed"`
+}
+
+// WebSocketConfig contains settings of the WebSocket topic subscriptions.
+type WebSocketConfig struct {
+	Buffer       int           `yaml:"buffer" toml:"buffer" env:"WS_BUFFER" flag:"ws-buffer" usage:"number of messages buffered for a client, before it is disconnected as too slow"`
+	PingInterval time.Duration `yaml:"ping_interval" toml:"ping_interval" env:"WS_PING_INTERVAL" flag:"ws-ping-interval" usage:"interval between pings sent to clients"`
+	PongWait     time.Duration `yaml:"pong_wait" toml:"pong_wait" env:"WS_PONG_WAIT" flag:"ws-pong-wait" usage:"duration without pong or message, after which client is disconnected"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"WS_WRITE_TIMEOUT" flag:"ws-write-timeout" usage:"maximum duration of a single write, before client is disconnected"`
+	MaxTopics    int           `yaml:"max_topics" toml:"max_topics" env:"WS_MAX_TOPICS" flag:"ws-max-topics" usage:"maximum number of topics subscribed by a single connection"`
+}
+
+// GraphQLConfig contains limits of the GraphQL queries.
+type GraphQLConfig struct {
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity" env:"GRAPHQL_MAX_COMPLEXITY" flag:"graphql-max-complexity" usage:"maximum number of fields resolved by a single query"`
+	MaxDepth      int `yaml:"max_depth" toml:"max_depth" env:"GRAPHQL_MAX_DEPTH" flag:"graphql-max-depth" usage:"maximum nesting of the query fields"`
+	MaxPageSize   int `yaml:"max_page_size" toml:"max_page_size" env:"GRAPHQL_MAX_PAGE_SIZE" flag:"graphql-max-page-size" usage:"maximum number of movies returned by a single page"`
+}
+
+// LogConfig contains settings of the service logger.
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format" usage:"json or text"`
+}
+
+// FeaturesConfig contains toggles of the optional features.
+type FeaturesConfig struct {
+	AccessLog   bool `yaml:"access_log" toml:"access_log" env:"FEATURE_ACCESS_LOG" flag:"access-log" usage:"log every handled HTTP request"`
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate" env:"FEATURE_AUTO_MIGRATE" flag:"auto-migrate" usage:"apply pending migrations before starting the server"`
+	Cache       bool `yaml:"cache" toml:"cache" env:"FEATURE_CACHE" flag:"cache" usage:"cache movies returned by the service"`
+	Webhooks    bool `yaml:"webhooks" toml:"webhooks" env:"FEATURE_WEBHOOKS" flag:"webhooks" usage:"serve webhook subscriptions and send deliveries"`
+	OutboxRelay bool `yaml:"outbox_relay" toml:"outbox_relay" env:"FEATURE_OUTBOX_RELAY" flag:"outbox-relay" usage:"publish movie change events along with serving requests"`
+	Stream      bool `yaml:"stream" toml:"stream" env:"FEATURE_STREAM" flag:"stream" usage:"serve movie change feed as Server-Sent Events"`
+	WebSocket   bool `yaml:"websocket" toml:"websocket" env:"FEATURE_WEBSOCKET" flag:"websocket" usage:"serve movie change events to WebSocket topic subscribers"`
+	GRPC        bool `yaml:"grpc" toml:"grpc" env:"FEATURE_GRPC" flag:"grpc" usage:"serve gRPC API along with HTTP one"`
+	GraphQL     bool `yaml:"graphql" toml:"graphql" env:"FEATURE_GRAPHQL" flag:"graphql" usage:"serve GraphQL endpoint"`
+	Compression bool `yaml:"compression" toml:"compression" env:"FEATURE_COMPRESSION" flag:"compression" usage:"compress responses and accept gzip request bodies"`
+}
+
+// DefaultConfig returns configuration with default values of all settings.
+func DefaultConfig() Config {
+	dbLogOpts := DefaultDatabaseLogOptions()
+	return Config{
+		Store: "postgres",
+		HTTP: HTTPConfig{
+			Addr:              ":3000",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   10 * time.Second,
+		},
+		Compression: CompressionConfig{
+			MinSize:        1024,
+			MaxRequestSize: 10 << 20,
+		},
+		GRPC: GRPCConfig{
+			Addr: ":50051",
+		},
+		Database: DatabaseConfig{
+			MaxConns:          10,
+			MinConns:          0,
+			MaxConnLifetime:   time.Hour,
+			MaxConnIdleTime:   30 * time.Minute,
+			HealthCheckPeriod: time.Minute,
+			ConnectAttempts:   10,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectMaxBackoff: 10 * time.Second,
+			LogLevel:          dbLogOpts.Level.String(),
+			LogSampleRate:     dbLogOpts.SampleRate,
+			RedactArgs:        dbLogOpts.RedactArgs,
+		},
+		SQLite: SQLiteConfig{
+			Path: "movies.db",
+		},
+		Cache: CacheConfig{
+			Backend:       "memory",
+			RedisURL:      "redis://localhost:6379/0",
+			Size:          1000,
+			TTL:           time.Minute,
+			StatsInterval: 5 * time.Minute,
+		},
+		Outbox: OutboxConfig{
+			Sink:            "log",
+			NATSURL:         "nats://localhost:4222",
+			TopicPrefix:     "movies",
+			BatchSize:       100,
+			PollInterval:    time.Second,
+			RetryBackoff:    time.Second,
+			MaxRetryBackoff: 5 * time.Minute,
+			MaxAttempts:     20,
+			PublishTimeout:  time.Minute,
+			Retention:       7 * 24 * time.Hour,
+		},
+		Webhooks: WebhooksConfig{
+			BatchSize:       50,
+			PollInterval:    time.Second,
+			Timeout:         10 * time.Second,
+			MaxAttempts:     8,
+			RetryBackoff:    5 * time.Second,
+			MaxRetryBackoff: time.Hour,
+		},
+		Stream: StreamConfig{
+			Buffer:       64,
+			Heartbeat:    15 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			ReplayBatch:  500,
+			GapTimeout:   10 * time.Second,
+		},
+		WebSocket: WebSocketConfig{
+			Buffer:       64,
+			PingInterval: 30 * time.Second,
+			PongWait:     60 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			MaxTopics:    100,
+		},
+		GraphQL: GraphQLConfig{
+			MaxComplexity: 1000,
+			MaxDepth:      8,
+			MaxPageSize:   100,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Features: FeaturesConfig{
+			AccessLog:   true,
+			Compression: true,
+		},
+	}
+}
+
+// LoadConfig loads configuration from all supported sources and validates it.
+// Variables from .env file are added to the environment, if the file exists.
+// Path to the configuration file is taken from -config flag or CONFIG_FILE variable.
+// Arguments remaining after the flags are returned along with the config.
+func LoadConfig(args []string) (Config, []string, error) {
+	err := godotenv.Load(".env")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil, fmt.Errorf("error loading .env file: %v", err)
+	}
+
+	// Flags are parsed into the separate config first, and applied after the other sources,
+	// so they have the highest priority.
+	flagCfg := DefaultConfig()
+	fset := flag.NewFlagSet("movie-microservice", flag.ContinueOnError)
+	configFile := fset.String("config", os.Getenv("CONFIG_FILE"), "path to YAML or TOML configuration file")
+	err = visitFields(&flagCfg, func(f configField) error {
+		if f.flag != "" {
+			fset.Var(f, f.flag, f.usage)
+		}
+		return nil
+	})
+	if err != nil {
+		return Config{}, nil, err
+	}
+	err = fset.Parse(args)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := DefaultConfig()
+	if *configFile != "" {
+		err = loadConfigFile(*configFile, &cfg)
+		if err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	err = visitFields(&cfg, func(f configField) error {
+		v, ok := os.LookupEnv(f.env)
+		if f.env == "" || !ok {
+			return nil
+		}
+		if err := f.Set(v); err != nil {
+			return fmt.Errorf("%s: %v", f.env, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	set := map[string]string{}
+	fset.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	err = visitFields(&cfg, func(f configField) error {
+		if v, ok := set[f.flag]; ok {
+			return f.Set(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	return cfg, fset.Args(), cfg.Validate()
+}
+
+// loadConfigFile decodes YAML or TOML file, depending on its extension, into the config.
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("error decoding config file: %v", err)
+	}
+	return nil
+}
+
+// Validate checks, that all settings have supported values.
+func (c Config) Validate() error {
+	errs := []error{}
+	switch c.Store {
+	case "postgres", "memory":
+	case "sqlite":
+		if c.SQLite.Path == "" {
+			errs = append(errs, fmt.Errorf("sqlite path must not be empty"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported store: %s", c.Store))
+	}
+	if c.HTTP.Addr == "" {
+		errs = append(errs, fmt.Errorf("http addr must not be empty"))
+	}
+	if _, err := c.API.VersionOptions(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Compression.MinSize < 0 || c.Compression.MaxRequestSize <= 0 {
+		errs = append(errs, fmt.Errorf("compression min_size must not be negative and max_request_size must be positive"))
+	}
+	if c.Features.GRPC && (c.GRPC.Addr == "" || c.GRPC.Addr == c.HTTP.Addr) {
+		errs = append(errs, fmt.Errorf("grpc addr must not be empty and must differ from http addr"))
+	}
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read_timeout", c.HTTP.ReadTimeout},
+		{"read_header_timeout", c.HTTP.ReadHeaderTimeout},
+		{"write_timeout", c.HTTP.WriteTimeout},
+		{"idle_timeout", c.HTTP.IdleTimeout},
+		{"shutdown_timeout", c.HTTP.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			errs = append(errs, fmt.Errorf("http %s must not be negative", t.name))
+		}
+	}
+
+	if c.Database.MaxConns <= 0 {
+		errs = append(errs, fmt.Errorf("database max_conns must be positive"))
+	}
+	if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		errs = append(errs, fmt.Errorf("database min_conns must be between 0 and max_conns"))
+	}
+	if c.Database.MaxConnLifetime <= 0 || c.Database.MaxConnIdleTime <= 0 || c.Database.HealthCheckPeriod <= 0 {
+		errs = append(errs, fmt.Errorf(
+			"database max_conn_lifetime, max_conn_idle_time and health_check_period must be positive",
+		))
+	}
+	if c.Database.ConnectAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("database connect_attempts must be positive"))
+	}
+	if c.Database.ConnectBackoff < 0 || c.Database.ConnectMaxBackoff < c.Database.ConnectBackoff {
+		errs = append(errs, fmt.Errorf(
+			"database connect_backoff must not be negative or greater than connect_max_backoff",
+		))
+	}
+	if _, err := c.Database.LogOptions(); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch c.Cache.Backend {
+	case "memory":
+	case "redis":
+		if c.Cache.RedisURL == "" {
+			errs = append(errs, fmt.Errorf("cache redis_url must not be empty"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported cache backend: %s", c.Cache.Backend))
+	}
+	if c.Cache.Size <= 0 {
+		errs = append(errs, fmt.Errorf("cache size must be positive"))
+	}
+	if c.Cache.TTL < 0 || c.Cache.StatsInterval < 0 {
+		errs = append(errs, fmt.Errorf("cache ttl and stats_interval must not be negative"))
+	}
+
+	switch c.Outbox.Sink {
+	case "log", "webhooks":
+	case "webhook":
+		if c.Outbox.WebhookURL == "" {
+			errs = append(errs, fmt.Errorf("outbox webhook_url must not be empty"))
+		}
+	case "nats":
+		if c.Outbox.NATSURL == "" || c.Outbox.TopicPrefix == "" {
+			errs = append(errs, fmt.Errorf("outbox nats_url and topic_prefix must not be empty"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported outbox sink: %s", c.Outbox.Sink))
+	}
+	if c.Outbox.BatchSize <= 0 || c.Outbox.PollInterval <= 0 || c.Outbox.MaxAttempts <= 0 ||
+		c.Outbox.PublishTimeout <= 0 {
+		errs = append(errs, fmt.Errorf(
+			"outbox batch_size, poll_interval, max_attempts and publish_timeout must be positive",
+		))
+	}
+	if c.Outbox.Retention < 0 {
+		errs = append(errs, fmt.Errorf("outbox retention must not be negative"))
+	}
+	if c.Outbox.RetryBackoff <= 0 || c.Outbox.MaxRetryBackoff < c.Outbox.RetryBackoff {
+		errs = append(errs, fmt.Errorf(
+			"outbox retry_backoff must be positive and not greater than max_retry_backoff",
+		))
+	}
+
+	// Deliveries are enqueued only by the relay, so subscriptions would never receive events.
+	if c.Features.Webhooks && c.Outbox.Sink != "webhooks" {
+		errs = append(errs, fmt.Errorf("webhooks require outbox sink webhooks, got: %s", c.Outbox.Sink))
+	}
+	if c.Webhooks.BatchSize <= 0 || c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("webhooks batch_size, poll_interval and timeout must be positive"))
+	}
+	if c.Webhooks.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("webhooks max_attempts must be positive"))
+	}
+	if c.Webhooks.RetryBackoff <= 0 || c.Webhooks.MaxRetryBackoff < c.Webhooks.RetryBackoff {
+		errs = append(errs, fmt.Errorf(
+			"webhooks retry_backoff must be positive and not greater than max_retry_backoff",
+		))
+	}
+
+	if c.Stream.Buffer <= 0 || c.Stream.Heartbeat <= 0 || c.Stream.WriteTimeout <= 0 || c.Stream.ReplayBatch <= 0 ||
+		c.Stream.GapTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("stream buffer, heartbeat, write_timeout, replay_batch and gap_timeout must be positive"))
+	}
+
+	if c.WebSocket.Buffer <= 0 || c.WebSocket.WriteTimeout <= 0 || c.WebSocket.MaxTopics <= 0 {
+		errs = append(errs, fmt.Errorf("websocket buffer, write_timeout and max_topics must be positive"))
+	}
+	if c.WebSocket.PingInterval <= 0 || c.WebSocket.PongWait <= c.WebSocket.PingInterval {
+		errs = append(errs, fmt.Errorf("websocket ping_interval must be positive and less than pong_wait"))
+	}
+
+	if c.GraphQL.MaxComplexity <= 0 || c.GraphQL.MaxDepth <= 0 || c.GraphQL.MaxPageSize <= 0 {
+		errs = append(errs, fmt.Errorf("graphql max_complexity, max_depth and max_page_size must be positive"))
+	}
+
+	if _, err := ParseLogLevel(c.Log.Level); err != nil {
+		errs = append(errs, err)
+	}
+	if f := strings.ToLower(c.Log.Format); f != "json" && f != "text" {
+		errs = append(errs, fmt.Errorf("unsupported log format: %s", c.Log.Format))
+	}
+	return errors.Join(errs...)
+}
+
+// LogOptions converts database logging settings into DatabaseLogOptions.
+func (c DatabaseConfig) LogOptions() (DatabaseLogOptions, error) {
+	level, err := tracelog.LogLevelFromString(c.LogLevel)
+	if err != nil {
+		return DatabaseLogOptions{}, fmt.Errorf("unsupported database log level: %s", c.LogLevel)
+	}
+	if c.SlowQuery < 0 {
+		return DatabaseLogOptions{}, fmt.Errorf("database slow_query must not be negative")
+	}
+	if c.LogSampleRate < 0 || c.LogSampleRate > 1 {
+		return DatabaseLogOptions{}, fmt.Errorf("database log_sample_rate must be between 0 and 1")
+	}
+	return DatabaseLogOptions{
+		Level:      level,
+		SlowQuery:  c.SlowQuery,
+		SampleRate: c.LogSampleRate,
+		RedactArgs: c.RedactArgs,
+	}, nil
+}
+
+// VersionOptions converts API settings into VersionOptions.
+func (c APIConfig) VersionOptions() (VersionOptions, error) {
+	opts := VersionOptions{}
+	dates := []struct {
+		name  string
+		value string
+		date  *time.Time
+	}{
+		{"deprecation", c.Deprecation, &opts.Deprecation},
+		{"sunset", c.Sunset, &opts.Sunset},
+	}
+	for _, d := range dates {
+		if d.value == "" {
+			continue
+		}
+		date, err := time.Parse(time.DateOnly, d.value)
+		if err != nil {
+			return VersionOptions{}, fmt.Errorf("api %s must be a date in YYYY-MM-DD format: %q", d.name, d.value)
+		}
+		*d.date = date
+	}
+	if !opts.Deprecation.IsZero() && !opts.Sunset.IsZero() && !opts.Sunset.After(opts.Deprecation) {
+		return VersionOptions{}, fmt.Errorf("api sunset must be after deprecation")
+	}
+	return opts, nil
+}
+
+// Options converts cache settings into CacheOptions.
+func (c CacheConfig) Options() CacheOptions {
+	return CacheOptions{
+		Size: c.Size,
+		TTL:  c.TTL,
+	}
+}
+
+// RelayOptions converts outbox settings into RelayOptions.
+func (c OutboxConfig) RelayOptions() RelayOptions {
+	return RelayOptions{
+		BatchSize:       c.BatchSize,
+		PollInterval:    c.PollInterval,
+		RetryBackoff:    c.RetryBackoff,
+		MaxRetryBackoff: c.MaxRetryBackoff,
+		MaxAttempts:     c.MaxAttempts,
+		PublishTimeout:  c.PublishTimeout,
+		Retention:       c.Retention,
+	}
+}
+
+// Options converts webhooks settings into WebhookOptions.
+func (c WebhooksConfig) Options() WebhookOptions {
+	return WebhookOptions{
+		BatchSize:        c.BatchSize,
+		PollInterval:     c.PollInterval,
+		Timeout:          c.Timeout,
+		MaxAttempts:      c.MaxAttempts,
+		RetryBackoff:     c.RetryBackoff,
+		MaxRetryBackoff:  c.MaxRetryBackoff,
+		AllowPrivateURLs: c.AllowPrivateURLs,
+	}
+}
+
+// Options converts compression settings into CompressionOptions.
+func (c CompressionConfig) Options() CompressionOptions {
+	return CompressionOptions{
+		MinSize:        c.MinSize,
+		MaxRequestSize: c.MaxRequestSize,
+	}
+}
+
+// Options converts stream settings into StreamOptions.
+func (c StreamConfig) Options() StreamOptions {
+	return StreamOptions{
+		Heartbeat:    c.Heartbeat,
+		WriteTimeout: c.WriteTimeout,
+		ReplayBatch:  c.ReplayBatch,
+	}
+}
+
+// Options converts WebSocket settings into WebSocketOptions.
+func (c WebSocketConfig) Options() WebSocketOptions {
+	return WebSocketOptions{
+		PingInterval: c.PingInterval,
+		PongWait:     c.PongWait,
+		WriteTimeout: c.WriteTimeout,
+		MaxTopics:    c.MaxTopics,
+	}
+}
+
+// Options converts GraphQL settings into GraphQLOptions.
+func (c GraphQLConfig) Options() GraphQLOptions {
+	return GraphQLOptions{
+		MaxComplexity: c.MaxComplexity,
+		MaxDepth:      c.MaxDepth,
+		MaxPageSize:   c.MaxPageSize,
+	}
+}
+
+// String renders configuration as YAML with all secret values masked.
+func (c Config) String() string {
+	masked := c
+	_ = visitFields(&masked, func(f configField) error {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString(maskSecret(f.value.String()))
+		}
+		return nil
+	})
+	out, err := yaml.Marshal(masked)
+	if err != nil {
+		return fmt.Sprintf("error encoding config: %v", err)
+	}
+	return string(out)
+}
+
+// maskSecret hides the secret value. For URLs only the password, or the username without
+// password, and values of sensitive query parameters are hidden, so the rest of the connection
+// string can still be checked.
+func maskSecret(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return "*****"
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		} else {
+			// Username alone is often a token, e.g. https://token@host.
+			u.User = url.User("xxxxx")
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name, values := range query {
+			if !isSecretParam(name) {
+				continue
+			}
+			for i := range values {
+				values[i] = "xxxxx"
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// secretParams are parts of query parameter names, values of which are hidden by maskSecret.
+var secretParams = []string{"pass", "pwd", "secret", "token", "key", "auth", "sig", "credential"}
+
+// isSecretParam reports, whether value of the query parameter may contain a secret.
+func isSecretParam(name string) bool {
+	name = strings.ToLower(name)
+	return slices.ContainsFunc(secretParams, func(p string) bool { return strings.Contains(name, p) })
+}
+
+// configField describes a single setting of the Config and implements flag.Value,
+// so it can be set from the string representation.
+type configField struct {
+	value  reflect.Value
+	env    string
+	flag   string
+	usage  string
+	secret bool
+}
+
+func (f configField) String() string {
+	if !f.value.IsValid() {
+		return ""
+	}
+	if d, ok := f.value.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+func (f configField) Set(s string) error {
+	switch f.value.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	case string:
+		f.value.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case int, int32, int64:
+		n, err := strconv.ParseInt(s, 10, f.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported config field type: %s", f.value.Type())
+	}
+	return nil
+}
+
+// IsBoolFlag allows boolean flags to be used without value.
+func (f configField) IsBoolFlag() bool {
+	return f.value.IsValid() && f.value.Kind() == reflect.Bool
+}
+
+// visitFields calls fn for every setting of the config, descending into nested sections.
+func visitFields(cfg *Config, fn func(f configField) error) error {
+	return visitStruct(reflect.ValueOf(cfg).Elem(), fn)
+}
+
+func visitStruct(v reflect.Value, fn func(f configField) error) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		sf := v.Type().Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := visitStruct(field, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		err := fn(configField{
+			value:  field,
+			env:    sf.Tag.Get("env"),
+			flag:   sf.Tag.Get("flag"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// testDatabaseConformance checks, that Database implementation follows the contract
+// shared by all implementations. newDB must return an empty Database.
+func testDatabaseConformance(t *testing.T, newDB func(t *testing.T) Database) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db Database)
+	}{
+		{"CRUD", testConformanceCRUD},
+		{"GetAll", testConformanceGetAll},
+		{"List", testConformanceList},
+		{"Query", testConformanceQuery},
+		{"NotFound", testConformanceNotFound},
+		{"InvalidID", testConformanceInvalidID},
+		{"UppercaseID", testConformanceUppercaseID},
+		{"PartialUpdate", testConformancePartialUpdate},
+		{"EmptyUpdate", testConformanceEmptyUpdate},
+		{"ConcurrentWriters", testConformanceConcurrentWriters},
+		{"RatingPrecision", testConformanceRatingPrecision},
+		{"NilAndEmptyGenres", testConformanceGenres},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newDB(t))
+		})
+	}
+}
+
+func testConformanceCRUD(t *testing.T, db Database) {
+	ctx := context.Background()
+	id, err := db.Insert(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	movie, err := db.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+	expectSameMovie(t, movie, testMovie())
+	if movie.Id.String() != id {
+		t.Errorf("wrong id returned; expected: %s, got: %s", id, movie.Id)
+	}
+
+	update := testMovie()
+	update.Name = "updated"
+	if err := db.Update(ctx, id, update); err != nil {
+		t.Fatalf("error updating: %v", err)
+	}
+	movie, err = db.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+	expectSameMovie(t, movie, update)
+
+	if err := db.Delete(ctx, id); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	if _, err := db.Get(ctx, id); !errors.Is(err, ErrMovieNotFound) {
+		t.Errorf("deleted movie was returned; err: %v", err)
+	}
+}
+
+func testConformanceUppercaseID(t *testing.T, db Database) {
+	ctx := context.Background()
+	id, err := db.Insert(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	upper := strings.ToUpper(id)
+
+	movie, err := db.Get(ctx, upper)
+	if err != nil {
+		t.Fatalf("error fetching by uppercase id: %v", err)
+	}
+	if movie.Id.String() != id {
+		t.Errorf("wrong id returned; expected: %s, got: %s", id, movie.Id)
+	}
+	movies, total, err := db.List(ctx, MovieQuery{IDs: []string{upper}})
+	if err != nil {
+		t.Fatalf("error listing by uppercase id: %v", err)
+	}
+	if total != 1 || len(movies) != 1 || movies[0].Id.String() != id {
+		t.Errorf("wrong movies listed by uppercase id; expected: %s, got: %v of %d", id, movies, total)
+	}
+
+	update := testMovie()
+	update.Name = "updated"
+	if err := db.Update(ctx, upper, update); err != nil {
+		t.Fatalf("error updating by uppercase id: %v", err)
+	}
+	if err := db.Delete(ctx, upper); err != nil {
+		t.Fatalf("error deleting by uppercase id: %v", err)
+	}
+	if _, err := db.Get(ctx, id); !errors.Is(err, ErrMovieNotFound) {
+		t.Errorf("deleted movie was returned; err: %v", err)
+	}
+}
+
+func testConformanceGetAll(t *testing.T, db Database) {
+	ctx := context.Background()
+	movies, err := db.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("error fetching all: %v", err)
+	}
+	if movies == nil || len(movies) != 0 {
+		t.Errorf("empty non-nil slice was expected for empty database, got: %#v", movies)
+	}
+
+	ids := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		id, err := db.Insert(ctx, testMovie())
+		if err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+		ids[id] = true
+	}
+
+	movies, err = db.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("error fetching all: %v", err)
+	}
+	if len(movies) != len(ids) {
+		t.Fatalf("wrong number of movies; expected: %d, got: %d", len(ids), len(movies))
+	}
+	for _, m := range movies {
+		if !ids[m.Id.String()] {
+			t.Errorf("unexpected movie returned: %s", m.Id)
+		}
+		expectSameMovie(t, &m, testMovie())
+	}
+}
+
+func testConformanceList(t *testing.T, db Database) {
+	ctx := context.Background()
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		id, err := db.Insert(ctx, testMovie())
+		if err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	movies, err := db.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("error fetching all: %v", err)
+	}
+	for i, m := range movies {
+		if m.Id.String() != ids[i] {
+			t.Errorf("movies are not ordered by id; expected: %s at %d, got: %s", ids[i], i, m.Id)
+		}
+	}
+
+	tests := []struct {
+		q   MovieQuery
+		ids []string
+	}{
+		{MovieQuery{}, ids},
+		{MovieQuery{Limit: 2}, ids[:2]},
+		{MovieQuery{Limit: 2, Offset: 4}, ids[4:]},
+		{MovieQuery{Offset: 3}, ids[3:]},
+		{MovieQuery{Limit: 2, Offset: 10}, []string{}},
+	}
+	for _, tt := range tests {
+		movies, total, err := db.List(ctx, tt.q)
+		if err != nil {
+			t.Fatalf("error listing %+v: %v", tt.q, err)
+		}
+		got := []string{}
+		for _, m := range movies {
+			got = append(got, m.Id.String())
+		}
+		if total != len(ids) || !slices.Equal(got, tt.ids) {
+			t.Errorf("wrong page %+v; expected: %v of %d, got: %v of %d", tt.q, tt.ids, len(ids), got, total)
+		}
+	}
+}
+
+func testConformanceQuery(t *testing.T, db Database) {
+	ctx := context.Background()
+	ids := map[string]string{}
+	for _, m := range []Movie{
+		{Name: "Alien", ReleaseYear: 1979, Rating: decimal.RequireFromString("8.5"), Genres: []string{"Horror", "Sci-Fi"}, Director: "Ridley Scott"},
+		{Name: "Blade Runner", ReleaseYear: 1982, Rating: decimal.RequireFromString("8.1"), Genres: []string{"Sci-Fi"}, Director: "Ridley Scott"},
+		{Name: "Jaws", ReleaseYear: 1975, Rating: decimal.RequireFromString("8.1"), Genres: []string{"Thriller"}, Director: "Steven Spielberg"},
+		{Name: "Duel", ReleaseYear: 1971, Rating: decimal.RequireFromString("7.6"), Genres: []string{"Thriller"}, Director: "Steven Spielberg"},
+	} {
+		id, err := db.Insert(ctx, &m)
+		if err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+		ids[m.Name] = id
+	}
+
+	byName := MovieSort{Field: SortByName}
+	minRating := decimal.RequireFromString("8.1")
+	tests := []struct {
+		q     MovieQuery
+		names []string
+		total int
+	}{
+		{MovieQuery{Filter: MovieFilter{Query: "ridley"}, Sort: byName}, []string{"Alien", "Blade Runner"}, 2},
+		{MovieQuery{Filter: MovieFilter{Query: "AW"}, Sort: byName}, []string{"Jaws"}, 1},
+		{MovieQuery{Filter: MovieFilter{Genre: "sci-fi"}, Sort: byName}, []string{"Alien", "Blade Runner"}, 2},
+		{MovieQuery{Filter: MovieFilter{MinReleaseYear: 1975, MaxReleaseYear: 1980}, Sort: byName}, []string{"Alien", "Jaws"}, 2},
+		{MovieQuery{Filter: MovieFilter{MinRating: &minRating}, Sort: byName}, []string{"Alien", "Blade Runner", "Jaws"}, 3},
+		{MovieQuery{Directors: []string{"Steven Spielberg"}, Sort: byName}, []string{"Duel", "Jaws"}, 2},
+		{MovieQuery{IDs: []string{ids["Jaws"], ids["Alien"]}, Sort: byName}, []string{"Alien", "Jaws"}, 2},
+		{MovieQuery{IDs: []string{}}, []string{}, 0},
+		{MovieQuery{Sort: MovieSort{Field: SortByReleaseYear, Desc: true}, Limit: 2, Offset: 1}, []string{"Alien", "Jaws"}, 4},
+		{MovieQuery{Sort: MovieSort{Field: SortByName, Desc: true}, Limit: 1}, []string{"Jaws"}, 4},
+	}
+	for _, tt := range tests {
+		movies, total, err := db.List(ctx, tt.q)
+		if err != nil {
+			t.Fatalf("error listing %+v: %v", tt.q, err)
+		}
+		got := []string{}
+		for _, m := range movies {
+			got = append(got, m.Name)
+		}
+		if total != tt.total || !slices.Equal(got, tt.names) {
+			t.Errorf("wrong page %+v; expected: %v of %d, got: %v of %d", tt.q, tt.names, tt.total, got, total)
+		}
+	}
+}
+
+func testConformanceNotFound(t *testing.T, db Database) {
+	ctx := context.Background()
+	id := testUUID(t).String()
+
+	if _, err := db.Get(ctx, id); !errors.Is(err, ErrMovieNotFound) {
+		t.Errorf("wrong error on get; expected: %v, got: %v", ErrMovieNotFound, err)
+	}
+	if err := db.Update(ctx, id, testMovie()); !errors.Is(err, ErrMovieNotFound) {
+		t.Errorf("wrong error on update; expected: %v, got: %v", ErrMovieNotFound, err)
+	}
+	if err := db.Delete(ctx, id); !errors.Is(err, ErrMovieNotFound) {
+		t.Errorf("wrong error on delete; expected: %v, got: %v", ErrMovieNotFound, err)
+	}
+}
+
+func testConformanceInvalidID(t *testing.T, db Database) {
+	ctx := context.Background()
+	if _, err := db.Get(ctx, "not-a-uuid"); err == nil {
+		t.Errorf("error was expected on get with malformed id")
+	}
+	if err := db.Update(ctx, "not-a-uuid", testMovie()); err == nil {
+		t.Errorf("error was expected on update with malformed id")
+	}
+	if err := db.Delete(ctx, "not-a-uuid"); err == nil {
+		t.Errorf("error was expected on delete with malformed id")
+	}
+}
+
+// testConformancePartialUpdate checks the rules of MovieDatabase.buildUpdateQuery:
+// every field with value different from its type zero value is updated, others are kept.
+func testConformancePartialUpdate(t *testing.T, db Database) {
+	tests := []struct {
+		name   string
+		update Movie
+		apply  func(m *Movie)
+	}{
+		{"name", Movie{Name: "other"}, func(m *Movie) { m.Name = "other" }},
+		{"release year", Movie{ReleaseYear: 1999}, func(m *Movie) { m.ReleaseYear = 1999 }},
+		{
+			"rating",
+			Movie{Rating: decimal.RequireFromString("7.5")},
+			func(m *Movie) { m.Rating = decimal.RequireFromString("7.5") },
+		},
+		{"genres", Movie{Genres: []string{"a", "b"}}, func(m *Movie) { m.Genres = []string{"a", "b"} }},
+		{"director", Movie{Director: "other"}, func(m *Movie) { m.Director = "other" }},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := db.Insert(ctx, testMovie())
+			if err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+			if err := db.Update(ctx, id, &tt.update); err != nil {
+				t.Fatalf("error updating: %v", err)
+			}
+
+			movie, err := db.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("error fetching: %v", err)
+			}
+			expected := testMovie()
+			tt.apply(expected)
+			expectSameMovie(t, movie, expected)
+		})
+	}
+}
+
+func testConformanceEmptyUpdate(t *testing.T, db Database) {
+	ctx := context.Background()
+	id, err := db.Insert(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := db.Update(ctx, id, &Movie{}); !errors.Is(err, ErrNothingToUpdate) {
+		t.Errorf("wrong error on empty update; expected: %v, got: %v", ErrNothingToUpdate, err)
+	}
+}
+
+// testConformanceConcurrentWriters inserts movies and updates different fields
+// of the same movie concurrently, expecting all writes to be persisted.
+func testConformanceConcurrentWriters(t *testing.T, db Database) {
+	ctx := context.Background()
+	shared, err := db.Insert(ctx, testMovie())
+	if err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+
+	const writers = 10
+	updates := []Movie{
+		{Name: "concurrent"},
+		{ReleaseYear: 2000},
+		{Rating: decimal.RequireFromString("1.5")},
+		{Genres: []string{"concurrent"}},
+		{Director: "concurrent"},
+	}
+	errs := make(chan error, writers+len(updates))
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.Insert(ctx, testMovie())
+			errs <- err
+		}()
+	}
+	for i := range updates {
+		wg.Add(1)
+		go func(m Movie) {
+			defer wg.Done()
+			errs <- db.Update(ctx, shared, &m)
+		}(updates[i])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("error writing concurrently: %v", err)
+		}
+	}
+
+	movies, err := db.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("error fetching all: %v", err)
+	}
+	if len(movies) != writers+1 {
+		t.Errorf("wrong number of movies; expected: %d, got: %d", writers+1, len(movies))
+	}
+	movie, err := db.Get(ctx, shared)
+	if err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+	expectSameMovie(t, movie, &Movie{
+		Name:        "concurrent",
+		ReleaseYear: 2000,
+		Rating:      decimal.RequireFromString("1.5"),
+		Genres:      []string{"concurrent"},
+		Director:    "concurrent",
+	})
+}
+
+// testConformanceRatingPrecision checks, that rating is stored exactly as numeric(3,1):
+// without floating point errors, rounded to one decimal place and limited to 99.9.
+func testConformanceRatingPrecision(t *testing.T, db Database) {
+	tests := []struct {
+		rating   string
+		expected string
+	}{
+		{"7.1", "7.1"},
+		{"0.3", "0.3"},
+		{"99.9", "99.9"},
+		{"8.25", "8.3"},
+		{"8.24", "8.2"},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		movie := testMovie()
+		movie.Rating = decimal.RequireFromString(tt.rating)
+		id, err := db.Insert(ctx, movie)
+		if err != nil {
+			t.Fatalf("error inserting rating %s: %v", tt.rating, err)
+		}
+		stored, err := db.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("error fetching: %v", err)
+		}
+		if !stored.Rating.Equal(decimal.RequireFromString(tt.expected)) {
+			t.Errorf("wrong rating stored; expected: %s, got: %s", tt.expected, stored.Rating)
+		}
+	}
+
+	movie := testMovie()
+	movie.Rating = decimal.NewFromInt(100)
+	if _, err := db.Insert(ctx, movie); err == nil {
+		t.Errorf("error was expected for rating, that does not fit into numeric(3,1)")
+	}
+}
+
+// testConformanceGenres checks the difference between nil and empty genres:
+// nil is rejected on insert and ignored on update, empty is stored as empty list.
+func testConformanceGenres(t *testing.T, db Database) {
+	ctx := context.Background()
+	movie := testMovie()
+	movie.Genres = nil
+	if _, err := db.Insert(ctx, movie); err == nil {
+		t.Errorf("error was expected for nil genres")
+	}
+
+	movie.Genres = []string{}
+	id, err := db.Insert(ctx, movie)
+	if err != nil {
+		t.Fatalf("error inserting empty genres: %v", err)
+	}
+	stored, err := db.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+	if stored.Genres == nil || len(stored.Genres) != 0 {
+		t.Errorf("empty non-nil genres were expected, got: %#v", stored.Genres)
+	}
+
+	if err := db.Update(ctx, id, &Movie{Name: "renamed", Genres: nil}); err != nil {
+		t.Fatalf("error updating: %v", err)
+	}
+	if err := db.Update(ctx, id, &Movie{Genres: []string{"a"}}); err != nil {
+		t.Fatalf("error updating: %v", err)
+	}
+	if err := db.Update(ctx, id, &Movie{Genres: []string{}}); err != nil {
+		t.Fatalf("error updating: %v", err)
+	}
+	stored, err = db.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+	if stored.Name != "renamed" || stored.Genres == nil || len(stored.Genres) != 0 {
+		t.Errorf("genres were not cleared by empty update, got: %+v", *stored)
+	}
+}
+
+// expectSameMovie compares all fields of the movies except id.
+func expectSameMovie(t *testing.T, got, expected *Movie) {
+	t.Helper()
+	if got.Name != expected.Name ||
+		got.ReleaseYear != expected.ReleaseYear ||
+		!got.Rating.Equal(expected.Rating) ||
+		!slices.Equal(got.Genres, expected.Genres) ||
+		got.Director != expected.Director {
+		t.Errorf("wrong movie returned; expected: %+v, got: %+v", *expected, *got)
+	}
+}
+
+func TestMemoryDatabaseConformance(t *testing.T) {
+	testDatabaseConformance(t, func(t *testing.T) Database {
+		return NewMemoryDatabase()
+	})
+}
+
+// TestMovieDatabaseConformance runs conformance tests against the real PostgreSql database,
+// if its connection string is provided in TEST_DATABASE_URL variable.
+// All data in the movie table is removed before each test.
+func TestMovieDatabaseConformance(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	cfg := DefaultConfig().Database
+	cfg.URL = url
+	cfg.ConnectAttempts = 1
+	pool, err := ConnectDB(ctx, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if err := migratePostgres(ctx, pool, []string{"up"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testDatabaseConformance(t, func(t *testing.T) Database {
+		if _, err := pool.Exec(ctx, "truncate movie"); err != nil {
+			t.Fatal(err)
+		}
+		return NewMovieDatabase(pool)
+	})
+}
+
+func TestSQLiteMovieDatabaseConformance(t *testing.T) {
+	testDatabaseConformance(t, func(t *testing.T) Database {
+		db, err := OpenSQLite(filepath.Join(t.TempDir(), "movies.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := migrateSQLite(context.Background(), db, []string{"up"}); err != nil {
+			t.Fatal(err)
+		}
+		return NewSQLiteMovieDatabase(db)
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// contextKey is used to store request scoped values in the context.
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	traceIDKey
+	codecKey
+	codecsKey
+	movieFieldsKey
+)
+
+// WithRequestID returns a copy of the context carrying provided request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns request id stored in the context, or empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTraceID returns a copy of the context carrying provided trace id.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey, id)
+}
+
+// TraceIDFromContext returns trace id stored in the context, or empty string.
+func TraceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey).(string)
+	return id
+}
+
+// WithMovieFields returns a copy of the context carrying the fields of the movies requested
+// by the client, so the storage can fetch only them.
+func WithMovieFields(ctx context.Context, fields []string) context.Context {
+	return context.WithValue(ctx, movieFieldsKey, fields)
+}
+
+// MovieFieldsFromContext returns the requested fields of the movies stored in the context,
+// or nil, if all fields are requested.
+func MovieFieldsFromContext(ctx context.Context) []string {
+	fields, _ := ctx.Value(movieFieldsKey).([]string)
+	return fields
+}
+
+// traceIDFromHeader extracts trace id from the W3C traceparent header
+// (version-traceid-parentid-flags). Empty string is returned for malformed headers.
+func traceIDFromHeader(h http.Header) string {
+	parts := strings.Split(h.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/gofrs/uuid/v5"
 	pgxuuid "github.com/jackc/pgx-gofrs-uuid"
 	pgxdecimal "github.com/jackc/pgx-shopspring-decimal"
 	"github.com/jackc/pgx/v5"
@@ -20,8 +21,10 @@ import (
 type Database interface {
 	// Get fetches movie from the DB using provided id.
 	Get(ctx context.Context, id string) (*Movie, error)
-	// GetAllMovies fetches all movies stored in DB using provided id.
+	// GetAllMovies fetches all movies stored in DB ordered by id.
 	GetAll(ctx context.Context) ([]Movie, error)
+	// List fetches the page of movies selected by the query and the number of all of them.
+	List(ctx context.Context, q MovieQuery) ([]Movie, int, error)
 	// CreateMovie creates movie row in DB using provided Movie struct.
 	Insert(ctx context.Context, movie *Movie) (string, error)
 	// UpdateMovie updates movie row in DB with provided id using provided Movie struct.
@@ -30,6 +33,26 @@ type Database interface {
 	Delete(ctx context.Context, id string) error
 }
 
+// MovieQuery describes the page of movies. Movies are ordered by the sort field and then by id,
+// so pages do not overlap.
+type MovieQuery struct {
+	// IDs and Directors select only movies with the listed ids or directors, if they are not nil.
+	IDs       []string
+	Directors []string
+	Filter    MovieFilter
+	Sort      MovieSort
+	// Limit is the maximum number of movies in the page, all movies are returned, if it is zero.
+	Limit  int
+	Offset int
+}
+
+// ErrMovieNotFound is returned by Database implementations, when movie with provided id does not exist.
+var ErrMovieNotFound = errors.New("entity with such id does not exist")
+
+// ErrNothingToUpdate is returned by Database implementations, when update does not contain
+// any field with value different from types zero value.
+var ErrNothingToUpdate = errors.New("no fields to update")
+
 // databaseConn is responsible for providing methods for communicating with DB.
 type databaseConn interface {
 	Begin(ctx context.Context) (pgx.Tx, error)
@@ -49,28 +72,136 @@ func NewMovieDatabase(conn databaseConn) Database {
 	}
 }
 
+// movieColumns returns select list of the movie fields, all fields if none are provided.
+// Columns are listed explicitly, so columns added to the table are not scanned into Movie.
+func movieColumns(fields []string) string {
+	if len(fields) == 0 {
+		fields = movieFields
+	}
+	return strings.Join(fields, ", ")
+}
+
+// Get fetches only the fields of the movie requested by the context, other fields are left zero.
 func (mdb MovieDatabase) Get(ctx context.Context, id string) (*Movie, error) {
-	rows, err := mdb.conn.Query(ctx, "select * from movie where id = $1", id)
+	q := "select " + movieColumns(MovieFieldsFromContext(ctx)) + " from movie where id = $1"
+	rows, err := mdb.conn.Query(ctx, q, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	movie, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Movie])
+	movie, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByNameLax[Movie])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMovieNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return movie, nil
 }
 
+// GetAll fetches only the fields of the movies requested by the context, other fields are left zero.
 func (mdb MovieDatabase) GetAll(ctx context.Context) ([]Movie, error) {
-	rows, err := mdb.conn.Query(ctx, "select * from movie")
+	return mdb.queryMovies(ctx, "select "+movieColumns(MovieFieldsFromContext(ctx))+" from movie order by id")
+}
+
+// List fetches only the fields of the movies requested by the context, other fields are left zero.
+func (mdb MovieDatabase) List(ctx context.Context, q MovieQuery) ([]Movie, int, error) {
+	where, params := mdb.buildListConditions(q)
+	// Null limit returns all rows.
+	var limit any
+	if q.Limit > 0 {
+		limit = q.Limit
+	}
+	order := orderClause(q.Sort, map[string]string{
+		SortByName:        `name collate "C"`,
+		SortByReleaseYear: "release_year",
+		SortByRating:      "coalesce(rating, 0)",
+	})
+	movies, err := mdb.queryMovies(
+		ctx,
+		fmt.Sprintf(
+			"select %s from movie%s%s limit $%d offset $%d",
+			movieColumns(MovieFieldsFromContext(ctx)), where, order, len(params)+1, len(params)+2,
+		),
+		append(slices.Clip(params), limit, q.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = mdb.conn.QueryRow(ctx, "select count(*) from movie"+where, params...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	return movies, total, nil
+}
+
+// buildListConditions returns where clause of the query and its params.
+// Names are compared in the "C" collation, so they are ordered the same way by all stores.
+func (mdb MovieDatabase) buildListConditions(q MovieQuery) (string, []any) {
+	conditions := []string{}
+	params := []any{}
+	add := func(condition string, param any) {
+		params = append(params, param)
+		conditions = append(conditions, fmt.Sprintf(condition, len(params)))
+	}
+
+	if q.IDs != nil {
+		// Strings are not encoded into uuid array.
+		add("id = any($%d)", parseMovieIds(q.IDs))
+	}
+	if q.Directors != nil {
+		add("director = any($%d)", q.Directors)
+	}
+	if q.Filter.Query != "" {
+		add("(strpos(lower(name), lower($%[1]d)) > 0 or strpos(lower(director), lower($%[1]d)) > 0)", q.Filter.Query)
+	}
+	if q.Filter.Genre != "" {
+		add("exists (select from unnest(genres) g where lower(g) = lower($%d))", q.Filter.Genre)
+	}
+	if q.Filter.MinReleaseYear != 0 {
+		add("release_year >= $%d", q.Filter.MinReleaseYear)
+	}
+	if q.Filter.MaxReleaseYear != 0 {
+		add("release_year <= $%d", q.Filter.MaxReleaseYear)
+	}
+	if q.Filter.MinRating != nil {
+		add("coalesce(rating, 0) >= $%d", *q.Filter.MinRating)
+	}
+	return whereClause(conditions), params
+}
+
+// whereClause joins conditions of the query, it is empty, if there are no conditions.
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(conditions, " and ")
+}
+
+// orderClause orders movies by the column of the sort field and then by id.
+func orderClause(s MovieSort, columns map[string]string) string {
+	column, ok := columns[s.Field]
+	if !ok {
+		return " order by id"
+	}
+	if s.Desc {
+		column += " desc"
+	}
+	return " order by " + column + ", id"
+}
+
+// queryMovies fetches movies selected by provided query.
+func (mdb MovieDatabase) queryMovies(ctx context.Context, q string, args ...any) ([]Movie, error) {
+	rows, err := mdb.conn.Query(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	movies, err := pgx.CollectRows(rows, pgx.RowToStructByName[Movie])
+	movies, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[Movie])
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +209,7 @@ func (mdb MovieDatabase) GetAll(ctx context.Context) ([]Movie, error) {
 }
 
 func (mdb MovieDatabase) Insert(ctx context.Context, movie *Movie) (id string, err error) {
-	tx, err := mdb.conn.Begin(context.Background())
+	tx, err := mdb.conn.Begin(ctx)
 	if err != nil {
 		return
 	}
@@ -88,17 +219,16 @@ func (mdb MovieDatabase) Insert(ctx context.Context, movie *Movie) (id string, e
 		case nil:
 			err = tx.Commit(ctx)
 		default:
-			err = tx.Rollback(ctx)
+			tx.Rollback(ctx)
 		}
 	}()
 
 	q := `
 	insert into movie(name, release_year, rating, genres, director)
 	values ($1, $2, $3, $4, $5)
-	returning id
-	`
+	returning ` + movieColumns(nil)
 	rows, err := tx.Query(
-		context.Background(),
+		ctx,
 		q,
 		movie.Name,
 		movie.ReleaseYear,
@@ -111,14 +241,20 @@ func (mdb MovieDatabase) Insert(ctx context.Context, movie *Movie) (id string, e
 	}
 	defer rows.Close()
 
-	movieId, err := pgx.CollectExactlyOneRow(rows, pgx.RowTo[uuid.UUID])
+	created, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Movie])
+	if err != nil {
+		return
+	}
+
+	err = writeEvent(ctx, tx, MovieCreated, created.Id, created)
 	if err != nil {
 		return
 	}
-	return movieId.String(), nil
+	return created.Id.String(), nil
 }
+
 func (mdb MovieDatabase) Update(ctx context.Context, id string, movie *Movie) (err error) {
-	tx, err := mdb.conn.Begin(context.Background())
+	tx, err := mdb.conn.Begin(ctx)
 	if err != nil {
 		return
 	}
@@ -128,7 +264,7 @@ func (mdb MovieDatabase) Update(ctx context.Context, id string, movie *Movie) (e
 		case nil:
 			err = tx.Commit(ctx)
 		default:
-			err = tx.Rollback(ctx)
+			tx.Rollback(ctx)
 		}
 	}()
 
@@ -137,16 +273,21 @@ func (mdb MovieDatabase) Update(ctx context.Context, id string, movie *Movie) (e
 		return
 	}
 
-	ct, err := tx.Exec(context.Background(), q, params...)
+	rows, err := tx.Query(ctx, q+" returning "+movieColumns(nil), params...)
 	if err != nil {
 		return
 	}
+	defer rows.Close()
 
-	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("entity with such id does not exist")
+	updated, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[Movie])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMovieNotFound
+	}
+	if err != nil {
+		return
 	}
 
-	return nil
+	return writeEvent(ctx, tx, MovieUpdated, updated.Id, updated)
 }
 
 // buildUpdateQuery dynamically adds statements into the query string for fields
@@ -185,6 +326,10 @@ func (mdb MovieDatabase) buildUpdateQuery(movie *Movie, id string) (string, []an
 		addToQuery(movie.Director, "director", &counter, &statements, &params)
 	}
 
+	if len(statements) == 0 {
+		return "", nil, ErrNothingToUpdate
+	}
+
 	params = append(params, id)
 	q := fmt.Sprintf("update movie set %s where id = $%d", strings.Join(statements, ", "), counter)
 	return q, params, nil
@@ -215,7 +360,7 @@ func (mdb MovieDatabase) Delete(ctx context.Context, id string) (err error) {
 		case nil:
 			err = tx.Commit(ctx)
 		default:
-			err = tx.Rollback(ctx)
+			tx.Rollback(ctx)
 		}
 	}()
 
@@ -225,28 +370,85 @@ func (mdb MovieDatabase) Delete(ctx context.Context, id string) (err error) {
 	}
 
 	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("entity with such id does not exist")
+		return ErrMovieNotFound
 	}
 
-	return nil
+	return writeEvent(ctx, tx, MovieDeleted, id, nil)
 }
 
-// ConnectDB connects to the PostgreSql database, using provided DB url.
-func ConnectDB(dbUrl string) (*pgxpool.Pool, error) {
-	config, err := pgxpool.ParseConfig(os.Getenv(dbUrl))
+// ConnectDB connects to the PostgreSql database, using provided database config.
+// Database operations are traced with the provided logger according to log settings.
+// Connectivity is verified with ping, which is retried with exponential backoff,
+// so the service can start before the database is ready.
+func ConnectDB(ctx context.Context, cfg DatabaseConfig, logger *slog.Logger) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(cfg.URL)
 	if err != nil {
-		log.Fatalf("Unable to load database config: %v\n", err)
+		return nil, fmt.Errorf("unable to parse database config: %v", err)
 	}
+	config.MaxConns = cfg.MaxConns
+	config.MinConns = cfg.MinConns
+	config.MaxConnLifetime = cfg.MaxConnLifetime
+	config.MaxConnIdleTime = cfg.MaxConnIdleTime
+	config.HealthCheckPeriod = cfg.HealthCheckPeriod
 
-	logger := log.New(os.Stdout, "SQL INFO: ", log.LstdFlags)
+	logOpts, err := cfg.LogOptions()
+	if err != nil {
+		return nil, err
+	}
 	config.ConnConfig.Tracer = &tracelog.TraceLog{
-		Logger:   NewDatabaseLogger(logger),
-		LogLevel: tracelog.LogLevelTrace,
+		Logger:   NewDatabaseLogger(logger.With(slog.String("component", "sql")), logOpts),
+		LogLevel: logOpts.Level,
 	}
 	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
 		pgxuuid.Register(conn.TypeMap())
 		pgxdecimal.Register(conn.TypeMap())
 		return nil
 	}
-	return pgxpool.NewWithConfig(context.Background(), config)
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %v", err)
+	}
+
+	err = retryWithBackoff(ctx, cfg, pool.Ping, func(attempt int, delay time.Duration, err error) {
+		logger.LogAttrs(
+			ctx,
+			slog.LevelWarn,
+			"database is not reachable",
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_in", delay),
+			slog.String("error", err.Error()),
+		)
+	})
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to reach database: %v", err)
+	}
+	return pool, nil
+}
+
+// retryWithBackoff calls fn until it succeeds or configured number of attempts is reached.
+// Delay between attempts starts at connect backoff and is doubled after every failed attempt,
+// but never exceeds connect max backoff. onRetry is called before every delay.
+func retryWithBackoff(
+	ctx context.Context,
+	cfg DatabaseConfig,
+	fn func(ctx context.Context) error,
+	onRetry func(attempt int, delay time.Duration, err error),
+) error {
+	delay := cfg.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= cfg.ConnectAttempts {
+			return err
+		}
+		onRetry(attempt, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, cfg.ConnectMaxBackoff)
+	}
 }
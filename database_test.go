@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/pashagolub/pgxmock/v3"
@@ -17,7 +20,9 @@ func TestGet(t *testing.T) {
 	mdb := NewMovieDatabase(mock)
 
 	rows := pgxmock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...)
-	mock.ExpectQuery("select *").WithArgs(id.String()).WillReturnRows(rows)
+	mock.ExpectQuery("select id, name, release_year, rating, genres, director from movie where").
+		WithArgs(id.String()).
+		WillReturnRows(rows)
 	if _, err := mdb.Get(context.Background(), id.String()); err != nil {
 		t.Errorf("error was not expected while querying: %s", err)
 	}
@@ -39,7 +44,7 @@ func TestGetAll(t *testing.T) {
 	}
 	rows.AddRows(values...)
 
-	mock.ExpectQuery("select *").WillReturnRows(rows)
+	mock.ExpectQuery("select id, name, release_year, rating, genres, director from movie").WillReturnRows(rows)
 	movies, err := mdb.GetAll(context.Background())
 	if err != nil {
 		t.Errorf("error was not expected while querying: %s", err)
@@ -54,16 +59,102 @@ func TestGetAll(t *testing.T) {
 	}
 }
 
+func TestList(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	mdb := NewMovieDatabase(mock)
+
+	rows := pgxmock.NewRows(testMovieColumn()).AddRow(testMovieRow(testUUID(t))...)
+	mock.ExpectQuery(`from movie order by id limit \$1 offset \$2`).WithArgs(10, 20).WillReturnRows(rows)
+	mock.ExpectQuery(`select count\(\*\) from movie`).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(21))
+	movies, total, err := mdb.List(context.Background(), MovieQuery{Limit: 10, Offset: 20})
+	if err != nil {
+		t.Fatalf("error was not expected while querying: %s", err)
+	}
+	if len(movies) != 1 || total != 21 {
+		t.Errorf("wrong page; expected: 1 of 21 movies, got: %d of %d", len(movies), total)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	mdb := NewMovieDatabase(mock)
+	id := testUUID(t)
+	minRating := decimal.NewFromInt(8)
+	q := MovieQuery{
+		IDs:    []string{id.String()},
+		Filter: MovieFilter{Query: "scott", MinReleaseYear: 1980, MinRating: &minRating},
+		Sort:   MovieSort{Field: SortByRating, Desc: true},
+		Limit:  10,
+	}
+
+	where := `where id = any\(\$1\) and \(strpos\(lower\(name\), lower\(\$2\)\) > 0 or ` +
+		`strpos\(lower\(director\), lower\(\$2\)\) > 0\) and release_year >= \$3 and coalesce\(rating, 0\) >= \$4`
+	rows := pgxmock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...)
+	mock.ExpectQuery(`from movie `+where+` order by coalesce\(rating, 0\) desc, id limit \$5 offset \$6`).
+		WithArgs([]uuid.UUID{id}, "scott", 1980, minRating, 10, 0).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`select count\(\*\) from movie `+where+`$`).
+		WithArgs([]uuid.UUID{id}, "scott", 1980, minRating).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+	movies, total, err := mdb.List(context.Background(), q)
+	if err != nil {
+		t.Fatalf("error was not expected while querying: %s", err)
+	}
+	if len(movies) != 1 || total != 1 {
+		t.Errorf("wrong page; expected: 1 of 1 movies, got: %d of %d", len(movies), total)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetFields(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	id := testUUID(t)
+	mdb := NewMovieDatabase(mock)
+	ctx := WithMovieFields(context.Background(), []string{"id", "name", "rating"})
+
+	rows := pgxmock.NewRows([]string{"id", "name", "rating"}).AddRow(id, "test", decimal.NewFromInt(10))
+	mock.ExpectQuery("select id, name, rating from movie where").WithArgs(id.String()).WillReturnRows(rows)
+	movie, err := mdb.Get(ctx, id.String())
+	if err != nil {
+		t.Fatalf("error was not expected while querying: %s", err)
+	}
+	if movie.Id != id || movie.Name != "test" || movie.Director != "" {
+		t.Errorf("wrong movie fields; expected: %v, test, empty director, got: %+v", id, movie)
+	}
+
+	rows = pgxmock.NewRows([]string{"id", "name", "rating"}).AddRow(id, "test", decimal.NewFromInt(10))
+	mock.ExpectQuery("select id, name, rating from movie").WillReturnRows(rows)
+	movies, err := mdb.GetAll(ctx)
+	if err != nil || len(movies) != 1 {
+		t.Fatalf("wrong movies; expected: 1 movie, got: %d, error: %v", len(movies), err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestInsert(t *testing.T) {
 	mock := testPoolMock(t)
 	defer mock.Close()
 	id := testUUID(t)
 	mdb := NewMovieDatabase(mock)
 
-	rows := mock.NewRows([]string{"id"}).AddRow(id)
+	rows := mock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...)
 	value := testMovieRow(id)[1:]
 	mock.ExpectBegin()
 	mock.ExpectQuery("insert into").WithArgs(value...).WillReturnRows(rows)
+	expectOutboxEvent(mock, MovieCreated)
 	mock.ExpectCommit()
 
 	if _, err := mdb.Insert(context.Background(), testMovie()); err != nil {
@@ -83,9 +174,10 @@ func TestUpdate(t *testing.T) {
 
 	movie := &Movie{Name: "updateTest"}
 	mock.ExpectBegin()
-	mock.ExpectExec("update movie").
+	mock.ExpectQuery("update movie").
 		WithArgs(movie.Name, id.String()).
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		WillReturnRows(mock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...))
+	expectOutboxEvent(mock, MovieUpdated)
 	mock.ExpectCommit()
 
 	if err := mdb.Update(context.Background(), id.String(), movie); err != nil {
@@ -97,6 +189,27 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestUpdateNotFound(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	id := testUUID(t)
+	mdb := NewMovieDatabase(mock)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("update movie").
+		WithArgs("updateTest", id.String()).
+		WillReturnRows(mock.NewRows(testMovieColumn()))
+	mock.ExpectRollback()
+
+	err := mdb.Update(context.Background(), id.String(), &Movie{Name: "updateTest"})
+	if !errors.Is(err, ErrMovieNotFound) {
+		t.Errorf("wrong error; expected: %v, got: %v", ErrMovieNotFound, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestBuildUpdateQuery(t *testing.T) {
 	id := testUUID(t)
 	movie := testMovie()
@@ -135,6 +248,7 @@ func TestDelete(t *testing.T) {
 	mock.ExpectExec("delete from movie").
 		WithArgs(id.String()).
 		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	expectOutboxEvent(mock, MovieDeleted)
 	mock.ExpectCommit()
 
 	if err := mdb.Delete(context.Background(), id.String()); err != nil {
@@ -146,6 +260,53 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestRetryWithBackoff(t *testing.T) {
+	cfg := DefaultConfig().Database
+	cfg.ConnectAttempts = 4
+	cfg.ConnectBackoff = time.Millisecond
+	cfg.ConnectMaxBackoff = 2 * time.Millisecond
+
+	calls := 0
+	delays := []time.Duration{}
+	err := retryWithBackoff(
+		context.Background(),
+		cfg,
+		func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return fmt.Errorf("connection refused")
+			}
+			return nil
+		},
+		func(_ int, delay time.Duration, _ error) {
+			delays = append(delays, delay)
+		},
+	)
+	if err != nil {
+		t.Errorf("error was not expected after successful attempt: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("wrong number of attempts; expected: 3, got: %d", calls)
+	}
+	if len(delays) != 2 || delays[0] != time.Millisecond || delays[1] != 2*time.Millisecond {
+		t.Errorf("wrong delays between attempts: %v", delays)
+	}
+
+	calls = 0
+	err = retryWithBackoff(
+		context.Background(),
+		cfg,
+		func(ctx context.Context) error {
+			calls++
+			return fmt.Errorf("connection refused")
+		},
+		func(int, time.Duration, error) {},
+	)
+	if err == nil || calls != cfg.ConnectAttempts {
+		t.Errorf("error was expected after %d attempts, got: %v after %d", cfg.ConnectAttempts, err, calls)
+	}
+}
+
 func testPoolMock(t *testing.T) pgxmock.PgxPoolIface {
 	mock, err := pgxmock.NewPool()
 	if err != nil {
@@ -154,6 +315,13 @@ func testPoolMock(t *testing.T) pgxmock.PgxPoolIface {
 	return mock
 }
 
+// expectOutboxEvent expects the event to be written into the outbox table.
+func expectOutboxEvent(mock pgxmock.PgxPoolIface, eventType EventType) {
+	mock.ExpectExec("insert into outbox").
+		WithArgs(pgxmock.AnyArg(), string(eventType), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
 func testUUID(t *testing.T) uuid.UUID {
 	id, err := uuid.NewV4()
 	if err != nil {
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+// movieFields are the fields of the movie in the order of its representation.
+// They are named as the columns of the movie table, so they can be selected as is.
+var movieFields = []string{"id", "name", "release_year", "rating", "genres", "director"}
+
+// parseMovieFields parses comma separated list of the requested fields, e.g. "id,name,rating".
+// Fields are returned in the order of movieFields without duplicates, so equal lists can be
+// compared. Empty list means all fields and is returned as nil.
+func parseMovieFields(param string) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+	requested := strings.Split(param, ",")
+	for i, f := range requested {
+		requested[i] = strings.TrimSpace(f)
+		if !slices.Contains(movieFields, requested[i]) {
+			return nil, fmt.Errorf("unknown movie field: %q, supported fields: %s", requested[i], strings.Join(movieFields, ", "))
+		}
+	}
+	fields := []string{}
+	for _, f := range movieFields {
+		if slices.Contains(requested, f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// PartialMovie is the movie with only the requested fields, the other fields are omitted
+// from its representation.
+type PartialMovie struct {
+	XMLName     xml.Name         `json:"-" xml:"movie"`
+	Id          *uuid.UUID       `json:"id,omitempty" xml:"id,omitempty"`
+	Name        *string          `json:"name,omitempty" xml:"name,omitempty"`
+	ReleaseYear *int             `json:"release_year,omitempty" xml:"release_year,omitempty"`
+	Rating      *decimal.Decimal `json:"rating,omitempty" xml:"rating,omitempty"`
+	Genres      *[]string        `json:"genres,omitempty" xml:"genres>genre,omitempty"`
+	Director    *string          `json:"director,omitempty" xml:"director,omitempty"`
+}
+
+// NewPartialMovie copies provided fields of the movie into PartialMovie.
+func NewPartialMovie(m Movie, fields []string) PartialMovie {
+	p := PartialMovie{}
+	for _, f := range fields {
+		switch f {
+		case "id":
+			p.Id = &m.Id
+		case "name":
+			p.Name = &m.Name
+		case "release_year":
+			p.ReleaseYear = &m.ReleaseYear
+		case "rating":
+			p.Rating = &m.Rating
+		case "genres":
+			p.Genres = &m.Genres
+		case "director":
+			p.Director = &m.Director
+		}
+	}
+	return p
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMovieFields(t *testing.T) {
+	tests := []struct {
+		param  string
+		fields []string
+		err    bool
+	}{
+		{"", nil, false},
+		{"id,name,rating", []string{"id", "name", "rating"}, false},
+		{"rating, id,name,id", []string{"id", "name", "rating"}, false},
+		{"id,title", nil, true},
+		{"id,", nil, true},
+	}
+	for _, tt := range tests {
+		fields, err := parseMovieFields(tt.param)
+		if (err != nil) != tt.err || !slices.Equal(fields, tt.fields) {
+			t.Errorf("wrong fields of %q; expected: %v, error: %v, got: %v, error: %v", tt.param, tt.fields, tt.err, fields, err)
+		}
+	}
+}
+
+func TestMovieFields(t *testing.T) {
+	svc := NewMovieService(NewMemoryDatabase())
+	id, err := svc.CreateMovie(context.Background(), testMovie())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(svc).Handler()
+
+	for _, path := range []string{"/v1/movies/" + id, "/v1/movies"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?fields=id,name,rating", nil))
+		body := strings.TrimSpace(w.Body.String())
+		if !strings.HasPrefix(body, "[") {
+			body = "[" + body + "]"
+		}
+		movies := []map[string]any{}
+		if err := json.Unmarshal([]byte(body), &movies); err != nil || len(movies) != 1 {
+			t.Fatalf("%s: error decoding movies: %v, body: %s", path, err, body)
+		}
+		expected := map[string]any{"id": id, "name": "test", "rating": "10"}
+		if len(movies[0]) != len(expected) {
+			t.Errorf("%s: wrong fields; expected: %v, got: %v", path, expected, movies[0])
+		}
+		for k, v := range expected {
+			if movies[0][k] != v {
+				t.Errorf("%s: wrong %s; expected: %v, got: %v", path, k, v, movies[0][k])
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies?fields=name,genres", nil)
+	r.Header.Set("Accept", "application/xml")
+	h.ServeHTTP(w, r)
+	expected := "<movies><movie><name>test</name><genres><genre>test</genre></genres></movie></movies>"
+	if body := w.Body.String(); !strings.HasSuffix(body, expected) {
+		t.Errorf("wrong XML body; expected: %s, got: %s", expected, body)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/movies/"+id+"?fields=title", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("wrong status of unknown field; expected: %d, got: %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// graphQLPageSize is the number of movies returned by movies query without page limit,
+	// unless maximum page size is lower.
+	graphQLPageSize = 20
+	// graphQLListEstimate is the number of items, lists without page are expected to contain,
+	// when complexity of the query is calculated.
+	graphQLListEstimate = 10
+)
+
+// GraphQLOptions describes the limits of GraphQL queries.
+type GraphQLOptions struct {
+	// MaxComplexity limits the number of fields, that can be resolved by the query.
+	// Fields of lists are counted once for every expected item.
+	MaxComplexity int
+	// MaxDepth limits nesting of the fields.
+	MaxDepth int
+	// MaxPageSize limits page limit of movies query.
+	MaxPageSize int
+}
+
+// GraphQL serves GraphQL queries and mutations on top of the Service.
+// Movies requested by id or by director are loaded by the per request movieLoader,
+// so nested fields of the same level result in a single call to the Service.
+type GraphQL struct {
+	schema graphql.Schema
+	svc    Service
+	opts   GraphQLOptions
+}
+
+// graphQLRequest is a body of the GraphQL request.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// NewGraphQL creates an instance of the GraphQL with the movie schema.
+func NewGraphQL(svc Service, opts GraphQLOptions) (*GraphQL, error) {
+	g := &GraphQL{
+		svc:  svc,
+		opts: opts,
+	}
+	schema, err := g.newSchema()
+	if err != nil {
+		return nil, fmt.Errorf("error creating GraphQL schema: %v", err)
+	}
+	g.schema = schema
+	return g, nil
+}
+
+// ServeHTTP executes the query from JSON body of POST request, or from query parameters
+// of GET request. Mutations are executed only for POST requests.
+func (g *GraphQL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := graphQLRequest{}
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	validation := graphql.ValidateDocument(&g.schema, doc, nil)
+	if !validation.IsValid {
+		writeJson(w, http.StatusBadRequest, &graphql.Result{Errors: validation.Errors})
+		return
+	}
+
+	op := operation(doc, req.OperationName)
+	if op == nil {
+		writeGraphQLError(w, http.StatusBadRequest, "operation is not found")
+		return
+	}
+	if r.Method == http.MethodGet && op.Operation != ast.OperationTypeQuery {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGraphQLError(w, http.StatusMethodNotAllowed, "only queries are allowed with GET method")
+		return
+	}
+	c := complexityCounter{fragments: fragments(doc), variables: req.Variables, pageSize: g.pageSize()}
+	complexity, depth := c.selectionSet(op.SelectionSet, 1)
+	if depth > g.opts.MaxDepth {
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf(
+			"query depth %d exceeds limit %d", depth, g.opts.MaxDepth,
+		))
+		return
+	}
+	if complexity > g.opts.MaxComplexity {
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf(
+			"query complexity %d exceeds limit %d", complexity, g.opts.MaxComplexity,
+		))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), movieLoaderKey{}, newMovieLoader(g.svc))
+	res := graphql.Execute(graphql.ExecuteParams{
+		Schema:        g.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+	writeJson(w, http.StatusOK, res)
+}
+
+// pageSize returns the number of movies returned by movies query without page limit.
+func (g *GraphQL) pageSize() int {
+	return min(graphQLPageSize, g.opts.MaxPageSize)
+}
+
+// writeGraphQLError writes response with the single error.
+func writeGraphQLError(w http.ResponseWriter, s int, message string) {
+	writeJson(w, s, &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: message}}})
+}
+
+// operation returns the operation with provided name, or the only operation of the document.
+func operation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" && found != nil {
+			return nil
+		}
+		if name == "" || (op.Name != nil && op.Name.Value == name) {
+			found = op
+		}
+	}
+	return found
+}
+
+func fragments(doc *ast.Document) map[string]*ast.FragmentDefinition {
+	res := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			res[f.Name.Value] = f
+		}
+	}
+	return res
+}
+
+// complexityCounter calculates complexity and depth of the validated query.
+type complexityCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	pageSize  int
+}
+
+// selectionSet returns the number of fields resolved for the selection set at provided depth,
+// and the maximum depth of its fields.
+func (c complexityCounter) selectionSet(set *ast.SelectionSet, depth int) (int, int) {
+	if set == nil {
+		return 0, depth - 1
+	}
+	complexity, maxDepth := 0, depth
+	add := func(cost, d int) {
+		complexity += cost
+		maxDepth = max(maxDepth, d)
+	}
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			cost, d := c.selectionSet(sel.SelectionSet, depth+1)
+			add(1+c.multiplier(sel)*cost, d)
+		case *ast.InlineFragment:
+			add(c.selectionSet(sel.SelectionSet, depth))
+		case *ast.FragmentSpread:
+			if f, ok := c.fragments[sel.Name.Value]; ok {
+				add(c.selectionSet(f.SelectionSet, depth))
+			}
+		}
+	}
+	return complexity, maxDepth
+}
+
+// multiplier returns the expected number of items of the field: page limit for paged lists,
+// estimate for the other movie lists and one for the rest of the fields.
+func (c complexityCounter) multiplier(f *ast.Field) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "page" {
+			continue
+		}
+		page, _ := valueFromAST(arg.Value, c.variables).(map[string]any)
+		if limit, ok := page["limit"].(int); ok {
+			return limit
+		}
+		if limit, ok := page["limit"].(float64); ok {
+			return int(limit)
+		}
+		return c.pageSize
+	}
+	if f.Name.Value == "movies" {
+		return graphQLListEstimate
+	}
+	return 1
+}
+
+// valueFromAST converts literal value into Go value, variables are taken from provided map.
+func valueFromAST(v ast.Value, variables map[string]any) any {
+	switch v := v.(type) {
+	case *ast.Variable:
+		return variables[v.Name.Value]
+	case *ast.IntValue:
+		var n int
+		fmt.Sscan(v.Value, &n)
+		return n
+	case *ast.ObjectValue:
+		res := map[string]any{}
+		for _, f := range v.Fields {
+			res[f.Name.Value] = valueFromAST(f.Value, variables)
+		}
+		return res
+	}
+	return nil
+}
+
+// movieLoaderKey is used to store movieLoader in the request context.
+type movieLoaderKey struct{}
+
+// movieLoader batches loading of movies during execution of a single request.
+// Movies requested by id or by director are collected, until the first of them is resolved,
+// and loaded with a single call: GetMovie for one id, ListMovies for several ids or directors.
+type movieLoader struct {
+	svc              Service
+	pending          map[string]struct{}
+	loaded           map[string]*Movie
+	pendingDirectors map[string]struct{}
+	directors        map[string][]Movie
+}
+
+func newMovieLoader(svc Service) *movieLoader {
+	return &movieLoader{
+		svc:              svc,
+		pending:          map[string]struct{}{},
+		loaded:           map[string]*Movie{},
+		pendingDirectors: map[string]struct{}{},
+		directors:        map[string][]Movie{},
+	}
+}
+
+// loaderFromContext returns loader of the request.
+func loaderFromContext(ctx context.Context) *movieLoader {
+	return ctx.Value(movieLoaderKey{}).(*movieLoader)
+}
+
+// movie returns thunk resolving movie by id, nil if it does not exist.
+func (l *movieLoader) movie(ctx context.Context, id string) func() (any, error) {
+	movieId, err := parseMovieId(id)
+	if err != nil {
+		return func() (any, error) { return nil, err }
+	}
+	// Ids are normalized, so different spellings of the same UUID share the movie.
+	id = movieId.String()
+	if _, ok := l.loaded[id]; !ok {
+		l.pending[id] = struct{}{}
+	}
+	return func() (any, error) {
+		if err := l.flush(ctx); err != nil {
+			return nil, err
+		}
+		if m := l.loaded[id]; m != nil {
+			return m, nil
+		}
+		return nil, nil
+	}
+}
+
+// flush loads pending movies.
+func (l *movieLoader) flush(ctx context.Context) error {
+	switch len(l.pending) {
+	case 0:
+		return nil
+	case 1:
+		for id := range l.pending {
+			delete(l.pending, id)
+			m, err := l.svc.GetMovie(ctx, id)
+			if err != nil && !errors.Is(err, ErrMovieNotFound) {
+				return err
+			}
+			l.loaded[id] = m
+		}
+		return nil
+	}
+
+	ids := make([]string, 0, len(l.pending))
+	for id := range l.pending {
+		ids = append(ids, id)
+	}
+	clear(l.pending)
+	movies, _, err := l.svc.ListMovies(ctx, MovieQuery{IDs: ids})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		l.loaded[id] = nil
+	}
+	for i := range movies {
+		l.loaded[movies[i].Id.String()] = &movies[i]
+	}
+	return nil
+}
+
+// directorMovies returns thunk resolving all movies of the director.
+func (l *movieLoader) directorMovies(ctx context.Context, director string) func() (any, error) {
+	if _, ok := l.directors[director]; !ok {
+		l.pendingDirectors[director] = struct{}{}
+	}
+	return func() (any, error) {
+		if err := l.flushDirectors(ctx); err != nil {
+			return nil, err
+		}
+		return l.directors[director], nil
+	}
+}
+
+// flushDirectors loads movies of pending directors.
+func (l *movieLoader) flushDirectors(ctx context.Context) error {
+	if len(l.pendingDirectors) == 0 {
+		return nil
+	}
+	directors := make([]string, 0, len(l.pendingDirectors))
+	for d := range l.pendingDirectors {
+		directors = append(directors, d)
+	}
+	clear(l.pendingDirectors)
+	movies, _, err := l.svc.ListMovies(ctx, MovieQuery{Directors: directors})
+	if err != nil {
+		return err
+	}
+	for _, d := range directors {
+		l.directors[d] = []Movie{}
+	}
+	for _, m := range movies {
+		l.directors[m.Director] = append(l.directors[m.Director], m)
+	}
+	return nil
+}
+
+// reset drops loaded movies, it is called after mutations.
+func (l *movieLoader) reset() {
+	clear(l.loaded)
+	clear(l.directors)
+}
+
+// director is a value of the Director type.
+type director struct {
+	name string
+}
+
+// moviePage is a value of the MoviePage type.
+type moviePage struct {
+	items []Movie
+	total int
+}
+
+// newSchema creates the following schema:
+//
+//	type Movie { id: ID!, name: String!, releaseYear: Int!, rating: Float!, genres: [String!]!, director: Director! }
+//	type Director { name: String!, movies: [Movie!]! }
+//	type MoviePage { items: [Movie!]!, total: Int! }
+//	type Query {
+//	  movie(id: ID!): Movie
+//	  movies(filter: MovieFilter, sort: MovieSort, page: Page): MoviePage!
+//	}
+//	type Mutation {
+//	  createMovie(input: MovieInput!): Movie!
+//	  updateMovie(id: ID!, input: MovieUpdateInput!): Movie!
+//	  deleteMovie(id: ID!): Boolean!
+//	}
+func (g *GraphQL) newSchema() (graphql.Schema, error) {
+	var movieType *graphql.Object
+	directorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Director",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(director).name, nil
+					},
+				},
+				"movies": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(movieType))),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return loaderFromContext(p.Context).directorMovies(p.Context, p.Source.(director).name), nil
+					},
+				},
+			}
+		}),
+	})
+	movieType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Movie",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.ID),
+				Resolve: movieField(func(m *Movie) any { return m.Id.String() }),
+			},
+			"name": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.String),
+				Resolve: movieField(func(m *Movie) any { return m.Name }),
+			},
+			"releaseYear": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: movieField(func(m *Movie) any { return m.ReleaseYear }),
+			},
+			"rating": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Float),
+				Resolve: movieField(func(m *Movie) any { return m.Rating.InexactFloat64() }),
+			},
+			"genres": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Resolve: movieField(func(m *Movie) any { return m.Genres }),
+			},
+			"director": &graphql.Field{
+				Type:    graphql.NewNonNull(directorType),
+				Resolve: movieField(func(m *Movie) any { return director{name: m.Director} }),
+			},
+		},
+	})
+	pageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "MoviePage",
+		Fields: graphql.Fields{
+			"items": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(movieType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(moviePage).items, nil
+				},
+			},
+			"total": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(moviePage).total, nil
+				},
+			},
+		},
+	})
+
+	filterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "MovieFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"query":          &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "matched against name and director"},
+			"genre":          &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"minReleaseYear": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"maxReleaseYear": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"minRating":      &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		},
+	})
+	sortType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "MovieSort",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.NewEnum(graphql.EnumConfig{
+				Name: "MovieSortField",
+				Values: graphql.EnumValueConfigMap{
+					"NAME":         &graphql.EnumValueConfig{Value: SortByName},
+					"RELEASE_YEAR": &graphql.EnumValueConfig{Value: SortByReleaseYear},
+					"RATING":       &graphql.EnumValueConfig{Value: SortByRating},
+				},
+			}))},
+			"desc": &graphql.InputObjectFieldConfig{Type: graphql.Boolean, DefaultValue: false},
+		},
+	})
+	pageInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "Page",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"limit":  &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"offset": &graphql.InputObjectFieldConfig{Type: graphql.Int, DefaultValue: 0},
+		},
+	})
+	movieInputFields := func(required bool) graphql.InputObjectConfigFieldMap {
+		nonNull := func(t graphql.Input) graphql.Input {
+			if required {
+				return graphql.NewNonNull(t)
+			}
+			return t
+		}
+		return graphql.InputObjectConfigFieldMap{
+			"name":        &graphql.InputObjectFieldConfig{Type: nonNull(graphql.String)},
+			"releaseYear": &graphql.InputObjectFieldConfig{Type: nonNull(graphql.Int)},
+			"rating":      &graphql.InputObjectFieldConfig{Type: nonNull(graphql.Float)},
+			"genres":      &graphql.InputObjectFieldConfig{Type: nonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))},
+			"director":    &graphql.InputObjectFieldConfig{Type: nonNull(graphql.String)},
+		}
+	}
+	movieInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   "MovieInput",
+		Fields: movieInputFields(true),
+	})
+	movieUpdateInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "MovieUpdateInput",
+		Description: "Not provided fields are not updated, empty genres remove all genres.",
+		Fields:      movieInputFields(false),
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"movie": &graphql.Field{
+				Type: movieType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return loaderFromContext(p.Context).movie(p.Context, p.Args["id"].(string)), nil
+				},
+			},
+			"movies": &graphql.Field{
+				Type: graphql.NewNonNull(pageType),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: filterType},
+					"sort":   &graphql.ArgumentConfig{Type: sortType},
+					"page":   &graphql.ArgumentConfig{Type: pageInputType},
+				},
+				Resolve: g.resolveMovies,
+			},
+		},
+	})
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createMovie": &graphql.Field{
+				Type: graphql.NewNonNull(movieType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(movieInputType)},
+				},
+				Resolve: g.resolveCreateMovie,
+			},
+			"updateMovie": &graphql.Field{
+				Type: graphql.NewNonNull(movieType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(movieUpdateInputType)},
+				},
+				Resolve: g.resolveUpdateMovie,
+			},
+			"deleteMovie": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					err := g.svc.DeleteMovie(p.Context, p.Args["id"].(string))
+					if err != nil {
+						return nil, err
+					}
+					loaderFromContext(p.Context).reset()
+					return true, nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+// movieField returns resolver of the Movie field, source is either Movie or pointer to it.
+func movieField(field func(m *Movie) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		switch m := p.Source.(type) {
+		case *Movie:
+			return field(m), nil
+		case Movie:
+			return field(&m), nil
+		}
+		return nil, nil
+	}
+}
+
+// resolveMovies fetches the page of movies, filtered and sorted by the Service.
+func (g *GraphQL) resolveMovies(p graphql.ResolveParams) (any, error) {
+	q := MovieQuery{}
+	if f, ok := p.Args["filter"].(map[string]any); ok {
+		q.Filter.Query, _ = f["query"].(string)
+		q.Filter.Genre, _ = f["genre"].(string)
+		q.Filter.MinReleaseYear, _ = f["minReleaseYear"].(int)
+		q.Filter.MaxReleaseYear, _ = f["maxReleaseYear"].(int)
+		if r, ok := f["minRating"].(float64); ok {
+			d := decimal.NewFromFloat(r)
+			q.Filter.MinRating = &d
+		}
+	}
+	if s, ok := p.Args["sort"].(map[string]any); ok {
+		q.Sort.Field, _ = s["field"].(string)
+		q.Sort.Desc, _ = s["desc"].(bool)
+	}
+
+	limit, offset := g.pageSize(), 0
+	if pg, ok := p.Args["page"].(map[string]any); ok {
+		if l, ok := pg["limit"].(int); ok {
+			limit = l
+		}
+		offset, _ = pg["offset"].(int)
+	}
+	if limit < 0 || limit > g.opts.MaxPageSize || offset < 0 {
+		return nil, fmt.Errorf("page limit must be between 0 and %d, offset must not be negative", g.opts.MaxPageSize)
+	}
+	// Zero limit of the query returns all movies, while only the total is needed here.
+	q.Limit, q.Offset = max(limit, 1), offset
+
+	movies, total, err := g.svc.ListMovies(p.Context, q)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		movies = []Movie{}
+	}
+	return moviePage{items: movies, total: total}, nil
+}
+
+// movieFromInput converts MovieInput or MovieUpdateInput into Movie, not provided fields are empty.
+func movieFromInput(input map[string]any) *Movie {
+	m := &Movie{}
+	m.Name, _ = input["name"].(string)
+	m.ReleaseYear, _ = input["releaseYear"].(int)
+	m.Director, _ = input["director"].(string)
+	if r, ok := input["rating"].(float64); ok {
+		m.Rating = decimal.NewFromFloat(r)
+	}
+	if genres, ok := input["genres"].([]any); ok {
+		m.Genres = []string{}
+		for _, g := range genres {
+			m.Genres = append(m.Genres, g.(string))
+		}
+	}
+	return m
+}
+
+func (g *GraphQL) resolveCreateMovie(p graphql.ResolveParams) (any, error) {
+	id, err := g.svc.CreateMovie(p.Context, movieFromInput(p.Args["input"].(map[string]any)))
+	if err != nil {
+		return nil, err
+	}
+	loaderFromContext(p.Context).reset()
+	return g.svc.GetMovie(p.Context, id)
+}
+
+func (g *GraphQL) resolveUpdateMovie(p graphql.ResolveParams) (any, error) {
+	id := p.Args["id"].(string)
+	err := g.svc.UpdateMovie(p.Context, id, movieFromInput(p.Args["input"].(map[string]any)))
+	if err != nil {
+		return nil, err
+	}
+	loaderFromContext(p.Context).reset()
+	return g.svc.GetMovie(p.Context, id)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// graphQLResponse is a decoded response of the GraphQL endpoint.
+type graphQLResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// doGraphQL posts the query with variables to the handler.
+func doGraphQL(t *testing.T, h http.Handler, query string, variables map[string]any) (int, graphQLResponse) {
+	body, _ := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)))
+	res := graphQLResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	return w.Code, res
+}
+
+func testGraphQLOptions() GraphQLOptions {
+	return GraphQLOptions{MaxComplexity: 200, MaxDepth: 5, MaxPageSize: 10}
+}
+
+func TestGraphQLMutationsAndQueries(t *testing.T) {
+	svc := newCountingService()
+	g, err := NewGraphQL(svc, testGraphQLOptions())
+	if err != nil {
+		t.Fatalf("error creating schema: %v", err)
+	}
+	h := NewServer(svc).WithGraphQL(g).Handler()
+
+	create := `mutation($input: MovieInput!) { createMovie(input: $input) { id name rating } }`
+	ids := []string{}
+	for _, m := range []map[string]any{
+		{"name": "Alien", "releaseYear": 1979, "rating": 8.5, "genres": []string{"Horror"}, "director": "Ridley Scott"},
+		{"name": "Gladiator", "releaseYear": 2000, "rating": 8.5, "genres": []string{"Action"}, "director": "Ridley Scott"},
+		{"name": "Heat", "releaseYear": 1995, "rating": 8.3, "genres": []string{}, "director": "Michael Mann"},
+	} {
+		code, res := doGraphQL(t, h, create, map[string]any{"input": m})
+		if code != http.StatusOK || len(res.Errors) > 0 {
+			t.Fatalf("error creating movie; status: %d, errors: %v", code, res.Errors)
+		}
+		created := res.Data["createMovie"].(map[string]any)
+		if created["name"] != m["name"] || created["rating"] != m["rating"] {
+			t.Errorf("wrong created movie; expected: %v, got: %v", m, created)
+		}
+		ids = append(ids, created["id"].(string))
+	}
+
+	update := `mutation { updateMovie(id: "` + ids[2] + `", input: {rating: 8.4}) { name rating } }`
+	_, res := doGraphQL(t, h, update, nil)
+	if updated, _ := res.Data["updateMovie"].(map[string]any); updated["name"] != "Heat" || updated["rating"] != 8.4 {
+		t.Errorf("wrong updated movie; got: %v, errors: %v", res.Data, res.Errors)
+	}
+
+	query := `{
+		movies(filter: {query: "scott"}, sort: {field: RELEASE_YEAR, desc: true}, page: {limit: 1}) {
+			total
+			items { name }
+		}
+	}`
+	_, res = doGraphQL(t, h, query, nil)
+	page := res.Data["movies"].(map[string]any)
+	items := page["items"].([]any)
+	if page["total"] != float64(2) || len(items) != 1 || items[0].(map[string]any)["name"] != "Gladiator" {
+		t.Errorf("wrong page of movies; got: %v", page)
+	}
+
+	missing := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	_, res = doGraphQL(t, h, `{ movie(id: "`+missing+`") { name } }`, nil)
+	if res.Data["movie"] != nil || len(res.Errors) > 0 {
+		t.Errorf("null movie was expected for missing id; got: %v, errors: %v", res.Data, res.Errors)
+	}
+
+	_, res = doGraphQL(t, h, `mutation { deleteMovie(id: "`+ids[0]+`") }`, nil)
+	if res.Data["deleteMovie"] != true {
+		t.Errorf("movie was not deleted; got: %v, errors: %v", res.Data, res.Errors)
+	}
+}
+
+func TestGraphQLBatchedLoading(t *testing.T) {
+	ctx := context.Background()
+	svc := newCountingService()
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		id, _ := svc.CreateMovie(ctx, testMovie())
+		ids = append(ids, id)
+	}
+	g, _ := NewGraphQL(svc, testGraphQLOptions())
+	h := NewServer(svc).WithGraphQL(g).Handler()
+
+	// Several movies, the page of movies and nested movies of their directors are loaded
+	// with a single call each.
+	query := `{
+		a: movie(id: "` + ids[0] + `") { name director { movies { id } } }
+		b: movie(id: "` + ids[1] + `") { name director { movies { id } } }
+		movies { items { director { name movies { id } } } }
+	}`
+	_, res := doGraphQL(t, h, query, nil)
+	if len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", res.Errors)
+	}
+	a := res.Data["a"].(map[string]any)
+	if movies := a["director"].(map[string]any)["movies"].([]any); len(movies) != 3 {
+		t.Errorf("wrong number of director movies; expected: 3, got: %d", len(movies))
+	}
+	if gets, lists := svc.gets.Load(), svc.lists.Load(); gets != 0 || lists != 3 {
+		t.Errorf("wrong number of service calls; expected: 0 gets and 3 lists, got: %d gets and %d lists", gets, lists)
+	}
+
+	// Single movie is loaded by id.
+	doGraphQL(t, h, `{ movie(id: "`+ids[2]+`") { name } }`, nil)
+	if gets, lists := svc.gets.Load(), svc.lists.Load(); gets != 1 || lists != 3 {
+		t.Errorf("wrong number of service calls; expected: 1 get and 3 lists, got: %d gets and %d lists", gets, lists)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	g, _ := NewGraphQL(newCountingService(), testGraphQLOptions())
+	h := NewServer(nil).WithGraphQL(g).Handler()
+
+	tests := []struct {
+		name    string
+		query   string
+		status  int
+		message string
+	}{
+		{"complexity", `{ movies(page: {limit: 10}) { items { director { movies { name genres } } } } }`, http.StatusBadRequest, "complexity"},
+		{"complexity from variables", `query($p: Page) { movies(page: $p) { items { name genres director { name } } } }`, http.StatusBadRequest, "complexity"},
+		{"depth", `{ movies { items { director { movies { director { movies { name } } } } } } }`, http.StatusBadRequest, "depth"},
+		{"invalid", `{ movies { unknown } }`, http.StatusBadRequest, "unknown"},
+		{"page size", `{ movies(page: {limit: 11}) { total } }`, http.StatusOK, "page limit"},
+	}
+	for _, tt := range tests {
+		variables := map[string]any{"p": map[string]any{"limit": 100}}
+		code, res := doGraphQL(t, h, tt.query, variables)
+		if code != tt.status || len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, tt.message) {
+			t.Errorf("%s: wrong response; expected: %d with %q error, got: %d with %v", tt.name, tt.status, tt.message, code, res.Errors)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	q := url.QueryEscape(`mutation { deleteMovie(id: "6ba7b810-9dad-11d1-80b4-00c04fd430c8") }`)
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/graphql?query="+q, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong status of mutation with GET; expected: %d, got: %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
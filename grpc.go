@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	moviev1 "github.com/Alieksieiev0/movie-microservice/proto/movie/v1"
+)
+
+//go:generate protoc -I proto --go_out=proto --go_opt=paths=source_relative --go-grpc_out=proto --go-grpc_opt=paths=source_relative movie/v1/movie.proto
+
+// watchReplayBatch is the number of events fetched at once, when Watch replays missed events.
+const watchReplayBatch = 500
+
+// GRPCServer implements movie.v1.MovieService on top of the Service,
+// so all its decorators are applied to gRPC calls as well.
+type GRPCServer struct {
+	moviev1.UnimplementedMovieServiceServer
+	// Supplied service is used to perform the appropriate operation for each call.
+	svc Service
+	// Broker and log are used by Watch, which is supported only if they are provided.
+	broker *EventBroker
+	log    EventLog
+}
+
+// NewGRPCServer creates an instance of the GRPCServer.
+func NewGRPCServer(svc Service) GRPCServer {
+	return GRPCServer{
+		svc: svc,
+	}
+}
+
+// WithWatch returns a copy of the GRPCServer, that streams events published to the broker,
+// replaying missed ones from the log.
+func (s GRPCServer) WithWatch(broker *EventBroker, log EventLog) GRPCServer {
+	s.broker = broker
+	s.log = log
+	return s
+}
+
+// Start registers the service and serves gRPC requests on the provided address.
+// When ctx is done, the server stops accepting calls and waits for active ones
+// up to the shutdown timeout, after which they are canceled.
+func (s GRPCServer) Start(ctx context.Context, addr string, shutdownTimeout time.Duration) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	moviev1.RegisterMovieServiceServer(srv, s)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(lis)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(shutdownTimeout):
+		srv.Stop()
+		return fmt.Errorf("error shutting down server: %w", context.DeadlineExceeded)
+	}
+}
+
+func (s GRPCServer) GetMovie(ctx context.Context, req *moviev1.GetMovieRequest) (*moviev1.GetMovieResponse, error) {
+	if err := validateMovieId(req.Id); err != nil {
+		return nil, err
+	}
+	movie, err := s.svc.GetMovie(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &moviev1.GetMovieResponse{Movie: movieToProto(movie)}, nil
+}
+
+func (s GRPCServer) ListMovies(ctx context.Context, req *moviev1.ListMoviesRequest) (*moviev1.ListMoviesResponse, error) {
+	limit, offset, err := pageFromProto(req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	movies, total, err := s.svc.ListMovies(ctx, MovieQuery{Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &moviev1.ListMoviesResponse{Movies: moviesToProto(movies), Total: int32(total)}, nil
+}
+
+func (s GRPCServer) CreateMovie(ctx context.Context, req *moviev1.CreateMovieRequest) (*moviev1.CreateMovieResponse, error) {
+	if req.Movie == nil {
+		return nil, status.Error(codes.InvalidArgument, "movie must be provided")
+	}
+	rating, err := parseRating(req.Movie.Rating)
+	if err != nil {
+		return nil, err
+	}
+	movie := &Movie{
+		Name:        req.Movie.Name,
+		ReleaseYear: int(req.Movie.ReleaseYear),
+		Rating:      rating,
+		Genres:      append([]string{}, req.Movie.Genres...),
+		Director:    req.Movie.Director,
+	}
+
+	id, err := s.svc.CreateMovie(ctx, movie)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &moviev1.CreateMovieResponse{Id: id}, nil
+}
+
+func (s GRPCServer) UpdateMovie(ctx context.Context, req *moviev1.UpdateMovieRequest) (*moviev1.UpdateMovieResponse, error) {
+	if err := validateMovieId(req.Id); err != nil {
+		return nil, err
+	}
+	rating, err := parseRating(req.Rating)
+	if err != nil {
+		return nil, err
+	}
+	movie := &Movie{
+		Name:        req.Name,
+		ReleaseYear: int(req.ReleaseYear),
+		Rating:      rating,
+		Director:    req.Director,
+	}
+	if req.Genres != nil {
+		movie.Genres = append([]string{}, req.Genres.Genres...)
+	}
+
+	err = s.svc.UpdateMovie(ctx, req.Id, movie)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &moviev1.UpdateMovieResponse{}, nil
+}
+
+func (s GRPCServer) DeleteMovie(ctx context.Context, req *moviev1.DeleteMovieRequest) (*moviev1.DeleteMovieResponse, error) {
+	if err := validateMovieId(req.Id); err != nil {
+		return nil, err
+	}
+	err := s.svc.DeleteMovie(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &moviev1.DeleteMovieResponse{}, nil
+}
+
+func (s GRPCServer) SearchMovies(ctx context.Context, req *moviev1.SearchMoviesRequest) (*moviev1.SearchMoviesResponse, error) {
+	limit, offset, err := pageFromProto(req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	filter := MovieFilter{
+		Query:          req.Query,
+		Genre:          req.Genre,
+		MinReleaseYear: int(req.MinReleaseYear),
+		MaxReleaseYear: int(req.MaxReleaseYear),
+	}
+	if req.MinRating != "" {
+		minRating, err := parseRating(req.MinRating)
+		if err != nil {
+			return nil, err
+		}
+		filter.MinRating = &minRating
+	}
+	movies, total, err := s.svc.ListMovies(ctx, MovieQuery{Filter: filter, Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &moviev1.SearchMoviesResponse{Movies: moviesToProto(movies), Total: int32(total)}, nil
+}
+
+// Watch streams events of the requested topics. Events after AfterEventId are replayed first,
+// so the client resumes the stream with the id of the last received event. Client, that does
+// not keep up with the events, receives ResourceExhausted error and should resume the stream.
+func (s GRPCServer) Watch(req *moviev1.WatchRequest, stream grpc.ServerStreamingServer[moviev1.WatchResponse]) error {
+	if s.broker == nil {
+		return status.Error(codes.Unimplemented, "watch is not supported by the store")
+	}
+	if len(req.Topics) == 0 {
+		return status.Error(codes.InvalidArgument, "topics must not be empty")
+	}
+	topics := map[string]struct{}{}
+	for _, t := range req.Topics {
+		topic, err := parseTopic(t)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		topics[topic] = struct{}{}
+	}
+
+	// Subscription is created before replay, so events published during it are not missed.
+	sub := s.broker.Subscribe()
+	defer s.broker.Unsubscribe(sub)
+
+	last := req.AfterEventId
+	send := func(ev Event) error {
+		last = ev.ID
+		if !matchesTopics(ev, topics) {
+			return nil
+		}
+		return stream.Send(eventToProto(ev))
+	}
+
+	ctx := stream.Context()
+	for last > 0 {
+		events, err := s.log.EventsAfter(ctx, last, watchReplayBatch)
+		if err != nil {
+			return grpcError(err)
+		}
+		for _, ev := range events {
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+		if len(events) < watchReplayBatch {
+			break
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return grpcError(ctx.Err())
+		case <-sub.Dropped:
+			return status.Error(codes.ResourceExhausted, "client does not keep up with events")
+		case ev := <-sub.Events:
+			if ev.ID <= last {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcError converts error returned by the Service into gRPC status error.
+func grpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrMovieNotFound):
+		code = codes.NotFound
+	case errors.Is(err, ErrNothingToUpdate):
+		code = codes.InvalidArgument
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
+
+// validateMovieId returns InvalidArgument error, if id is not UUID.
+func validateMovieId(id string) error {
+	if _, err := uuid.FromString(id); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid movie id: %q", id)
+	}
+	return nil
+}
+
+// pageFromProto applies the same rules to limit and offset as parsePage, zero limit means the default one.
+func pageFromProto(limit, offset int32) (int, int, error) {
+	if limit == 0 {
+		limit = 100
+	}
+	if limit < 0 || limit > 1000 {
+		return 0, 0, status.Error(codes.InvalidArgument, "limit must be between 1 and 1000")
+	}
+	if offset < 0 {
+		return 0, 0, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+	return int(limit), int(offset), nil
+}
+
+// parseRating converts rating into decimal, empty rating is zero.
+func parseRating(rating string) (decimal.Decimal, error) {
+	if rating == "" {
+		return decimal.Decimal{}, nil
+	}
+	d, err := decimal.NewFromString(rating)
+	if err != nil {
+		return decimal.Decimal{}, status.Errorf(codes.InvalidArgument, "invalid rating: %q", rating)
+	}
+	return d, nil
+}
+
+// matchesTopics reports, whether any of the event topics is in the topics set.
+func matchesTopics(event Event, topics map[string]struct{}) bool {
+	for _, t := range eventTopics(event) {
+		if _, ok := topics[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func movieToProto(m *Movie) *moviev1.Movie {
+	return &moviev1.Movie{
+		Id:          m.Id.String(),
+		Name:        m.Name,
+		ReleaseYear: int32(m.ReleaseYear),
+		Rating:      m.Rating.StringFixed(ratingScale),
+		Genres:      m.Genres,
+		Director:    m.Director,
+	}
+}
+
+func moviesToProto(movies []Movie) []*moviev1.Movie {
+	res := make([]*moviev1.Movie, len(movies))
+	for i := range movies {
+		res[i] = movieToProto(&movies[i])
+	}
+	return res
+}
+
+func eventToProto(event Event) *moviev1.WatchResponse {
+	res := &moviev1.WatchResponse{
+		EventId:    event.ID,
+		MovieId:    event.MovieID.String(),
+		OccurredAt: timestamppb.New(event.OccurredAt),
+	}
+	switch event.Type {
+	case MovieCreated:
+		res.Type = moviev1.EventType_EVENT_TYPE_MOVIE_CREATED
+	case MovieUpdated:
+		res.Type = moviev1.EventType_EVENT_TYPE_MOVIE_UPDATED
+	case MovieDeleted:
+		res.Type = moviev1.EventType_EVENT_TYPE_MOVIE_DELETED
+	}
+	if event.Movie != nil {
+		res.Movie = movieToProto(event.Movie)
+	}
+	return res
+}
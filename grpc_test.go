@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	moviev1 "github.com/Alieksieiev0/movie-microservice/proto/movie/v1"
+)
+
+// testGRPCClient serves the GRPCServer in memory and returns the client connected to it.
+func testGRPCClient(t *testing.T, gs GRPCServer) moviev1.MovieServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	moviev1.RegisterMovieServiceServer(srv, gs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("error connecting: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return moviev1.NewMovieServiceClient(conn)
+}
+
+func TestGRPCServer(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewLoggingService(logger, NewMovieService(NewMemoryDatabase()))
+	client := testGRPCClient(t, NewGRPCServer(svc))
+
+	created, err := client.CreateMovie(ctx, &moviev1.CreateMovieRequest{Movie: &moviev1.Movie{
+		Name:        "Alien",
+		ReleaseYear: 1979,
+		Rating:      "8.5",
+		Genres:      []string{"Horror"},
+		Director:    "Ridley Scott",
+	}})
+	if err != nil {
+		t.Fatalf("error creating movie: %v", err)
+	}
+	_, err = client.CreateMovie(ctx, &moviev1.CreateMovieRequest{Movie: &moviev1.Movie{
+		Name:        "Heat",
+		ReleaseYear: 1995,
+		Rating:      "8.3",
+		Director:    "Michael Mann",
+	}})
+	if err != nil {
+		t.Fatalf("error creating movie: %v", err)
+	}
+
+	_, err = client.UpdateMovie(ctx, &moviev1.UpdateMovieRequest{
+		Id:     created.Id,
+		Rating: "8.6",
+		Genres: &moviev1.GenreList{Genres: []string{"Horror", "Sci-Fi"}},
+	})
+	if err != nil {
+		t.Fatalf("error updating movie: %v", err)
+	}
+	got, err := client.GetMovie(ctx, &moviev1.GetMovieRequest{Id: created.Id})
+	if err != nil {
+		t.Fatalf("error getting movie: %v", err)
+	}
+	if got.Movie.Name != "Alien" || got.Movie.Rating != "8.6" || len(got.Movie.Genres) != 2 {
+		t.Errorf("wrong movie after partial update: %+v", got.Movie)
+	}
+
+	list, err := client.ListMovies(ctx, &moviev1.ListMoviesRequest{})
+	if err != nil || len(list.Movies) != 2 {
+		t.Errorf("two movies were expected; got: %d, err: %v", len(list.Movies), err)
+	}
+	page, err := client.ListMovies(ctx, &moviev1.ListMoviesRequest{Limit: 1, Offset: 1})
+	if err != nil || len(page.Movies) != 1 || page.Total != 2 {
+		t.Errorf("wrong page; expected: 1 of 2 movies, got: %d of %d, err: %v", len(page.GetMovies()), page.GetTotal(), err)
+	}
+
+	searches := []struct {
+		req      *moviev1.SearchMoviesRequest
+		expected int
+		total    int32
+	}{
+		{&moviev1.SearchMoviesRequest{Query: "scott"}, 1, 1},
+		{&moviev1.SearchMoviesRequest{Genre: "sci-fi"}, 1, 1},
+		{&moviev1.SearchMoviesRequest{MinReleaseYear: 1980, MaxReleaseYear: 2000}, 1, 1},
+		{&moviev1.SearchMoviesRequest{MinRating: "8.4"}, 1, 1},
+		{&moviev1.SearchMoviesRequest{}, 2, 2},
+		{&moviev1.SearchMoviesRequest{MinRating: "8", Limit: 1}, 1, 2},
+		{&moviev1.SearchMoviesRequest{Offset: 2}, 0, 2},
+	}
+	for _, s := range searches {
+		res, err := client.SearchMovies(ctx, s.req)
+		if err != nil || len(res.Movies) != s.expected || res.Total != s.total {
+			t.Errorf(
+				"wrong search result for %v; expected: %d of %d movies, got: %d of %d, err: %v",
+				s.req, s.expected, s.total, len(res.GetMovies()), res.GetTotal(), err,
+			)
+		}
+	}
+
+	if _, err := client.DeleteMovie(ctx, &moviev1.DeleteMovieRequest{Id: created.Id}); err != nil {
+		t.Fatalf("error deleting movie: %v", err)
+	}
+}
+
+func TestGRPCServerErrors(t *testing.T) {
+	ctx := context.Background()
+	client := testGRPCClient(t, NewGRPCServer(NewMovieService(NewMemoryDatabase())))
+	created, _ := client.CreateMovie(ctx, &moviev1.CreateMovieRequest{Movie: &moviev1.Movie{Name: "test", Rating: "1"}})
+
+	tests := []struct {
+		name     string
+		call     func() error
+		expected codes.Code
+	}{
+		{"not found", func() error {
+			_, err := client.GetMovie(ctx, &moviev1.GetMovieRequest{Id: "6ba7b810-9dad-11d1-80b4-00c04fd430c8"})
+			return err
+		}, codes.NotFound},
+		{"invalid id", func() error {
+			_, err := client.DeleteMovie(ctx, &moviev1.DeleteMovieRequest{Id: "1"})
+			return err
+		}, codes.InvalidArgument},
+		{"invalid rating", func() error {
+			_, err := client.CreateMovie(ctx, &moviev1.CreateMovieRequest{Movie: &moviev1.Movie{Rating: "high"}})
+			return err
+		}, codes.InvalidArgument},
+		{"invalid limit", func() error {
+			_, err := client.ListMovies(ctx, &moviev1.ListMoviesRequest{Limit: 1001})
+			return err
+		}, codes.InvalidArgument},
+		{"invalid offset", func() error {
+			_, err := client.SearchMovies(ctx, &moviev1.SearchMoviesRequest{Offset: -1})
+			return err
+		}, codes.InvalidArgument},
+		{"nothing to update", func() error {
+			_, err := client.UpdateMovie(ctx, &moviev1.UpdateMovieRequest{Id: created.Id})
+			return err
+		}, codes.InvalidArgument},
+		{"watch without broker", func() error {
+			stream, _ := client.Watch(ctx, &moviev1.WatchRequest{Topics: []string{"movies"}})
+			_, err := stream.Recv()
+			return err
+		}, codes.Unimplemented},
+	}
+	for _, tt := range tests {
+		if got := status.Code(tt.call()); got != tt.expected {
+			t.Errorf("%s: wrong code; expected: %v, got: %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestGRPCServerWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	movie := testMovie()
+	movie.Genres = []string{"Horror"}
+	log := memoryEventLog{
+		{ID: 1, Type: MovieCreated, Movie: movie},
+		{ID: 2, Type: MovieCreated, Movie: testMovie()},
+	}
+	broker := NewEventBroker(10)
+	client := testGRPCClient(t, NewGRPCServer(nil).WithWatch(broker, log))
+
+	stream, err := client.Watch(ctx, &moviev1.WatchRequest{Topics: []string{"genre:horror"}})
+	if err != nil {
+		t.Fatalf("error watching: %v", err)
+	}
+	for broker.Subscribers() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	broker.Publish(Event{ID: 3, Type: MovieDeleted})
+	broker.Publish(Event{ID: 4, Type: MovieUpdated, Movie: movie})
+	res, err := stream.Recv()
+	if err != nil || res.EventId != 4 || res.Type != moviev1.EventType_EVENT_TYPE_MOVIE_UPDATED {
+		t.Errorf("wrong event; expected: 4, got: %v, err: %v", res, err)
+	}
+
+	// Resumed stream replays missed events of the topics.
+	resumed, _ := client.Watch(ctx, &moviev1.WatchRequest{Topics: []string{"movies"}, AfterEventId: 1})
+	if res, err := resumed.Recv(); err != nil || res.EventId != 2 {
+		t.Errorf("wrong replayed event; expected: 2, got: %v, err: %v", res, err)
+	}
+}
@@ -2,73 +2,216 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/tracelog"
 )
 
+// NewLogger creates a structured logger, that writes one record per event to the provided writer.
+// Supported formats are "json" and "text".
+func NewLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", format)
+	}
+	return slog.New(contextHandler{Handler: handler}), nil
+}
+
+// ParseLogLevel converts level name (debug, info, warn, error) into slog.Level.
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+	if err != nil {
+		return 0, fmt.Errorf("unsupported log level: %s", s)
+	}
+	return level, nil
+}
+
+// contextHandler is a wrapper around slog.Handler, that adds request id and trace id
+// stored in the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := TraceIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("trace_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// DatabaseLogOptions controls which database operations are logged by DatabaseLogger.
+type DatabaseLogOptions struct {
+	// Level is the minimal tracelog level, that is passed to the logger by pgx.
+	Level tracelog.LogLevel
+	// SlowQuery, if positive, makes logger skip successful operations, that took less time.
+	SlowQuery time.Duration
+	// SampleRate is the fraction (0..1] of successful operations, that are logged.
+	// Errors are never sampled out.
+	SampleRate float64
+	// RedactArgs replaces values of the query arguments with placeholder.
+	RedactArgs bool
+}
+
+// DefaultDatabaseLogOptions returns options, that are safe to use in production:
+// only info and more severe operations are logged and arguments are redacted.
+func DefaultDatabaseLogOptions() DatabaseLogOptions {
+	return DatabaseLogOptions{
+		Level:      tracelog.LogLevelInfo,
+		SampleRate: 1,
+		RedactArgs: true,
+	}
+}
+
+// redactedArg is used instead of the query argument, when arguments redaction is enabled.
+const redactedArg = "[REDACTED]"
+
 // DatabaseLogger is responsible for logging information about all Database operations
 // by implementing tracelog.Logger interface.
 type DatabaseLogger struct {
-	// Logger from Golang standard library is used to print the info.
-	logger *log.Logger
+	// Structured logger is used to print the info, one record per operation.
+	logger *slog.Logger
+	opts   DatabaseLogOptions
 }
 
-// NewDatabaseLogger creates an instance of the MovieService.
-func NewDatabaseLogger(logger *log.Logger) tracelog.Logger {
+// NewDatabaseLogger creates an instance of the DatabaseLogger.
+func NewDatabaseLogger(logger *slog.Logger, opts DatabaseLogOptions) tracelog.Logger {
 	return DatabaseLogger{
 		logger: logger,
+		opts:   opts,
 	}
 }
 
 // Log is used to print information about completed operations.
+// Operations below configured level, faster than slow query threshold or not
+// selected by sampling are skipped.
 func (dl DatabaseLogger) Log(
 	ctx context.Context,
 	level tracelog.LogLevel,
 	msg string,
 	data map[string]any,
 ) {
-	dl.logger.Printf("Operation - %s", msg)
+	if !dl.shouldLog(level, data) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, len(data))
 	for k, v := range data {
-		dl.logger.Printf(" - %v: %v", k, v)
+		if k == "args" && dl.opts.RedactArgs {
+			v = redactArgs(v)
+		}
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	dl.logger.LogAttrs(ctx, slogLevel(level), msg, attrs...)
+}
+
+// shouldLog decides if the operation should be logged, using configured options.
+func (dl DatabaseLogger) shouldLog(level tracelog.LogLevel, data map[string]any) bool {
+	if dl.opts.Level == tracelog.LogLevelNone || level > dl.opts.Level {
+		return false
+	}
+	if level <= tracelog.LogLevelError {
+		return true
+	}
+
+	if dl.opts.SlowQuery > 0 {
+		elapsed, ok := data["time"].(time.Duration)
+		if !ok || elapsed < dl.opts.SlowQuery {
+			return false
+		}
+	}
+	return dl.opts.SampleRate >= 1 || rand.Float64() < dl.opts.SampleRate
+}
+
+// redactArgs replaces every query argument with placeholder, keeping the number of arguments.
+func redactArgs(v any) any {
+	args, ok := v.([]any)
+	if !ok {
+		return redactedArg
+	}
+	redacted := make([]any, len(args))
+	for i := range redacted {
+		redacted[i] = redactedArg
+	}
+	return redacted
+}
+
+// slogLevel maps tracelog.LogLevel to the closest slog.Level.
+func slogLevel(level tracelog.LogLevel) slog.Level {
+	switch level {
+	case tracelog.LogLevelTrace, tracelog.LogLevelDebug:
+		return slog.LevelDebug
+	case tracelog.LogLevelInfo:
+		return slog.LevelInfo
+	case tracelog.LogLevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
 	}
-	dl.logger.Println("-----------")
 }
 
 // LoggingService implements Service interface, which means, that this struct
 // can be a wrapper around the another struct that implements Service interface
 // For example: MovieService.
 type LoggingService struct {
-	logger *log.Logger
+	logger *slog.Logger
 	next   Service
 }
 
 // NewLogginService creates an instance of the LoggingService.
-func NewLoggingService(logger *log.Logger, next Service) Service {
+func NewLoggingService(logger *slog.Logger, next Service) Service {
 	return LoggingService{
 		logger: logger,
 		next:   next,
 	}
 }
 
+// log writes a single record describing the finished call of the method.
+func (ls LoggingService) log(
+	ctx context.Context,
+	method string,
+	start time.Time,
+	err error,
+	attrs ...slog.Attr,
+) {
+	level := slog.LevelInfo
+	attrs = append(attrs, slog.String("method", method), slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	ls.logger.LogAttrs(ctx, level, "service call", attrs...)
+}
+
 func (ls LoggingService) GetMovie(ctx context.Context, id string) (movie *Movie, err error) {
 	defer func(start time.Time) {
-		ls.logger.Println("GetMovie Results")
-		if movie != nil {
-			ls.logger.Printf(
-				" - Id: %s, Name: %s, ReleaseYear: %d, Rating: %v, Genres: %v, Director: %s",
-				movie.Id,
-				movie.Name,
-				movie.ReleaseYear,
-				movie.Rating,
-				movie.Genres,
-				movie.Director,
-			)
-		}
-		ls.logger.Printf(" - err: %v", err)
-		ls.logger.Printf(" - time: %v", time.Since(start))
-		ls.logger.Println("-----------")
+		ls.log(ctx, "GetMovie", start, err, slog.String("movie_id", id))
 	}(time.Now())
 
 	return ls.next.GetMovie(ctx, id)
@@ -76,33 +219,36 @@ func (ls LoggingService) GetMovie(ctx context.Context, id string) (movie *Movie,
 
 func (ls LoggingService) GetAllMovies(ctx context.Context) (movies []Movie, err error) {
 	defer func(start time.Time) {
-		ls.logger.Println("GetAllMovies Results")
-		for _, m := range movies {
-			ls.logger.Printf(
-				" - Id: %s, Name: %s, ReleaseYear: %d, Rating: %v, Genres: %v, Director: %s",
-				m.Id,
-				m.Name,
-				m.ReleaseYear,
-				m.Rating,
-				m.Genres,
-				m.Director,
-			)
-		}
-		ls.logger.Printf(" - err: %v", err)
-		ls.logger.Printf(" - time: %v", time.Since(start))
-		ls.logger.Println("-----------")
+		ls.log(ctx, "GetAllMovies", start, err, slog.Int("count", len(movies)))
 	}(time.Now())
 
 	return ls.next.GetAllMovies(ctx)
 }
 
+func (ls LoggingService) ListMovies(ctx context.Context, q MovieQuery) (movies []Movie, total int, err error) {
+	defer func(start time.Time) {
+		ls.log(
+			ctx,
+			"ListMovies",
+			start,
+			err,
+			slog.Int("ids", len(q.IDs)),
+			slog.Int("directors", len(q.Directors)),
+			slog.String("query", q.Filter.Query),
+			slog.String("sort", q.Sort.Field),
+			slog.Int("limit", q.Limit),
+			slog.Int("offset", q.Offset),
+			slog.Int("count", len(movies)),
+			slog.Int("total", total),
+		)
+	}(time.Now())
+
+	return ls.next.ListMovies(ctx, q)
+}
+
 func (ls LoggingService) CreateMovie(ctx context.Context, m *Movie) (id string, err error) {
 	defer func(start time.Time) {
-		ls.logger.Println("CreateMovie Results")
-		ls.logger.Printf(" - id: %v", id)
-		ls.logger.Printf(" - err: %v", err)
-		ls.logger.Printf(" - time: %v", time.Since(start))
-		ls.logger.Println("-----------")
+		ls.log(ctx, "CreateMovie", start, err, slog.String("movie_id", id))
 	}(time.Now())
 
 	return ls.next.CreateMovie(ctx, m)
@@ -110,10 +256,7 @@ func (ls LoggingService) CreateMovie(ctx context.Context, m *Movie) (id string,
 
 func (ls LoggingService) UpdateMovie(ctx context.Context, id string, m *Movie) (err error) {
 	defer func(start time.Time) {
-		ls.logger.Println("UpdateMovie Results")
-		ls.logger.Printf(" - err: %v", err)
-		ls.logger.Printf(" - time: %v", time.Since(start))
-		ls.logger.Println("-----------")
+		ls.log(ctx, "UpdateMovie", start, err, slog.String("movie_id", id))
 	}(time.Now())
 
 	return ls.next.UpdateMovie(ctx, id, m)
@@ -121,10 +264,7 @@ func (ls LoggingService) UpdateMovie(ctx context.Context, id string, m *Movie) (
 
 func (ls LoggingService) DeleteMovie(ctx context.Context, id string) (err error) {
 	defer func(start time.Time) {
-		ls.logger.Println("DeleteMovie Results")
-		ls.logger.Printf(" - err: %v", err)
-		ls.logger.Printf(" - time: %v", time.Since(start))
-		ls.logger.Println("-----------")
+		ls.log(ctx, "DeleteMovie", start, err, slog.String("movie_id", id))
 	}(time.Now())
 
 	return ls.next.DeleteMovie(ctx, id)
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/tracelog"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestLoggingServiceRecord(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	id := testUUID(t)
+
+	buf := bytes.Buffer{}
+	logger, err := NewLogger(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := NewLoggingService(logger, NewMovieService(NewMovieDatabase(mock)))
+
+	rows := pgxmock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...)
+	mock.ExpectQuery("select *").WithArgs(id.String()).WillReturnRows(rows)
+	ctx := WithTraceID(WithRequestID(context.Background(), "req-1"), "trace-1")
+	if _, err := ls.GetMovie(ctx, id.String()); err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 1 {
+		t.Fatalf("wrong number of records written; expected: 1, got: %d", n)
+	}
+	record := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("error decoding record: %v", err)
+	}
+
+	expected := map[string]any{
+		"method":     "GetMovie",
+		"movie_id":   id.String(),
+		"request_id": "req-1",
+		"trace_id":   "trace-1",
+	}
+	for k, v := range expected {
+		if record[k] != v {
+			t.Errorf("wrong %s in record; expected: %v, got: %v", k, v, record[k])
+		}
+	}
+	if _, ok := record["duration"]; !ok {
+		t.Errorf("duration was not added to record")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("warn")
+	if err != nil {
+		t.Fatalf("error parsing level: %v", err)
+	}
+	if level != slog.LevelWarn {
+		t.Errorf("wrong level parsed; expected: %v, got: %v", slog.LevelWarn, level)
+	}
+
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Errorf("error was expected for unsupported level")
+	}
+}
+
+func TestDatabaseLoggerOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    DatabaseLogOptions
+		level   tracelog.LogLevel
+		elapsed time.Duration
+		logged  bool
+	}{
+		{"below level", DatabaseLogOptions{Level: tracelog.LogLevelWarn, SampleRate: 1}, tracelog.LogLevelInfo, 0, false},
+		{"at level", DatabaseLogOptions{Level: tracelog.LogLevelInfo, SampleRate: 1}, tracelog.LogLevelInfo, 0, true},
+		{"none", DatabaseLogOptions{Level: tracelog.LogLevelNone, SampleRate: 1}, tracelog.LogLevelError, 0, false},
+		{"fast query", DatabaseLogOptions{Level: tracelog.LogLevelInfo, SlowQuery: time.Second, SampleRate: 1}, tracelog.LogLevelInfo, time.Millisecond, false},
+		{"slow query", DatabaseLogOptions{Level: tracelog.LogLevelInfo, SlowQuery: time.Second, SampleRate: 1}, tracelog.LogLevelInfo, 2 * time.Second, true},
+		{"sampled out", DatabaseLogOptions{Level: tracelog.LogLevelInfo}, tracelog.LogLevelInfo, 0, false},
+		{"error is not sampled", DatabaseLogOptions{Level: tracelog.LogLevelInfo, SlowQuery: time.Second}, tracelog.LogLevelError, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			logger, err := NewLogger(&buf, "json", slog.LevelDebug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dl := NewDatabaseLogger(logger, tt.opts)
+			dl.Log(context.Background(), tt.level, "Query", map[string]any{"time": tt.elapsed})
+
+			if logged := buf.Len() > 0; logged != tt.logged {
+				t.Errorf("wrong logging decision; expected: %v, got: %v", tt.logged, logged)
+			}
+		})
+	}
+}
+
+func TestDatabaseLoggerRedactArgs(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger, err := NewLogger(&buf, "json", slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl := NewDatabaseLogger(logger, DefaultDatabaseLogOptions())
+	dl.Log(
+		context.Background(),
+		tracelog.LogLevelInfo,
+		"Query",
+		map[string]any{"sql": "select 1", "args": []any{"secret", 42}},
+	)
+
+	if bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Errorf("query arguments were not redacted: %s", buf.String())
+	}
+	if c := bytes.Count(buf.Bytes(), []byte(redactedArg)); c != 2 {
+		t.Errorf("wrong number of redacted arguments; expected: 2, got: %d", c)
+	}
+}
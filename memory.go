@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+// ratingScale and maxRating mirror numeric(3,1) type of the rating column.
+const ratingScale = 1
+
+var maxRating = decimal.NewFromInt(100)
+
+// MemoryDatabase is a concurrency-safe in-memory implementation of the Database interface.
+// It follows the same rules as MovieDatabase, so it can be used for local development and tests.
+type MemoryDatabase struct {
+	mu sync.RWMutex
+	// movies are stored by id, order keeps ids sorted, as PostgreSql orders them.
+	movies map[uuid.UUID]Movie
+	order  []uuid.UUID
+}
+
+// NewMemoryDatabase creates an empty instance of the MemoryDatabase.
+func NewMemoryDatabase() Database {
+	return &MemoryDatabase{
+		movies: map[uuid.UUID]Movie{},
+	}
+}
+
+func (mdb *MemoryDatabase) Get(_ context.Context, id string) (*Movie, error) {
+	movieId, err := parseMovieId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+	movie, ok := mdb.movies[movieId]
+	if !ok {
+		return nil, ErrMovieNotFound
+	}
+	movie = copyMovie(movie)
+	return &movie, nil
+}
+
+func (mdb *MemoryDatabase) GetAll(_ context.Context) ([]Movie, error) {
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+
+	movies := make([]Movie, 0, len(mdb.order))
+	for _, id := range mdb.order {
+		movies = append(movies, copyMovie(mdb.movies[id]))
+	}
+	return movies, nil
+}
+
+func (mdb *MemoryDatabase) List(_ context.Context, q MovieQuery) ([]Movie, int, error) {
+	mdb.mu.RLock()
+	defer mdb.mu.RUnlock()
+
+	all := make([]Movie, 0, len(mdb.order))
+	for _, id := range mdb.order {
+		all = append(all, mdb.movies[id])
+	}
+	page, total := SelectMovies(all, q)
+	movies := make([]Movie, 0, len(page))
+	for _, m := range page {
+		movies = append(movies, copyMovie(m))
+	}
+	return movies, total, nil
+}
+
+func (mdb *MemoryDatabase) Insert(_ context.Context, movie *Movie) (string, error) {
+	if movie.Genres == nil {
+		return "", fmt.Errorf("genres must not be null")
+	}
+	rating, err := normalizeRating(movie.Rating)
+	if err != nil {
+		return "", err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	stored := copyMovie(*movie)
+	stored.Id = id
+	stored.Rating = rating
+
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	mdb.movies[id] = stored
+	i, _ := slices.BinarySearchFunc(mdb.order, id, compareMovieIds)
+	mdb.order = slices.Insert(mdb.order, i, id)
+	return id.String(), nil
+}
+
+// Update applies the same partial update rules as MovieDatabase.buildUpdateQuery:
+// only fields with values different from types zero values are updated.
+func (mdb *MemoryDatabase) Update(_ context.Context, id string, movie *Movie) error {
+	movieId, err := parseMovieId(id)
+	if err != nil {
+		return err
+	}
+	rating, err := normalizeRating(movie.Rating)
+	if err != nil {
+		return err
+	}
+	if movie.Name == "" && movie.ReleaseYear == 0 && movie.Rating.IsZero() &&
+		movie.Genres == nil && movie.Director == "" {
+		return ErrNothingToUpdate
+	}
+
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	stored, ok := mdb.movies[movieId]
+	if !ok {
+		return ErrMovieNotFound
+	}
+
+	if movie.Name != "" {
+		stored.Name = movie.Name
+	}
+	if movie.ReleaseYear != 0 {
+		stored.ReleaseYear = movie.ReleaseYear
+	}
+	if !movie.Rating.IsZero() {
+		stored.Rating = rating
+	}
+	if movie.Genres != nil {
+		stored.Genres = slices.Clone(movie.Genres)
+	}
+	if movie.Director != "" {
+		stored.Director = movie.Director
+	}
+	mdb.movies[movieId] = stored
+	return nil
+}
+
+func (mdb *MemoryDatabase) Delete(_ context.Context, id string) error {
+	movieId, err := parseMovieId(id)
+	if err != nil {
+		return err
+	}
+
+	mdb.mu.Lock()
+	defer mdb.mu.Unlock()
+	if _, ok := mdb.movies[movieId]; !ok {
+		return ErrMovieNotFound
+	}
+	delete(mdb.movies, movieId)
+	mdb.order = slices.DeleteFunc(mdb.order, func(id uuid.UUID) bool {
+		return id == movieId
+	})
+	return nil
+}
+
+// compareMovieIds orders ids by their bytes, the same way PostgreSql orders uuid values.
+func compareMovieIds(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// parseMovieId converts id into UUID, returning the same kind of error,
+// as PostgreSql does for malformed ids.
+func parseMovieId(id string) (uuid.UUID, error) {
+	movieId, err := uuid.FromString(id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid input syntax for type uuid: %q", id)
+	}
+	return movieId, nil
+}
+
+// parseMovieIds parses ids of the movies, invalid ids are dropped, since they do not match any movie.
+func parseMovieIds(ids []string) []uuid.UUID {
+	movieIds := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if movieId, err := uuid.FromString(id); err == nil {
+			movieIds = append(movieIds, movieId)
+		}
+	}
+	return movieIds
+}
+
+// normalizeRating rounds rating to the precision of the rating column
+// and checks, that it fits into it.
+func normalizeRating(rating decimal.Decimal) (decimal.Decimal, error) {
+	rounded := rating.Round(ratingScale)
+	if rounded.Abs().GreaterThanOrEqual(maxRating) {
+		return decimal.Decimal{}, fmt.Errorf("numeric field overflow: rating %s", rating)
+	}
+	return rounded, nil
+}
+
+// copyMovie returns a copy of the movie, that does not share genres with the original.
+func copyMovie(m Movie) Movie {
+	m.Genres = slices.Clone(m.Genres)
+	return m
+}
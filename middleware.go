@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Middleware wraps http.Handler to add behaviour before and/or after the request is handled.
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps handler with provided middlewares. The first middleware is the outermost one,
+// which means, that it is the first to see the request and the last to see the response.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// DefaultMiddlewares returns the middleware stack used by the service:
+// request id propagation, access logging (if enabled) and panic recovery.
+func DefaultMiddlewares(logger *slog.Logger, features FeaturesConfig) []Middleware {
+	middlewares := []Middleware{RequestID()}
+	if features.AccessLog {
+		middlewares = append(middlewares, AccessLog(logger))
+	}
+	return append(middlewares, Recover(logger))
+}
+
+// RequestID stores request id in the request context and adds it to X-Request-ID
+// response header. Id provided by the client is reused, otherwise the new one is generated.
+// Trace id from the traceparent header is stored in the context as well.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-ID")
+			if id == "" {
+				id = newRequestID()
+			}
+			w.Header().Set("X-Request-ID", id)
+
+			ctx := WithRequestID(r.Context(), id)
+			if traceID := traceIDFromHeader(r.Header); traceID != "" {
+				ctx = WithTraceID(ctx, traceID)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// newRequestID generates random request id. If generation fails,
+// id based on the current time is used instead.
+func newRequestID() string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return id.String()
+}
+
+// AccessLog writes a single record for every handled request with its method,
+// path, response status, number of written bytes and duration.
+func AccessLog(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			logger.LogAttrs(
+				r.Context(),
+				slog.LevelInfo,
+				"http request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rw.status),
+				slog.Int("bytes", rw.bytes),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// Recover catches panics raised by the next handlers, logs them and responds
+// with 500 problem response instead of dropping the connection.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// http.ErrAbortHandler is used to abort the response on purpose.
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				logger.LogAttrs(
+					r.Context(),
+					slog.LevelError,
+					"panic recovered",
+					slog.Any("panic", rec),
+					slog.String("stack", string(debug.Stack())),
+				)
+				writeProblem(w, r, http.StatusInternalServerError, "internal server error")
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// responseRecorder is a wrapper around http.ResponseWriter, that remembers
+// the status code and the number of bytes written to the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Hijack allows WebSocket connections to take over the underlying connection,
+// it is recorded with 101 status.
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.status = http.StatusSwitchingProtocols
+		rw.wroteHeader = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
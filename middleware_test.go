@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var ctxID string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxID = RequestIDFromContext(r.Context())
+	}), RequestID())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/movies", nil))
+	if ctxID == "" || w.Header().Get("X-Request-ID") != ctxID {
+		t.Errorf(
+			"request id was not generated; context: %q, header: %q",
+			ctxID,
+			w.Header().Get("X-Request-ID"),
+		)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/movies", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	h.ServeHTTP(w, r)
+	if ctxID != "req-1" || w.Header().Get("X-Request-ID") != "req-1" {
+		t.Errorf("request id was not propagated; expected: req-1, got: %q", ctxID)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger, err := NewLogger(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, "short and stout")
+	}), RequestID(), AccessLog(logger))
+
+	r := httptest.NewRequest(http.MethodGet, "/movies", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	record := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("error decoding record: %v", err)
+	}
+	expected := map[string]any{
+		"method":     http.MethodGet,
+		"path":       "/movies",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(len("short and stout")),
+		"request_id": "req-1",
+	}
+	for k, v := range expected {
+		if record[k] != v {
+			t.Errorf("wrong %s in record; expected: %v, got: %v", k, v, record[k])
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	logger, err := NewLogger(io.Discard, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), Recover(logger))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/movies", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf(
+			"wrong status code returned; expected: %d, got: %d",
+			http.StatusInternalServerError,
+			w.Code,
+		)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("wrong content type returned; expected: application/problem+json, got: %s", ct)
+	}
+	p := problem{}
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Errorf("error reading response body: %v", err)
+	}
+	if p.Status != http.StatusInternalServerError {
+		t.Errorf("wrong status in problem; expected: %d, got: %d", http.StatusInternalServerError, p.Status)
+	}
+}
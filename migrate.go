@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// migrationsFS contains numbered up/down SQL migrations of the database schema.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockKey is the key of the PostgreSql advisory lock, that prevents
+// concurrent migration runners from applying the same migrations.
+const migrationLockKey int64 = 7_215_640_118
+
+// migrationFileRe matches migration file names, e.g. 0001_create_movie.up.sql.
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned change of the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether the migration was applied and when.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads all migrations from the provided file system and returns them
+// ordered by version. Every migration must have both up and down files.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		match := migrationFileRe.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", file)
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s", file)
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, m.Name, match[2])
+		}
+		switch match[3] {
+		case "up":
+			m.Up = string(data)
+		case "down":
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// EmbeddedMigrations returns migrations embedded into the binary.
+func EmbeddedMigrations() ([]Migration, error) {
+	sub, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// migrationStore runs migrations on the particular database and keeps track of them
+// in the schema_migrations table.
+type migrationStore interface {
+	// lock prevents concurrent runners from migrating the same database
+	// and creates schema_migrations table, if it does not exist.
+	lock(ctx context.Context) error
+	unlock(ctx context.Context) error
+	// applied fetches versions of the applied migrations with the time they were applied at.
+	applied(ctx context.Context) (map[int]time.Time, error)
+	// apply runs up migration and records it in the same transaction.
+	apply(ctx context.Context, mig Migration) error
+	// rollback runs down migration and removes its record in the same transaction.
+	rollback(ctx context.Context, mig Migration) error
+}
+
+// Migrator applies and rolls back migrations, keeping track of them in schema_migrations table.
+type Migrator struct {
+	store      migrationStore
+	migrations []Migration
+}
+
+// NewMigrator creates an instance of the Migrator for PostgreSql database.
+func NewMigrator(conn migrationConn, migrations []Migration) Migrator {
+	return Migrator{
+		store:      pgMigrationStore{conn: conn},
+		migrations: migrations,
+	}
+}
+
+// Up applies all pending migrations.
+func (m Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down rolls back the last applied migration.
+func (m Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(applied map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.store.rollback(ctx, m.migrations[i])
+			}
+		}
+		return nil
+	})
+}
+
+// To applies or rolls back migrations, so the schema matches provided version.
+// Version 0 rolls back all migrations.
+func (m Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && !m.exists(version) {
+		return fmt.Errorf("migration %d does not exist", version)
+	}
+
+	return m.locked(ctx, func(applied map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > version {
+				if err := m.store.rollback(ctx, mig); err != nil {
+					return err
+				}
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+				if err := m.store.apply(ctx, mig); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns all known migrations with information, whether they were applied.
+func (m Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+	err := m.locked(ctx, func(applied map[int]time.Time) error {
+		for _, mig := range m.migrations {
+			at, ok := applied[mig.Version]
+			statuses = append(statuses, MigrationStatus{Migration: mig, Applied: ok, AppliedAt: at})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m Migrator) exists(version int) bool {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// locked runs fn while holding the migration lock, passing versions of the applied migrations.
+func (m Migrator) locked(ctx context.Context, fn func(applied map[int]time.Time) error) (err error) {
+	err = m.store.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring migration lock: %v", err)
+	}
+	defer func() {
+		unlockErr := m.store.unlock(ctx)
+		if err == nil && unlockErr != nil {
+			err = fmt.Errorf("error releasing migration lock: %v", unlockErr)
+		}
+	}()
+
+	applied, err := m.store.applied(ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching applied migrations: %v", err)
+	}
+	return fn(applied)
+}
+
+// migrationConn is a single database connection, used by pgMigrationStore.
+// Single connection is required, because advisory lock is held by the session.
+type migrationConn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, optionsAndArgs ...any) (pgx.Rows, error)
+}
+
+// pgMigrationStore is a PostgreSql implementation of the migrationStore,
+// protected from concurrent runners by the advisory lock.
+type pgMigrationStore struct {
+	conn migrationConn
+}
+
+func (s pgMigrationStore) lock(ctx context.Context) error {
+	_, err := s.conn.Exec(ctx, "select pg_advisory_lock($1)", migrationLockKey)
+	if err != nil {
+		return err
+	}
+
+	q := `
+	create table if not exists schema_migrations (
+		version bigint primary key,
+		name text not null,
+		applied_at timestamptz not null default now()
+	)
+	`
+	_, err = s.conn.Exec(ctx, q)
+	if err != nil {
+		s.unlock(ctx)
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+func (s pgMigrationStore) unlock(ctx context.Context) error {
+	_, err := s.conn.Exec(ctx, "select pg_advisory_unlock($1)", migrationLockKey)
+	return err
+}
+
+func (s pgMigrationStore) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := s.conn.Query(ctx, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	var version int
+	var at time.Time
+	_, err = pgx.ForEachRow(rows, []any{&version, &at}, func() error {
+		applied[version] = at
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+func (s pgMigrationStore) apply(ctx context.Context, mig Migration) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Up); err != nil {
+			return fmt.Errorf("error applying migration %d_%s: %v", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(
+			ctx,
+			"insert into schema_migrations(version, name) values ($1, $2)",
+			mig.Version,
+			mig.Name,
+		)
+		return err
+	})
+}
+
+func (s pgMigrationStore) rollback(ctx context.Context, mig Migration) error {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Down); err != nil {
+			return fmt.Errorf("error rolling back migration %d_%s: %v", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(ctx, "delete from schema_migrations where version = $1", mig.Version)
+		return err
+	})
+}
+
+func (s pgMigrationStore) inTx(ctx context.Context, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		switch err {
+		case nil:
+			err = tx.Commit(ctx)
+		default:
+			tx.Rollback(ctx)
+		}
+	}()
+
+	return fn(tx)
+}
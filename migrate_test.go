@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := EmbeddedMigrations()
+	if err != nil {
+		t.Fatalf("error loading migrations: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 {
+		t.Fatalf("first migration was not loaded: %v", migrations)
+	}
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i-1].Version >= migrations[i].Version {
+			t.Errorf(
+				"migrations are not ordered by version: %d, %d",
+				migrations[i-1].Version,
+				migrations[i].Version,
+			)
+		}
+	}
+}
+
+func TestLoadMigrationsWithoutDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_init.up.sql": &fstest.MapFile{Data: []byte("create table t (id int)")},
+	}
+	if _, err := LoadMigrations(fsys); err == nil {
+		t.Errorf("error was expected for migration without down file")
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	mock := testConnMock(t)
+	defer mock.Close(context.Background())
+	migrations := testMigrations()
+	m := NewMigrator(mock, migrations)
+
+	expectMigrationLock(mock, pgxmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec("create table b").WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectExec("insert into schema_migrations").
+		WithArgs(2, "second").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	expectMigrationUnlock(mock)
+
+	if err := m.Up(context.Background()); err != nil {
+		t.Errorf("error was not expected while migrating: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigratorDown(t *testing.T) {
+	mock := testConnMock(t)
+	defer mock.Close(context.Background())
+	m := NewMigrator(mock, testMigrations())
+
+	rows := pgxmock.NewRows([]string{"version", "applied_at"}).
+		AddRow(1, time.Now()).
+		AddRow(2, time.Now())
+	expectMigrationLock(mock, rows)
+	mock.ExpectBegin()
+	mock.ExpectExec("drop table b").WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+	mock.ExpectExec("delete from schema_migrations").
+		WithArgs(2).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+	expectMigrationUnlock(mock)
+
+	if err := m.Down(context.Background()); err != nil {
+		t.Errorf("error was not expected while rolling back: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigratorToUnknownVersion(t *testing.T) {
+	mock := testConnMock(t)
+	defer mock.Close(context.Background())
+	m := NewMigrator(mock, testMigrations())
+
+	if err := m.To(context.Background(), 42); err == nil {
+		t.Errorf("error was expected for unknown version")
+	}
+}
+
+func testConnMock(t *testing.T) pgxmock.PgxConnIface {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "first", Up: "create table a (id int)", Down: "drop table a"},
+		{Version: 2, Name: "second", Up: "create table b (id int)", Down: "drop table b"},
+	}
+}
+
+func expectMigrationLock(mock pgxmock.PgxConnIface, applied *pgxmock.Rows) {
+	mock.ExpectExec("select pg_advisory_lock").
+		WithArgs(migrationLockKey).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec("create table if not exists schema_migrations").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectQuery("select version, applied_at from schema_migrations").WillReturnRows(applied)
+}
+
+func expectMigrationUnlock(mock pgxmock.PgxConnIface) {
+	mock.ExpectExec("select pg_advisory_unlock").
+		WithArgs(migrationLockKey).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+}
@@ -1,8 +1,8 @@
-CREATE TABLE movie (
+CREATE TABLE IF NOT EXISTS movie (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     name text NOT NULL,
     release_year int NOT NULL,
     rating numeric(3,1),
-    genres text[] NOT NULl,
-    director text NOT NULL 
+    genres text[] NOT NULL,
+    director text NOT NULL
 );
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_unpublished_movie_idx;
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS dead_at;
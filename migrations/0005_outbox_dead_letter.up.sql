@@ -0,0 +1,3 @@
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_movie_idx ON outbox (aggregate_id, id) WHERE published_at IS NULL;
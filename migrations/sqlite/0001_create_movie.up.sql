@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS movie (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    release_year INTEGER NOT NULL,
+    rating TEXT,
+    genres TEXT NOT NULL,
+    director TEXT NOT NULL
+);
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSPublisher is a BrokerPublisher, that publishes messages to NATS subjects.
+// Key is sent in the Movie-Id header. Publish waits, until the server has processed
+// the message, so the relay retries it, if the connection is lost. Messages are kept
+// for subscribers, that are not connected, only if subjects are captured by JetStream stream.
+type NATSPublisher struct {
+	conn *nats.Conn
+}
+
+// NewNATSPublisher creates an instance of the NATSPublisher.
+func NewNATSPublisher(conn *nats.Conn) BrokerPublisher {
+	return NATSPublisher{
+		conn: conn,
+	}
+}
+
+func (p NATSPublisher) Publish(ctx context.Context, topic string, key string, data []byte) error {
+	msg := nats.NewMsg(topic)
+	msg.Header.Set("Movie-Id", key)
+	msg.Data = data
+	if err := p.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	// Flush uses the default timeout, since context without deadline is not accepted.
+	if _, ok := ctx.Deadline(); !ok {
+		return p.conn.Flush()
+	}
+	return p.conn.FlushWithContext(ctx)
+}
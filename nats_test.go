@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeNATSServer accepts a single client, answers its pings and sends published messages to msgs.
+// Only the part of the protocol used by NATSPublisher is supported.
+func fakeNATSServer(t *testing.T, msgs chan<- string) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, `INFO {"server_id":"fake","version":"2.10.0","proto":1,"headers":true,"max_payload":1048576}`+"\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case "HPUB":
+				var total int
+				fmt.Sscan(fields[len(fields)-1], &total)
+				msg := make([]byte, total+2)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					return
+				}
+				msgs <- fields[1] + " " + string(msg[:total])
+			}
+		}
+	}()
+	return "nats://" + lis.Addr().String()
+}
+
+func TestNATSPublisher(t *testing.T) {
+	msgs := make(chan string, 1)
+	conn, err := nats.Connect(fakeNATSServer(t, msgs))
+	if err != nil {
+		t.Fatalf("error connecting: %v", err)
+	}
+	defer conn.Close()
+
+	sink := NewBrokerSink(NewNATSPublisher(conn), "movies")
+	id := testUUID(t)
+	if err := sink.Publish(context.Background(), Event{ID: 1, Type: MovieDeleted, MovieID: id}); err != nil {
+		t.Fatalf("error publishing: %v", err)
+	}
+	msg := <-msgs
+	if !strings.HasPrefix(msg, "movies.MovieDeleted ") {
+		t.Errorf("wrong subject; expected: movies.MovieDeleted, got: %s", msg)
+	}
+	if !strings.Contains(msg, "Movie-Id: "+id.String()) || !strings.Contains(msg, `"movie_id":"`+id.String()+`"`) {
+		t.Errorf("wrong message; expected movie id %s in header and data, got: %s", id, msg)
+	}
+}
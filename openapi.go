@@ -0,0 +1,622 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// docsPage renders the OpenAPI document with Redoc.
+//
+//go:embed docs/index.html
+var docsPage []byte
+
+// apiOperation is an OpenAPI operation object.
+type apiOperation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	Tags        []string               `json:"tags"`
+	Parameters  []apiParameter         `json:"parameters,omitempty"`
+	RequestBody *apiRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]apiResponse `json:"responses"`
+}
+
+// apiParameter is an OpenAPI parameter object.
+type apiParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      map[string]any `json:"schema"`
+}
+
+// apiRequestBody is an OpenAPI request body object.
+type apiRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]apiMediaType `json:"content"`
+}
+
+// apiResponse is an OpenAPI response object.
+type apiResponse struct {
+	Description string                  `json:"description"`
+	Headers     map[string]apiHeader    `json:"headers,omitempty"`
+	Content     map[string]apiMediaType `json:"content,omitempty"`
+}
+
+// apiHeader is an OpenAPI header object.
+type apiHeader struct {
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema"`
+}
+
+// apiMediaType is an OpenAPI media type object.
+type apiMediaType struct {
+	Schema map[string]any `json:"schema"`
+}
+
+// schemaRef returns reference to the schema from components.
+func schemaRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// jsonContent returns content with the single application/json media type.
+func jsonContent(schema map[string]any) map[string]apiMediaType {
+	return map[string]apiMediaType{"application/json": {Schema: schema}}
+}
+
+// jsonBody returns required JSON request body.
+func jsonBody(schema map[string]any) *apiRequestBody {
+	return &apiRequestBody{Required: true, Content: jsonContent(schema)}
+}
+
+// jsonResponse returns response with JSON body.
+func jsonResponse(description string, schema map[string]any) apiResponse {
+	return apiResponse{Description: description, Content: jsonContent(schema)}
+}
+
+// bodyContent returns content with media types of all default codecs.
+func bodyContent(schema map[string]any) map[string]apiMediaType {
+	content := map[string]apiMediaType{}
+	for _, t := range DefaultCodecs().MediaTypes() {
+		content[t] = apiMediaType{Schema: schema}
+	}
+	return content
+}
+
+// bodyRequest returns required request body, decoded by the codec of its Content-Type.
+func bodyRequest(schema map[string]any) *apiRequestBody {
+	return &apiRequestBody{Required: true, Content: bodyContent(schema)}
+}
+
+// bodyResponse returns response with body, encoded by the codec negotiated by Accept header.
+func bodyResponse(description string, schema map[string]any) apiResponse {
+	return apiResponse{Description: description, Content: bodyContent(schema)}
+}
+
+// errorResponse returns response with the {"error": "..."} body written by the handlers.
+func errorResponse(description string) apiResponse {
+	return bodyResponse(description, schemaRef("Error"))
+}
+
+// idParameter describes {id} path value.
+func idParameter(description string) apiParameter {
+	return apiParameter{
+		Name:        "id",
+		In:          "path",
+		Description: description,
+		Required:    true,
+		Schema:      map[string]any{"type": "string", "format": "uuid"},
+	}
+}
+
+// contentEncodingParameter describes Content-Encoding header of the compressed request body.
+func contentEncodingParameter() apiParameter {
+	return apiParameter{
+		Name:        "Content-Encoding",
+		In:          "header",
+		Description: "gzip, if the body is compressed",
+		Schema:      map[string]any{"type": "string", "enum": []string{"gzip", "identity"}},
+	}
+}
+
+// fieldsParameter describes fields query parameter of the movie reads.
+func fieldsParameter() apiParameter {
+	return apiParameter{
+		Name:        "fields",
+		In:          "query",
+		Description: "comma separated fields of the movie to return, e.g. id,name,rating, all fields by default",
+		Schema:      map[string]any{"type": "string", "examples": []string{"id,name,rating"}},
+	}
+}
+
+// movieSchema returns schema of the movie returned by the reads, which is partial,
+// if fields are requested.
+func movieSchema() map[string]any {
+	return map[string]any{"anyOf": []any{schemaRef("Movie"), schemaRef("PartialMovie")}}
+}
+
+// apiOperations describes every route of the Server by its pattern.
+var apiOperations = map[string]apiOperation{
+	"GET /movies/{id}": {
+		OperationID: "getMovie",
+		Summary:     "Get movie",
+		Tags:        []string{"movies"},
+		Parameters:  []apiParameter{idParameter("id of the movie"), fieldsParameter()},
+		Responses: map[string]apiResponse{
+			"200": bodyResponse("Movie with the requested fields", movieSchema()),
+			"400": errorResponse("Fields are unknown"),
+			"422": errorResponse("Movie does not exist or id is malformed"),
+		},
+	},
+	"GET /movies": {
+		OperationID: "getAllMovies",
+		Summary:     "Get all movies",
+		Description: "All movies are returned, unless limit or offset is provided.",
+		Tags:        []string{"movies"},
+		Parameters: []apiParameter{
+			{
+				Name:   "limit",
+				In:     "query",
+				Schema: map[string]any{"type": "integer", "minimum": 1, "maximum": 1000, "default": 100},
+			},
+			{
+				Name:   "offset",
+				In:     "query",
+				Schema: map[string]any{"type": "integer", "minimum": 0, "default": 0},
+			},
+			fieldsParameter(),
+		},
+		Responses: map[string]apiResponse{
+			"200": {
+				Description: "Stored movies or the requested page of them",
+				Headers: map[string]apiHeader{
+					"X-Total-Count": {
+						Description: "Number of all movies, set only if the page is requested",
+						Schema:      map[string]any{"type": "integer"},
+					},
+				},
+				Content: bodyContent(map[string]any{"type": "array", "items": movieSchema()}),
+			},
+			"400": errorResponse("Limit or offset is out of range, or fields are unknown"),
+			"422": errorResponse("Movies were not fetched"),
+		},
+	},
+	"POST /movies": {
+		OperationID: "createMovie",
+		Summary:     "Create movie",
+		Tags:        []string{"movies"},
+		Parameters:  []apiParameter{contentEncodingParameter()},
+		RequestBody: bodyRequest(schemaRef("MovieInput")),
+		Responses: map[string]apiResponse{
+			"201": bodyResponse("Id of the created movie", schemaRef("CreatedMovie")),
+			"400": errorResponse("Body is malformed"),
+			"413": errorResponse("Decompressed body is too large"),
+			"415": errorResponse("Content-Type or Content-Encoding of the body is not supported"),
+			"422": errorResponse("Movie was not created, e.g. genres are missing or rating is out of range"),
+		},
+	},
+	"PUT /movies/{id}": {
+		OperationID: "updateMovie",
+		Summary:     "Update movie",
+		Description: "Only provided fields are updated, empty genres remove all genres of the movie.",
+		Tags:        []string{"movies"},
+		Parameters:  []apiParameter{idParameter("id of the movie"), contentEncodingParameter()},
+		RequestBody: bodyRequest(schemaRef("MovieInput")),
+		Responses: map[string]apiResponse{
+			"204": {Description: "Movie was updated"},
+			"400": errorResponse("Body is malformed"),
+			"413": errorResponse("Decompressed body is too large"),
+			"415": errorResponse("Content-Type or Content-Encoding of the body is not supported"),
+			"422": errorResponse("Movie does not exist, id is malformed or no fields were provided"),
+		},
+	},
+	"DELETE /movies/{id}": {
+		OperationID: "deleteMovie",
+		Summary:     "Delete movie",
+		Tags:        []string{"movies"},
+		Parameters:  []apiParameter{idParameter("id of the movie")},
+		Responses: map[string]apiResponse{
+			"204": {Description: "Movie was deleted"},
+			"422": errorResponse("Movie does not exist or id is malformed"),
+		},
+	},
+	"GET /movies/stream": {
+		OperationID: "streamMovieEvents",
+		Summary:     "Stream movie change events",
+		Description: "Server-Sent Events, id of every message is the event id, event is the event type " +
+			"and data is the Event as JSON. Missed events are sent first, if Last-Event-ID header is provided.",
+		Tags: []string{"events"},
+		Parameters: []apiParameter{{
+			Name:        "Last-Event-ID",
+			In:          "header",
+			Description: "id of the last received event",
+			Schema:      map[string]any{"type": "integer", "format": "int64", "minimum": 0},
+		}},
+		Responses: map[string]apiResponse{
+			"200": {
+				Description: "Stream of events",
+				Content:     map[string]apiMediaType{"text/event-stream": {Schema: map[string]any{"type": "string"}}},
+			},
+			"400": jsonResponse("Last-Event-ID is not a number", schemaRef("Error")),
+		},
+	},
+	"GET /movies/ws": {
+		OperationID: "subscribeMovieEvents",
+		Summary:     "Subscribe to movie change events over WebSocket",
+		Description: `Client sends {"type": "subscribe" | "unsubscribe", "topics": [...]} messages with ` +
+			`"movies", "movie:<id>" or "genre:<genre>" topics, and receives subscribed, unsubscribed, ` +
+			"event or error messages.",
+		Tags: []string{"events"},
+		Responses: map[string]apiResponse{
+			"101": {Description: "Connection is upgraded to WebSocket"},
+			"400": {Description: "Request is not a valid WebSocket handshake"},
+			"403": {Description: "Cross-origin request"},
+		},
+	},
+	"GET /graphql": {
+		OperationID: "queryGraphQL",
+		Summary:     "Execute GraphQL query",
+		Tags:        []string{"graphql"},
+		Parameters: []apiParameter{
+			{Name: "query", In: "query", Required: true, Schema: map[string]any{"type": "string"}},
+			{Name: "operationName", In: "query", Schema: map[string]any{"type": "string"}},
+			{Name: "variables", In: "query", Description: "JSON object", Schema: map[string]any{"type": "string"}},
+		},
+		Responses: map[string]apiResponse{
+			"200": jsonResponse("Result of the query", schemaRef("GraphQLResponse")),
+			"400": jsonResponse("Query is invalid or exceeds limits", schemaRef("GraphQLResponse")),
+			"405": jsonResponse("Mutation was sent with GET method", schemaRef("GraphQLResponse")),
+		},
+	},
+	"POST /graphql": {
+		OperationID: "executeGraphQL",
+		Summary:     "Execute GraphQL query or mutation",
+		Tags:        []string{"graphql"},
+		RequestBody: jsonBody(schemaRef("GraphQLRequest")),
+		Responses: map[string]apiResponse{
+			"200": jsonResponse("Result of the operation", schemaRef("GraphQLResponse")),
+			"400": jsonResponse("Operation is invalid or exceeds limits", schemaRef("GraphQLResponse")),
+		},
+	},
+	"POST /webhooks": {
+		OperationID: "createWebhook",
+		Summary:     "Create webhook subscription",
+		Description: "Secret is generated, if it is not provided, and returned only in this response.",
+		Tags:        []string{"webhooks"},
+		RequestBody: bodyRequest(schemaRef("WebhookSubscriptionInput")),
+		Responses: map[string]apiResponse{
+			"201": bodyResponse("Created subscription with its secret", schemaRef("WebhookSubscription")),
+			"400": errorResponse("Body is not a valid subscription"),
+			"415": errorResponse("Content-Type of the body is not supported"),
+			"422": errorResponse("Subscription was not created"),
+		},
+	},
+	"GET /webhooks": {
+		OperationID: "getWebhooks",
+		Summary:     "Get webhook subscriptions",
+		Tags:        []string{"webhooks"},
+		Responses: map[string]apiResponse{
+			"200": bodyResponse("All subscriptions without secrets", map[string]any{
+				"type":  "array",
+				"items": schemaRef("WebhookSubscription"),
+			}),
+			"422": errorResponse("Subscriptions were not fetched"),
+		},
+	},
+	"DELETE /webhooks/{id}": {
+		OperationID: "deleteWebhook",
+		Summary:     "Delete webhook subscription",
+		Tags:        []string{"webhooks"},
+		Parameters:  []apiParameter{idParameter("id of the subscription")},
+		Responses: map[string]apiResponse{
+			"204": {Description: "Subscription was deleted along with its deliveries"},
+			"404": errorResponse("Subscription does not exist"),
+			"422": errorResponse("Subscription was not deleted"),
+		},
+	},
+	"GET /webhooks/{id}/deliveries": {
+		OperationID: "getWebhookDeliveries",
+		Summary:     "Get the latest deliveries of webhook subscription",
+		Tags:        []string{"webhooks"},
+		Parameters: []apiParameter{
+			idParameter("id of the subscription"),
+			{
+				Name:   "limit",
+				In:     "query",
+				Schema: map[string]any{"type": "integer", "minimum": 1, "maximum": 1000, "default": 50},
+			},
+		},
+		Responses: map[string]apiResponse{
+			"200": bodyResponse("Deliveries, newest first", map[string]any{
+				"type":  "array",
+				"items": schemaRef("WebhookDelivery"),
+			}),
+			"400": errorResponse("Limit is out of range"),
+			"404": errorResponse("Subscription does not exist"),
+			"422": errorResponse("Deliveries were not fetched"),
+		},
+	},
+	"GET /openapi.json": {
+		OperationID: "getOpenAPI",
+		Summary:     "Get OpenAPI document",
+		Tags:        []string{"docs"},
+		Responses: map[string]apiResponse{
+			"200": jsonResponse("OpenAPI document of the enabled endpoints", map[string]any{"type": "object"}),
+		},
+	},
+	"GET /docs": {
+		OperationID: "getDocs",
+		Summary:     "Get API documentation page",
+		Tags:        []string{"docs"},
+		Responses: map[string]apiResponse{
+			"200": {
+				Description: "HTML page rendering the OpenAPI document",
+				Content:     map[string]apiMediaType{"text/html": {Schema: map[string]any{"type": "string"}}},
+			},
+		},
+	},
+}
+
+// movieProperties are the properties of the Movie type, see types.go.
+func movieProperties(rating map[string]any) map[string]any {
+	return map[string]any{
+		"name":         map[string]any{"type": "string"},
+		"release_year": map[string]any{"type": "integer"},
+		"rating":       rating,
+		"genres":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"director":     map[string]any{"type": "string"},
+	}
+}
+
+// storedMovieProperties returns properties of the movie returned by the Server.
+func storedMovieProperties() map[string]any {
+	return mergeProperties(movieProperties(map[string]any{
+		"type":        "string",
+		"pattern":     `^-?\d{1,2}(\.\d)?$`,
+		"description": "decimal number with one digit after the point",
+		"examples":    []string{"8.5"},
+	}), map[string]any{
+		"id": map[string]any{"type": "string", "format": "uuid"},
+	})
+}
+
+// apiSchemas are the schemas of the request and response bodies.
+var apiSchemas = map[string]any{
+	"Movie": map[string]any{
+		"type":       "object",
+		"required":   []string{"id", "name", "release_year", "rating", "genres", "director"},
+		"properties": storedMovieProperties(),
+	},
+	"PartialMovie": map[string]any{
+		"type":        "object",
+		"description": "Movie with only the fields requested by fields query parameter.",
+		"properties":  storedMovieProperties(),
+	},
+	"MovieInput": map[string]any{
+		"type":        "object",
+		"description": "All fields are required to create movie, id is generated.",
+		"properties": movieProperties(map[string]any{
+			"type":        []string{"string", "number"},
+			"description": "decimal number, rounded to one digit after the point, less than 100 by absolute value",
+		}),
+	},
+	"CreatedMovie": map[string]any{
+		"type":       "object",
+		"required":   []string{"id"},
+		"properties": map[string]any{"id": map[string]any{"type": "string", "format": "uuid"}},
+	},
+	"Error": map[string]any{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": map[string]any{
+			"error": map[string]any{"type": "string"},
+			"code": map[string]any{
+				"type":        "string",
+				"description": "Machine-readable code of the error, if clients may handle it",
+				"enum":        []string{"movie_not_found", "nothing_to_update", "subscription_not_found"},
+			},
+		},
+	},
+	"Problem": map[string]any{
+		"type":        "object",
+		"description": "RFC 9457 problem details",
+		"required":    []string{"type", "title", "status"},
+		"properties": map[string]any{
+			"type":     map[string]any{"type": "string"},
+			"title":    map[string]any{"type": "string"},
+			"status":   map[string]any{"type": "integer"},
+			"detail":   map[string]any{"type": "string"},
+			"instance": map[string]any{"type": "string"},
+		},
+	},
+	"Event": map[string]any{
+		"type":     "object",
+		"required": []string{"id", "type", "movie_id", "occurred_at"},
+		"properties": map[string]any{
+			"id":          map[string]any{"type": "integer", "format": "int64"},
+			"type":        map[string]any{"type": "string", "enum": []EventType{MovieCreated, MovieUpdated, MovieDeleted}},
+			"movie_id":    map[string]any{"type": "string", "format": "uuid"},
+			"movie":       mergeProperties(schemaRef("Movie"), map[string]any{"description": "not set for deleted movies"}),
+			"occurred_at": map[string]any{"type": "string", "format": "date-time"},
+		},
+	},
+	"WebhookSubscriptionInput": map[string]any{
+		"type":     "object",
+		"required": []string{"url"},
+		"properties": map[string]any{
+			"url":    map[string]any{"type": "string", "format": "uri"},
+			"secret": map[string]any{"type": "string"},
+			"event_types": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "string", "enum": []EventType{MovieCreated, MovieUpdated, MovieDeleted}},
+			},
+			"genres": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	},
+	"WebhookSubscription": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":          map[string]any{"type": "string", "format": "uuid"},
+			"url":         map[string]any{"type": "string", "format": "uri"},
+			"secret":      map[string]any{"type": "string", "description": "returned only on create"},
+			"event_types": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"genres":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"created_at":  map[string]any{"type": "string", "format": "date-time"},
+		},
+	},
+	"WebhookDelivery": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":              map[string]any{"type": "integer", "format": "int64"},
+			"subscription_id": map[string]any{"type": "string", "format": "uuid"},
+			"event":           schemaRef("Event"),
+			"state": map[string]any{
+				"type": "string",
+				"enum": []DeliveryState{DeliveryPending, DeliveryDelivered, DeliveryDead},
+			},
+			"attempts":        map[string]any{"type": "integer"},
+			"last_status":     map[string]any{"type": "integer"},
+			"last_error":      map[string]any{"type": "string"},
+			"next_attempt_at": map[string]any{"type": "string", "format": "date-time"},
+			"created_at":      map[string]any{"type": "string", "format": "date-time"},
+			"updated_at":      map[string]any{"type": "string", "format": "date-time"},
+		},
+	},
+	"GraphQLRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"query"},
+		"properties": map[string]any{
+			"query":         map[string]any{"type": "string"},
+			"operationName": map[string]any{"type": "string"},
+			"variables":     map[string]any{"type": "object"},
+		},
+	},
+	"GraphQLResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"data": map[string]any{"type": []string{"object", "null"}},
+			"errors": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"message": map[string]any{"type": "string"}},
+				},
+			},
+		},
+	},
+}
+
+// mergeProperties returns a new map with the keys of both maps.
+func mergeProperties(a, b map[string]any) map[string]any {
+	res := map[string]any{}
+	for k, v := range a {
+		res[k] = v
+	}
+	for k, v := range b {
+		res[k] = v
+	}
+	return res
+}
+
+// openAPIDocument returns OpenAPI 3.1 document, describing routes served by the Server.
+// Every operation can respond with 500 problem details, written by the Recover middleware,
+// and every API operation responds with 406, if unsupported version is requested.
+// Unversioned aliases of the API operations are marked as deprecated.
+func (s Server) openAPIDocument() map[string]any {
+	paths := map[string]map[string]apiOperation{}
+	add := func(path, method string, op apiOperation, extra map[string]apiResponse) {
+		responses := map[string]apiResponse{
+			"500": {
+				Description: "Internal error",
+				Content: map[string]apiMediaType{
+					"application/problem+json": {Schema: schemaRef("Problem")},
+				},
+			},
+		}
+		for status, res := range extra {
+			responses[status] = res
+		}
+		for status, res := range op.Responses {
+			responses[status] = res
+		}
+		op.Responses = responses
+
+		if paths[path] == nil {
+			paths[path] = map[string]apiOperation{}
+		}
+		paths[path][strings.ToLower(method)] = op
+	}
+
+	notAcceptable := map[string]apiResponse{
+		"406": jsonResponse("Requested version of the API or media type is not supported", schemaRef("Error")),
+	}
+	for _, r := range s.apiRoutes() {
+		op, ok := apiOperations[r.pattern()]
+		if !ok {
+			continue
+		}
+		add(apiVersionPrefix+r.path, r.method, op, notAcceptable)
+		add(r.path, r.method, deprecatedOperation(op), notAcceptable)
+	}
+	for _, r := range s.docsRoutes() {
+		add(r.path, r.method, apiOperations[r.pattern()], nil)
+	}
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Movie Microservice",
+			"version": strconv.Itoa(apiVersion),
+			"description": "CRUD operations on movies, change events and webhooks. Version of the API is selected " +
+				"by the path prefix, e.g. " + apiVersionPrefix + "/movies, or by Accept header, e.g. " +
+				"application/vnd.movies.v1+json or application/json; version=1.",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": apiSchemas},
+	}
+}
+
+// deprecatedOperation returns the operation of the unversioned alias, which responses
+// have deprecation headers, unless version is requested by Accept header.
+func deprecatedOperation(op apiOperation) apiOperation {
+	op.OperationID += "Unversioned"
+	op.Deprecated = true
+	op.Description = strings.TrimSpace("Deprecated alias of " + apiVersionPrefix + " endpoint. " + op.Description)
+	responses := map[string]apiResponse{}
+	for status, res := range op.Responses {
+		headers := map[string]apiHeader{}
+		for name, h := range res.Headers {
+			headers[name] = h
+		}
+		headers["Deprecation"] = apiHeader{
+			Description: "Date since which the endpoint is deprecated, e.g. @1792281600",
+			Schema:      map[string]any{"type": "string"},
+		}
+		headers["Sunset"] = apiHeader{
+			Description: "Date after which the endpoint may stop responding",
+			Schema:      map[string]any{"type": "string"},
+		}
+		headers["Link"] = apiHeader{
+			Description: "Link to the versioned endpoint with successor-version relation",
+			Schema:      map[string]any{"type": "string"},
+		}
+		res.Headers = headers
+		responses[status] = res
+	}
+	op.Responses = responses
+	return op
+}
+
+// handleOpenAPI writes OpenAPI document of the enabled endpoints.
+func (s Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, s.openAPIDocument())
+}
+
+// handleDocs writes the page, that renders OpenAPI document.
+func (s Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(docsPage)
+}
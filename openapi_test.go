@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// openAPIParameter is a parameter of the decoded operation.
+type openAPIParameter struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+// openAPISpec is a part of the OpenAPI document, checked against the routes.
+type openAPISpec struct {
+	Paths map[string]map[string]struct {
+		Parameters []openAPIParameter `json:"parameters"`
+		Responses  map[string]any     `json:"responses"`
+	} `json:"paths"`
+	Components struct {
+		Schemas map[string]any `json:"schemas"`
+	} `json:"components"`
+}
+
+// fullServer returns the Server with all optional endpoints enabled.
+func fullServer() Server {
+	return NewServer(nil).
+		WithWebhooks(NewMemoryWebhookStore()).
+		WithEventStream(NewEventBroker(0), nil, StreamOptions{}).
+		WithWebSocket(NewTopicRouter(0), WebSocketOptions{}).
+		WithGraphQL(&GraphQL{})
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	s := fullServer()
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status; expected: %d, got: %d", http.StatusOK, w.Code)
+	}
+	raw := w.Body.String()
+	spec := openAPISpec{}
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+		t.Fatalf("error decoding document: %v", err)
+	}
+
+	pathParam := regexp.MustCompile(`\{(\w+)\}`)
+	patterns := map[string]bool{}
+	described := map[string]bool{}
+	for _, r := range s.routes() {
+		patterns[r.pattern()] = true
+		described[r.method+" "+strings.TrimPrefix(r.path, apiVersionPrefix)] = true
+		op, ok := spec.Paths[r.path][strings.ToLower(r.method)]
+		if !ok {
+			t.Errorf("route is not documented: %s", r.pattern())
+			continue
+		}
+		for _, m := range pathParam.FindAllStringSubmatch(r.path, -1) {
+			if !slices.Contains(op.Parameters, openAPIParameter{Name: m[1], In: "path"}) {
+				t.Errorf("path parameter %q of %s is not documented", m[1], r.pattern())
+			}
+		}
+		if _, ok := op.Responses["500"]; !ok {
+			t.Errorf("500 response of %s is not documented", r.pattern())
+		}
+		if _, ok := op.Responses["406"]; !ok && strings.HasPrefix(r.path, apiVersionPrefix) {
+			t.Errorf("406 response of %s is not documented", r.pattern())
+		}
+	}
+
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if !patterns[strings.ToUpper(method)+" "+path] {
+				t.Errorf("documented operation has no route: %s %s", method, path)
+			}
+		}
+	}
+	for pattern := range apiOperations {
+		if !described[pattern] {
+			t.Errorf("described operation has no route: %s", pattern)
+		}
+	}
+
+	for _, m := range regexp.MustCompile(`"\$ref":"#/components/schemas/(\w+)"`).FindAllStringSubmatch(raw, -1) {
+		if _, ok := spec.Components.Schemas[m[1]]; !ok {
+			t.Errorf("referenced schema does not exist: %s", m[1])
+		}
+	}
+}
+
+func TestOpenAPIOmitsDisabledRoutes(t *testing.T) {
+	spec := NewServer(nil).openAPIDocument()
+	paths := spec["paths"].(map[string]map[string]apiOperation)
+	for _, path := range []string{"/v1/webhooks", "/graphql", "/v1/movies/stream", "/movies/ws"} {
+		if _, ok := paths[path]; ok {
+			t.Errorf("disabled route is documented: %s", path)
+		}
+	}
+	if _, ok := paths["/v1/movies/{id}"]["put"]; !ok {
+		t.Errorf("PUT /v1/movies/{id} is not documented")
+	}
+	if op := paths["/movies/{id}"]["put"]; !op.Deprecated {
+		t.Errorf("unversioned PUT /movies/{id} is not deprecated")
+	}
+}
+
+func TestDocs(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewServer(nil).Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("wrong response; expected: %d text/html, got: %d %s", http.StatusOK, w.Code, ct)
+	}
+	if !strings.Contains(w.Body.String(), `spec-url="/openapi.json"`) {
+		t.Errorf("docs page does not reference the document")
+	}
+}
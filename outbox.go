@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// outboxLockKey is the key of the PostgreSql advisory lock, that allows only one relay
+// to publish events at a time, so events of the same movie are never published out of order.
+const outboxLockKey int64 = 7_215_640_119
+
+// EventType is the type of the movie change event.
+type EventType string
+
+const (
+	MovieCreated EventType = "MovieCreated"
+	MovieUpdated EventType = "MovieUpdated"
+	MovieDeleted EventType = "MovieDeleted"
+)
+
+// Event describes a single change of the movie. Events are written into the outbox table
+// in the same transaction as the change, and ID is their sequence number.
+// Movie contains the state of the movie after the change, it is nil for MovieDeleted.
+type Event struct {
+	ID         int64     `json:"id" xml:"id"`
+	Type       EventType `json:"type" xml:"type"`
+	MovieID    uuid.UUID `json:"movie_id" xml:"movie_id"`
+	Movie      *Movie    `json:"movie,omitempty" xml:"movie,omitempty"`
+	OccurredAt time.Time `json:"occurred_at" xml:"occurred_at"`
+}
+
+// writeEvent inserts the event into the outbox table using provided transaction.
+// Id of the event is sent to the events channel, listeners receive it once transaction is committed.
+func writeEvent(ctx context.Context, tx pgx.Tx, eventType EventType, movieId any, movie *Movie) error {
+	var payload []byte
+	if movie != nil {
+		var err error
+		payload, err = json.Marshal(movie)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(
+		ctx,
+		`with e as (
+			insert into outbox(aggregate_id, event_type, payload) values ($1, $2, $3) returning id
+		)
+		select pg_notify('`+eventsChannel+`', id::text) from e`,
+		movieId,
+		string(eventType),
+		payload,
+	)
+	if err != nil {
+		return fmt.Errorf("error writing %s event: %v", eventType, err)
+	}
+	return nil
+}
+
+// EventSink is responsible for publishing events to the downstream services.
+type EventSink interface {
+	// Publish delivers the event, it is retried by the relay until nil is returned,
+	// so the same event can be published more than once.
+	Publish(ctx context.Context, event Event) error
+}
+
+// LogSink is an EventSink, that writes every event into the log.
+type LogSink struct {
+	logger *slog.Logger
+}
+
+// NewLogSink creates an instance of the LogSink.
+func NewLogSink(logger *slog.Logger) EventSink {
+	return LogSink{
+		logger: logger,
+	}
+}
+
+func (s LogSink) Publish(ctx context.Context, event Event) error {
+	s.logger.LogAttrs(
+		ctx,
+		slog.LevelInfo,
+		"event published",
+		slog.Int64("event_id", event.ID),
+		slog.String("event_type", string(event.Type)),
+		slog.String("movie_id", event.MovieID.String()),
+	)
+	return nil
+}
+
+// WebhookSink is an EventSink, that sends every event as JSON in the POST request.
+// Event id is sent in the Idempotency-Key header, so receiver can drop duplicates.
+type WebhookSink struct {
+	client *http.Client
+	url    string
+}
+
+// NewWebhookSink creates an instance of the WebhookSink.
+func NewWebhookSink(client *http.Client, url string) EventSink {
+	return WebhookSink{
+		client: client,
+		url:    url,
+	}
+}
+
+func (s WebhookSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.FormatInt(event.ID, 10))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		// Error is logged by the relay, so secrets of the URL are hidden.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = maskSecret(urlErr.URL)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// BrokerPublisher is responsible for sending messages to the message broker, e.g. NATS or Kafka.
+// Key is the movie id, brokers with partitions should use it to keep events of the same movie
+// in the same partition.
+type BrokerPublisher interface {
+	Publish(ctx context.Context, topic string, key string, data []byte) error
+}
+
+// BrokerSink is an EventSink, that adapts BrokerPublisher. Events are published as JSON
+// to the topic consisting of the prefix and event type, e.g. movies.MovieCreated.
+type BrokerSink struct {
+	publisher BrokerPublisher
+	prefix    string
+}
+
+// NewBrokerSink creates an instance of the BrokerSink.
+func NewBrokerSink(publisher BrokerPublisher, prefix string) EventSink {
+	return BrokerSink{
+		publisher: publisher,
+		prefix:    prefix,
+	}
+}
+
+func (s BrokerSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(ctx, s.prefix+"."+string(event.Type), event.MovieID.String(), data)
+}
+
+// RelayOptions describes how often and how many events are published by the OutboxRelay.
+type RelayOptions struct {
+	// BatchSize is the maximum number of events fetched at once.
+	BatchSize int
+	// PollInterval is the delay between fetches, when there are no pending events.
+	PollInterval time.Duration
+	// RetryBackoff is the delay before the second attempt to publish the event,
+	// it is doubled for every next one, but never exceeds MaxRetryBackoff.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// MaxAttempts is the number of attempts, after which the event becomes dead
+	// and is not published anymore.
+	MaxAttempts int
+	// PublishTimeout is the maximum duration of publishing a batch. Events, which are claimed
+	// and not marked for twice as long, e.g. since relay crashed, are claimed again.
+	PublishTimeout time.Duration
+	// Retention is the time, after which published and dead events are removed,
+	// they are kept forever, if it is zero.
+	Retention time.Duration
+}
+
+// outboxPruneInterval is the delay between removals of the events older than retention.
+const outboxPruneInterval = 10 * time.Minute
+
+// OutboxRelay publishes events from the outbox table to the EventSink at least once.
+// Events are published in order of their ids. If publishing of the event fails, it is retried
+// with exponential backoff, and the following events of the same movie wait for it,
+// while events of the other movies are published. Event, which was not published after
+// the maximum number of attempts, becomes dead and does not block the following ones.
+type OutboxRelay struct {
+	conn   databaseConn
+	sink   EventSink
+	opts   RelayOptions
+	logger *slog.Logger
+}
+
+// NewOutboxRelay creates an instance of the OutboxRelay.
+func NewOutboxRelay(conn databaseConn, sink EventSink, opts RelayOptions, logger *slog.Logger) OutboxRelay {
+	return OutboxRelay{
+		conn:   conn,
+		sink:   sink,
+		opts:   opts,
+		logger: logger,
+	}
+}
+
+// Run publishes pending events until ctx is canceled.
+// Published and dead events older than retention are removed periodically.
+func (r OutboxRelay) Run(ctx context.Context) error {
+	var pruned time.Time
+	for {
+		if r.opts.Retention > 0 && time.Since(pruned) >= outboxPruneInterval {
+			n, err := r.prune(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Error("error removing old events", slog.String("error", err.Error()))
+			}
+			if n > 0 {
+				r.logger.Info("old events removed", slog.Int64("count", n))
+			}
+			pruned = time.Now()
+		}
+
+		n, err := r.relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("error relaying events", slog.String("error", err.Error()))
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+// prune removes published and dead events older than retention in batches,
+// so the outbox is not locked for long, and returns the number of removed ones.
+func (r OutboxRelay) prune(ctx context.Context) (int64, error) {
+	q := `
+	with removed as (
+		delete from outbox where id in (
+			select id from outbox
+			where published_at < now() - make_interval(secs => $1)
+			or dead_at < now() - make_interval(secs => $1)
+			limit $2
+		)
+		returning 1
+	)
+	select count(*) from removed
+	`
+	var total int64
+	for {
+		var n int64
+		err := r.conn.QueryRow(ctx, q, r.opts.Retention.Seconds(), r.opts.BatchSize).Scan(&n)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(r.opts.BatchSize) {
+			return total, nil
+		}
+	}
+}
+
+// outboxRow is a pending event with the state of its delivery.
+type outboxRow struct {
+	event    Event
+	attempts int
+	err      error
+}
+
+// relay publishes a single batch of pending events and returns the number of published ones.
+// Batch is claimed and the results are stored in separate short transactions,
+// so no transaction is open, while events are published.
+func (r OutboxRelay) relay(ctx context.Context) (int, error) {
+	claimed, err := r.claim(ctx)
+	if err != nil || len(claimed) == 0 {
+		return 0, err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.opts.PublishTimeout)
+	defer cancel()
+	// blocked contains movies, which events were not published, so the following ones wait.
+	blocked := map[uuid.UUID]bool{}
+	published, released, failed := []int64{}, []int64{}, []outboxRow{}
+	for _, row := range claimed {
+		ev := row.event
+		if blocked[ev.MovieID] {
+			released = append(released, ev.ID)
+			continue
+		}
+		row.err = r.sink.Publish(publishCtx, ev)
+		if row.err == nil {
+			published = append(published, ev.ID)
+			continue
+		}
+		blocked[ev.MovieID] = true
+		row.attempts++
+		failed = append(failed, row)
+	}
+
+	if err := r.mark(ctx, published, released, failed); err != nil {
+		return 0, err
+	}
+	return len(published), nil
+}
+
+// claim fetches the batch of due events in transaction holding the relay lock,
+// so concurrent relays skip it, and postpones their next attempt, so they are not
+// claimed again, while being published.
+func (r OutboxRelay) claim(ctx context.Context) (claimed []outboxRow, err error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		switch err {
+		case nil:
+			err = tx.Commit(ctx)
+		default:
+			tx.Rollback(ctx)
+		}
+	}()
+
+	locked := false
+	err = tx.QueryRow(ctx, "select pg_try_advisory_xact_lock($1)", outboxLockKey).Scan(&locked)
+	if err != nil || !locked {
+		return
+	}
+
+	claimed, err = r.pending(ctx, tx)
+	if err != nil || len(claimed) == 0 {
+		return
+	}
+	ids := make([]int64, len(claimed))
+	for i, row := range claimed {
+		ids[i] = row.event.ID
+	}
+	_, err = tx.Exec(
+		ctx,
+		"update outbox set next_attempt_at = now() + make_interval(secs => $1) where id = any($2)",
+		(2 * r.opts.PublishTimeout).Seconds(),
+		ids,
+	)
+	return
+}
+
+// mark stores the results of publishing: published events are marked as such, events, which
+// were not published after the failed ones, are released, and failed ones are scheduled for
+// retry or become dead.
+func (r OutboxRelay) mark(ctx context.Context, published, released []int64, failed []outboxRow) (err error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		switch err {
+		case nil:
+			err = tx.Commit(ctx)
+		default:
+			tx.Rollback(ctx)
+		}
+	}()
+
+	if len(published) > 0 {
+		_, err = tx.Exec(
+			ctx,
+			"update outbox set published_at = now(), next_attempt_at = null where id = any($1)",
+			published,
+		)
+		if err != nil {
+			return
+		}
+	}
+	if len(released) > 0 {
+		_, err = tx.Exec(ctx, "update outbox set next_attempt_at = null where id = any($1)", released)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, row := range failed {
+		ev := row.event
+		attrs := []slog.Attr{
+			slog.Int64("event_id", ev.ID),
+			slog.String("movie_id", ev.MovieID.String()),
+			slog.Int("attempt", row.attempts),
+			slog.String("error", row.err.Error()),
+		}
+		if row.attempts >= r.opts.MaxAttempts {
+			r.logger.LogAttrs(ctx, slog.LevelError, "event is dead", attrs...)
+			_, err = tx.Exec(
+				ctx,
+				"update outbox set attempts = $1, last_error = $2, next_attempt_at = null, dead_at = now() where id = $3",
+				row.attempts,
+				row.err.Error(),
+				ev.ID,
+			)
+		} else {
+			delay := r.backoff(row.attempts)
+			attrs = append(attrs, slog.Duration("retry_in", delay))
+			r.logger.LogAttrs(ctx, slog.LevelWarn, "event was not published", attrs...)
+			_, err = tx.Exec(
+				ctx,
+				"update outbox set attempts = $1, last_error = $2, next_attempt_at = $3 where id = $4",
+				row.attempts,
+				row.err.Error(),
+				time.Now().Add(delay),
+				ev.ID,
+			)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// pending fetches the batch of due events ordered by id. Events, which follow the events
+// of the same movie waiting for retry or being published, are not due.
+func (r OutboxRelay) pending(ctx context.Context, tx pgx.Tx) ([]outboxRow, error) {
+	q := `
+	select id, aggregate_id, event_type, payload, created_at, attempts
+	from outbox o
+	where published_at is null and dead_at is null
+	and (next_attempt_at is null or next_attempt_at <= now())
+	and not exists (
+		select 1 from outbox p
+		where p.aggregate_id = o.aggregate_id and p.id < o.id
+		and p.published_at is null and p.dead_at is null and p.next_attempt_at > now()
+	)
+	order by id
+	limit $1
+	`
+	rows, err := tx.Query(ctx, q, r.opts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []outboxRow{}
+	for rows.Next() {
+		row := outboxRow{}
+		var eventType string
+		var payload []byte
+		err := rows.Scan(
+			&row.event.ID,
+			&row.event.MovieID,
+			&eventType,
+			&payload,
+			&row.event.OccurredAt,
+			&row.attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		row.event.Type = EventType(eventType)
+		if payload != nil {
+			row.event.Movie = &Movie{}
+			if err := json.Unmarshal(payload, row.event.Movie); err != nil {
+				return nil, fmt.Errorf("error decoding payload of event %d: %v", row.event.ID, err)
+			}
+		}
+		pending = append(pending, row)
+	}
+	return pending, rows.Err()
+}
+
+// backoff returns the delay before the next attempt to publish the event.
+func (r OutboxRelay) backoff(attempt int) time.Duration {
+	delay := r.opts.RetryBackoff
+	for i := 1; i < attempt && delay < r.opts.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.opts.MaxRetryBackoff)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/pashagolub/pgxmock/v3"
+)
+
+// recordingSink is an EventSink, that records published events and fails for the movies in fail.
+type recordingSink struct {
+	published []Event
+	fail      map[uuid.UUID]bool
+}
+
+func (s *recordingSink) Publish(_ context.Context, event Event) error {
+	if s.fail[event.MovieID] {
+		return errors.New("sink is unavailable")
+	}
+	s.published = append(s.published, event)
+	return nil
+}
+
+func TestOutboxRelayOrderingPerMovie(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	failing, other := testUUID(t), testUUID(t)
+	sink := &recordingSink{fail: map[uuid.UUID]bool{failing: true}}
+	r := NewOutboxRelay(mock, sink, testRelayOptions(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	payload, _ := json.Marshal(testMovie())
+	now := time.Now()
+	rows := pgxmock.NewRows(testOutboxColumns()).
+		AddRow(int64(1), failing, string(MovieCreated), payload, now, 0).
+		AddRow(int64(2), other, string(MovieCreated), payload, now, 0).
+		AddRow(int64(3), failing, string(MovieDeleted), nil, now, 0)
+	mock.ExpectBegin()
+	expectOutboxLock(mock, true)
+	mock.ExpectQuery("from outbox").WithArgs(testRelayOptions().BatchSize).WillReturnRows(rows)
+	mock.ExpectExec("update outbox set next_attempt_at").
+		WithArgs(pgxmock.AnyArg(), []int64{1, 2, 3}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 3))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("update outbox set published_at").
+		WithArgs([]int64{2}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("update outbox set next_attempt_at = null").
+		WithArgs([]int64{3}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("update outbox set attempts").
+		WithArgs(1, "sink is unavailable", pgxmock.AnyArg(), int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	n, err := r.relay(context.Background())
+	if err != nil {
+		t.Fatalf("error relaying: %v", err)
+	}
+	if n != 1 || len(sink.published) != 1 || sink.published[0].ID != 2 {
+		t.Errorf("only event 2 was expected to be published, got: %+v", sink.published)
+	}
+	if sink.published[0].Movie == nil || sink.published[0].Movie.Name != testMovie().Name {
+		t.Errorf("payload was not decoded: %+v", sink.published[0])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxRelayDeadEvent(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	id := testUUID(t)
+	sink := &recordingSink{fail: map[uuid.UUID]bool{id: true}}
+	r := NewOutboxRelay(mock, sink, testRelayOptions(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	attempts := testRelayOptions().MaxAttempts - 1
+	rows := pgxmock.NewRows(testOutboxColumns()).
+		AddRow(int64(1), id, string(MovieDeleted), nil, time.Now(), attempts)
+	mock.ExpectBegin()
+	expectOutboxLock(mock, true)
+	mock.ExpectQuery(`next_attempt_at <= now\(\)`).WithArgs(testRelayOptions().BatchSize).WillReturnRows(rows)
+	mock.ExpectExec("update outbox set next_attempt_at").
+		WithArgs(pgxmock.AnyArg(), []int64{1}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`dead_at = now\(\)`).
+		WithArgs(attempts+1, "sink is unavailable", int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	if n, err := r.relay(context.Background()); n != 0 || err != nil {
+		t.Fatalf("nothing was expected to be relayed; got: %d, err: %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxRelaySkipsWithoutLock(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	r := NewOutboxRelay(mock, &recordingSink{}, testRelayOptions(), slog.Default())
+
+	mock.ExpectBegin()
+	expectOutboxLock(mock, false)
+	mock.ExpectCommit()
+
+	if n, err := r.relay(context.Background()); n != 0 || err != nil {
+		t.Errorf("nothing was expected to be relayed; got: %d, err: %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxRelayPrune(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	opts := testRelayOptions()
+	opts.Retention = 24 * time.Hour
+	r := NewOutboxRelay(mock, &recordingSink{}, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Full batch is followed by the next one, until fewer events are removed.
+	for _, n := range []int64{10, 3} {
+		mock.ExpectQuery(`delete from outbox where id in \(\s*select id from outbox\s*where published_at < now\(\) - make_interval\(secs => \$1\)\s*or dead_at < now\(\) - make_interval\(secs => \$1\)\s*limit \$2`).
+			WithArgs(opts.Retention.Seconds(), opts.BatchSize).
+			WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(n))
+	}
+	n, err := r.prune(context.Background())
+	if err != nil {
+		t.Fatalf("error pruning: %v", err)
+	}
+	if n != 13 {
+		t.Errorf("wrong number of removed events; expected: 13, got: %d", n)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxRelayRunPrunes(t *testing.T) {
+	mock := testPoolMock(t)
+	defer mock.Close()
+	opts := testRelayOptions()
+	opts.Retention = 24 * time.Hour
+	r := NewOutboxRelay(mock, &recordingSink{}, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mock.ExpectQuery("delete from outbox").
+		WithArgs(opts.Retention.Seconds(), opts.BatchSize).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(0)))
+	mock.ExpectBegin()
+	expectOutboxLock(mock, false)
+	mock.ExpectCommit()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("error running relay: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxRelayBackoff(t *testing.T) {
+	r := OutboxRelay{opts: testRelayOptions()}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, d := range expected {
+		if got := r.backoff(i + 1); got != d {
+			t.Errorf("wrong backoff for attempt %d; expected: %v, got: %v", i+1, d, got)
+		}
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := Event{}
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("Idempotency-Key"); key != "7" {
+			t.Errorf("wrong idempotency key; expected: 7, got: %s", key)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.Client(), srv.URL)
+	event := Event{ID: 7, Type: MovieDeleted, MovieID: testUUID(t)}
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatalf("error publishing: %v", err)
+	}
+	if received.ID != event.ID || received.MovieID != event.MovieID {
+		t.Errorf("wrong event received; expected: %+v, got: %+v", event, received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Publish(context.Background(), event); err == nil {
+		t.Errorf("error was expected for unsuccessful status")
+	}
+	// Secrets of the URL are not included in the error.
+	srv.Close()
+	sink = NewWebhookSink(srv.Client(), srv.URL+"?token=secret")
+	if err := sink.Publish(context.Background(), event); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("error with masked url was expected, got: %v", err)
+	}
+}
+
+func testRelayOptions() RelayOptions {
+	return RelayOptions{
+		BatchSize:       10,
+		PollInterval:    time.Second,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: 5 * time.Second,
+		MaxAttempts:     3,
+		PublishTimeout:  time.Second,
+	}
+}
+
+func testOutboxColumns() []string {
+	return []string{"id", "aggregate_id", "event_type", "payload", "created_at", "attempts"}
+}
+
+func expectOutboxLock(mock pgxmock.PgxPoolIface, locked bool) {
+	mock.ExpectQuery("pg_try_advisory_xact_lock").
+		WithArgs(outboxLockKey).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(locked))
+}
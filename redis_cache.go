@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyVersion is the version of the cached values format. It is a part of every key,
+// so instances with different formats do not read values written by each other.
+const redisKeyVersion = "v1"
+
+// RedisCache is a Redis implementation of the Cache interface, that is shared by all instances
+// of the service. Recently used values are kept in the in-process near cache as well,
+// deleted keys are published to the invalidation channel, so every instance drops them
+// from its near cache.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+	near   *lruCache
+}
+
+// NewRedisCache creates an instance of the RedisCache.
+// Run must be started, to receive invalidations from other instances.
+func NewRedisCache(client *redis.Client, opts CacheOptions) RedisCache {
+	return RedisCache{
+		client: client,
+		prefix: "movie-microservice:" + redisKeyVersion + ":",
+		ttl:    opts.TTL,
+		near:   newLRUCache(opts.Size, opts.TTL),
+	}
+}
+
+func (rc RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if v, ok := rc.near.get(key); ok {
+		return v, true, nil
+	}
+	v, err := rc.client.Get(ctx, rc.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	rc.near.set(key, v)
+	return v, true, nil
+}
+
+func (rc RedisCache) Set(ctx context.Context, key string, value []byte) error {
+	ttl := rc.ttl
+	if ttl < 0 {
+		ttl = 0
+	}
+	err := rc.client.Set(ctx, rc.prefix+key, value, ttl).Err()
+	if err != nil {
+		return err
+	}
+	rc.near.set(key, value)
+	return nil
+}
+
+// Delete removes keys from Redis and publishes them to the other instances.
+func (rc RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	rc.near.remove(keys...)
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = rc.prefix + key
+	}
+	_, err := rc.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, prefixed...)
+		pipe.Publish(ctx, rc.channel(), strings.Join(keys, "\n"))
+		return nil
+	})
+	return err
+}
+
+// Run receives invalidations from the other instances and removes invalidated keys
+// from the near cache, until ctx is canceled.
+func (rc RedisCache) Run(ctx context.Context, logger *slog.Logger) error {
+	sub := rc.client.Subscribe(ctx, rc.channel())
+	defer sub.Close()
+
+	// Receive waits for the subscription confirmation, so no invalidation is missed after Run started.
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			keys := strings.Split(msg.Payload, "\n")
+			rc.near.remove(keys...)
+			logger.Debug("cache keys invalidated", slog.Any("keys", keys))
+		}
+	}
+}
+
+func (rc RedisCache) channel() string {
+	return rc.prefix + "invalidations"
+}
+
+func (rc RedisCache) stats() (int, uint64) {
+	return rc.near.stats()
+}
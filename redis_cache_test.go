@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc := NewRedisCache(testRedisClient(t, mr), CacheOptions{Size: 10, TTL: time.Minute})
+
+	if _, ok, err := rc.Get(ctx, "key"); ok || err != nil {
+		t.Errorf("missing key was returned; err: %v", err)
+	}
+	if err := rc.Set(ctx, "key", []byte("value")); err != nil {
+		t.Fatalf("error setting: %v", err)
+	}
+	stored, err := mr.Get("movie-microservice:" + redisKeyVersion + ":key")
+	if err != nil || stored != "value" {
+		t.Errorf("value was not stored under versioned key; got: %q, err: %v", stored, err)
+	}
+	if ttl := mr.TTL("movie-microservice:" + redisKeyVersion + ":key"); ttl != time.Minute {
+		t.Errorf("wrong ttl; expected: %v, got: %v", time.Minute, ttl)
+	}
+
+	if err := rc.Delete(ctx, "key"); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	if _, ok, _ := rc.Get(ctx, "key"); ok {
+		t.Errorf("deleted key was returned")
+	}
+}
+
+func TestRedisCacheInvalidatesOtherInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mr := miniredis.RunT(t)
+	first := NewRedisCache(testRedisClient(t, mr), CacheOptions{Size: 10})
+	second := NewRedisCache(testRedisClient(t, mr), CacheOptions{Size: 10})
+
+	ready := make(chan struct{})
+	go func() {
+		for len(mr.PubSubChannels("")) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		close(ready)
+	}()
+	go first.Run(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	<-ready
+
+	first.Set(ctx, "key", []byte("old"))
+	// Value changed behind the near cache is not visible until invalidation.
+	mr.Set("movie-microservice:"+redisKeyVersion+":key", "new")
+	if v, _, _ := first.Get(ctx, "key"); string(v) != "old" {
+		t.Fatalf("value was not served from near cache; got: %s", v)
+	}
+
+	if err := second.Delete(ctx, "key"); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := first.near.get("key"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("near cache was not invalidated by other instance")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCachingServiceWithRedis(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	next := newCountingService()
+	first := NewCachingService(next, NewRedisCache(testRedisClient(t, mr), CacheOptions{Size: 10}))
+	// Second instance shares Redis, but has its own near cache.
+	second := NewCachingService(next, NewRedisCache(testRedisClient(t, mr), CacheOptions{Size: 10}))
+
+	id, _ := first.CreateMovie(ctx, testMovie())
+	first.GetMovie(ctx, id)
+	first.GetAllMovies(ctx)
+	second.GetMovie(ctx, id)
+	second.GetAllMovies(ctx)
+	if gets, lists := next.gets.Load(), next.lists.Load(); gets != 1 || lists != 1 {
+		t.Errorf("values were not shared; expected: 1 get and 1 list, got: %d and %d", gets, lists)
+	}
+
+	if _, err := first.CreateMovie(ctx, testMovie()); err != nil {
+		t.Fatalf("error creating: %v", err)
+	}
+	movies, _ := first.GetAllMovies(ctx)
+	if len(movies) != 2 {
+		t.Errorf("list was not invalidated; expected: 2 movies, got: %d", len(movies))
+	}
+}
+
+func testRedisClient(t *testing.T, mr *miniredis.Miniredis) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
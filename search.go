@@ -0,0 +1,108 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+// MovieFilter describes movies returned by search, empty fields match all movies.
+type MovieFilter struct {
+	// Query is matched against name and director, case insensitive.
+	Query string
+	// Genre is matched case insensitive.
+	Genre string
+	// Release years are inclusive.
+	MinReleaseYear int
+	MaxReleaseYear int
+	MinRating      *decimal.Decimal
+}
+
+// Matches reports, whether the movie passes all filters.
+func (f MovieFilter) Matches(m Movie) bool {
+	if q := strings.ToLower(f.Query); q != "" &&
+		!strings.Contains(strings.ToLower(m.Name), q) &&
+		!strings.Contains(strings.ToLower(m.Director), q) {
+		return false
+	}
+	if f.Genre != "" && !slices.ContainsFunc(m.Genres, func(g string) bool { return strings.EqualFold(g, f.Genre) }) {
+		return false
+	}
+	if f.MinReleaseYear != 0 && m.ReleaseYear < f.MinReleaseYear {
+		return false
+	}
+	if f.MaxReleaseYear != 0 && m.ReleaseYear > f.MaxReleaseYear {
+		return false
+	}
+	if f.MinRating != nil && m.Rating.LessThan(*f.MinRating) {
+		return false
+	}
+	return true
+}
+
+// SelectMovies returns the page of movies selected by the query and the number of all of them,
+// for stores that do not support queries. Movies are expected to be ordered by id,
+// provided slice is not modified.
+func SelectMovies(movies []Movie, q MovieQuery) ([]Movie, int) {
+	ids := map[uuid.UUID]bool{}
+	for _, id := range parseMovieIds(q.IDs) {
+		ids[id] = true
+	}
+	found := []Movie{}
+	for _, m := range movies {
+		if q.IDs != nil && !ids[m.Id] {
+			continue
+		}
+		if q.Directors != nil && !slices.Contains(q.Directors, m.Director) {
+			continue
+		}
+		if q.Filter.Matches(m) {
+			found = append(found, m)
+		}
+	}
+	SortMovies(found, q.Sort)
+
+	start := min(q.Offset, len(found))
+	end := len(found)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	return found[start:end], len(found)
+}
+
+// Fields, movies can be sorted by.
+const (
+	SortByName        = "name"
+	SortByReleaseYear = "release_year"
+	SortByRating      = "rating"
+)
+
+// MovieSort describes the order of movies, movies with equal values keep their order.
+type MovieSort struct {
+	Field string
+	Desc  bool
+}
+
+// SortMovies sorts movies in place.
+func SortMovies(movies []Movie, s MovieSort) {
+	compare := func(a, b Movie) int {
+		switch s.Field {
+		case SortByName:
+			return strings.Compare(a.Name, b.Name)
+		case SortByReleaseYear:
+			return cmp.Compare(a.ReleaseYear, b.ReleaseYear)
+		case SortByRating:
+			return a.Rating.Cmp(b.Rating)
+		}
+		return 0
+	}
+	slices.SortStableFunc(movies, func(a, b Movie) int {
+		if s.Desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+}
@@ -11,6 +11,8 @@ type Service interface {
 	GetMovie(ctx context.Context, id string) (*Movie, error)
 	// GetAllMovies fetches all stored movies using provided id.
 	GetAllMovies(ctx context.Context) ([]Movie, error)
+	// ListMovies fetches the page of movies selected by the query and the number of all of them.
+	ListMovies(ctx context.Context, q MovieQuery) ([]Movie, int, error)
 	// CreateMovie creates movie using provided Movie struct.
 	CreateMovie(ctx context.Context, movie *Movie) (string, error)
 	// UpdateMovie updates movie with provided id using provided Movie struct.
@@ -35,7 +37,7 @@ func NewMovieService(db Database) Service {
 func (ms MovieService) GetMovie(ctx context.Context, id string) (*Movie, error) {
 	movie, err := ms.db.Get(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching by id: %v", err)
+		return nil, fmt.Errorf("error fetching by id: %w", err)
 	}
 	return movie, nil
 }
@@ -43,15 +45,23 @@ func (ms MovieService) GetMovie(ctx context.Context, id string) (*Movie, error)
 func (ms MovieService) GetAllMovies(ctx context.Context) ([]Movie, error) {
 	movies, err := ms.db.GetAll(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching by id: %v", err)
+		return nil, fmt.Errorf("error fetching by id: %w", err)
 	}
 	return movies, nil
 }
 
+func (ms MovieService) ListMovies(ctx context.Context, q MovieQuery) ([]Movie, int, error) {
+	movies, total, err := ms.db.List(ctx, q)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching movies: %w", err)
+	}
+	return movies, total, nil
+}
+
 func (ms MovieService) CreateMovie(ctx context.Context, m *Movie) (string, error) {
 	id, err := ms.db.Insert(ctx, m)
 	if err != nil {
-		return "", fmt.Errorf("error creating movie: %v", err)
+		return "", fmt.Errorf("error creating movie: %w", err)
 	}
 	return id, nil
 }
@@ -59,7 +69,7 @@ func (ms MovieService) CreateMovie(ctx context.Context, m *Movie) (string, error
 func (ms MovieService) UpdateMovie(ctx context.Context, id string, m *Movie) error {
 	err := ms.db.Update(ctx, id, m)
 	if err != nil {
-		return fmt.Errorf("error updating movie: %v", err)
+		return fmt.Errorf("error updating movie: %w", err)
 	}
 	return nil
 }
@@ -67,7 +77,7 @@ func (ms MovieService) UpdateMovie(ctx context.Context, id string, m *Movie) err
 func (ms MovieService) DeleteMovie(ctx context.Context, id string) error {
 	err := ms.db.Delete(ctx, id)
 	if err != nil {
-		return fmt.Errorf("error deleting movie: %v", err)
+		return fmt.Errorf("error deleting movie: %w", err)
 	}
 	return nil
 }
@@ -58,10 +58,11 @@ func TestCreateMovie(t *testing.T) {
 	movie := testMovie()
 	ms := NewMovieService(NewMovieDatabase(mock))
 
-	rows := mock.NewRows([]string{"id"}).AddRow(id)
+	rows := mock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...)
 	value := testMovieRow(id)[1:]
 	mock.ExpectBegin()
 	mock.ExpectQuery("insert into").WithArgs(value...).WillReturnRows(rows)
+	expectOutboxEvent(mock, MovieCreated)
 	mock.ExpectCommit()
 	resId, err := ms.CreateMovie(context.Background(), movie)
 	if err != nil {
@@ -81,9 +82,10 @@ func TestUpdateMovie(t *testing.T) {
 	ms := NewMovieService(NewMovieDatabase(mock))
 
 	mock.ExpectBegin()
-	mock.ExpectExec("update movie").
+	mock.ExpectQuery("update movie").
 		WithArgs(movie.Name, id.String()).
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		WillReturnRows(mock.NewRows(testMovieColumn()).AddRow(testMovieRow(id)...))
+	expectOutboxEvent(mock, MovieUpdated)
 	mock.ExpectCommit()
 	err := ms.UpdateMovie(context.Background(), id.String(), movie)
 	if err != nil {
@@ -101,6 +103,7 @@ func TestDeleteMovie(t *testing.T) {
 	mock.ExpectExec("delete from movie").
 		WithArgs(id.String()).
 		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	expectOutboxEvent(mock, MovieDeleted)
 	mock.ExpectCommit()
 	err := s.DeleteMovie(context.Background(), id.String())
 	if err != nil {
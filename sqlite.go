@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrationsFS contains migrations of the SQLite database schema.
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationsFS embed.FS
+
+// SQLiteMovieDatabase is an SQLite implementation of the Database interface for single-node
+// deployments. Genres are stored as JSON array and rating as decimal string.
+type SQLiteMovieDatabase struct {
+	db *sql.DB
+}
+
+// NewSQLiteMovieDatabase creates an instance of the SQLiteMovieDatabase.
+func NewSQLiteMovieDatabase(db *sql.DB) Database {
+	return SQLiteMovieDatabase{
+		db: db,
+	}
+}
+
+// OpenSQLite opens SQLite database file, creating it if it does not exist.
+// Only one connection is used, so writers never fail with "database is locked".
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sqlite database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to open sqlite database: %v", err)
+	}
+	return db, nil
+}
+
+// SQLiteMigrations returns migrations of the SQLite database schema.
+func SQLiteMigrations() ([]Migration, error) {
+	sub, err := fs.Sub(sqliteMigrationsFS, "migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// NewSQLiteMigrator creates an instance of the Migrator for SQLite database.
+func NewSQLiteMigrator(db *sql.DB, migrations []Migration) Migrator {
+	return Migrator{
+		store:      sqliteMigrationStore{db: db},
+		migrations: migrations,
+	}
+}
+
+// sqliteRow is used to scan movie row, before converting it to the Movie.
+type sqliteRow struct {
+	id          string
+	name        string
+	releaseYear int
+	rating      sql.NullString
+	genres      string
+	director    string
+}
+
+func (r *sqliteRow) fields() []any {
+	return []any{&r.id, &r.name, &r.releaseYear, &r.rating, &r.genres, &r.director}
+}
+
+func (r *sqliteRow) movie() (Movie, error) {
+	movie := Movie{
+		Name:        r.name,
+		ReleaseYear: r.releaseYear,
+		Director:    r.director,
+	}
+	id, err := uuid.FromString(r.id)
+	if err != nil {
+		return Movie{}, err
+	}
+	movie.Id = id
+	if r.rating.Valid {
+		movie.Rating, err = decimal.NewFromString(r.rating.String)
+		if err != nil {
+			return Movie{}, err
+		}
+	}
+	err = json.Unmarshal([]byte(r.genres), &movie.Genres)
+	if err != nil {
+		return Movie{}, err
+	}
+	return movie, nil
+}
+
+const sqliteMovieColumns = "id, name, release_year, rating, genres, director"
+
+func (mdb SQLiteMovieDatabase) Get(ctx context.Context, id string) (*Movie, error) {
+	movieId, err := parseMovieId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	row := sqliteRow{}
+	err = mdb.db.QueryRowContext(
+		ctx,
+		"select "+sqliteMovieColumns+" from movie where id = ?",
+		movieId.String(),
+	).Scan(row.fields()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMovieNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	movie, err := row.movie()
+	if err != nil {
+		return nil, err
+	}
+	return &movie, nil
+}
+
+// GetAll orders movies by id, which is stored in lowercase canonical form, so it is ordered
+// the same way as PostgreSql orders uuid values.
+func (mdb SQLiteMovieDatabase) GetAll(ctx context.Context) ([]Movie, error) {
+	return mdb.queryMovies(ctx, "select "+sqliteMovieColumns+" from movie order by id")
+}
+
+func (mdb SQLiteMovieDatabase) List(ctx context.Context, q MovieQuery) ([]Movie, int, error) {
+	where, params, err := mdb.buildListConditions(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Negative limit returns all rows.
+	limit := -1
+	if q.Limit > 0 {
+		limit = q.Limit
+	}
+	order := orderClause(q.Sort, map[string]string{
+		SortByName:        "name",
+		SortByReleaseYear: "release_year",
+		SortByRating:      "coalesce(cast(rating as real), 0)",
+	})
+	movies, err := mdb.queryMovies(
+		ctx,
+		fmt.Sprintf(
+			"select %s from movie%s%s limit ?%d offset ?%d",
+			sqliteMovieColumns, where, order, len(params)+1, len(params)+2,
+		),
+		append(slices.Clip(params), limit, q.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	err = mdb.db.QueryRowContext(ctx, "select count(*) from movie"+where, params...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	return movies, total, nil
+}
+
+// buildListConditions returns where clause of the query and its params.
+// Lists are passed as JSON arrays, and rating is compared as a number.
+func (mdb SQLiteMovieDatabase) buildListConditions(q MovieQuery) (string, []any, error) {
+	conditions := []string{}
+	params := []any{}
+	add := func(condition string, param any) {
+		params = append(params, param)
+		conditions = append(conditions, fmt.Sprintf(condition, len(params)))
+	}
+
+	// Ids are compared in the canonical form, in which they are stored.
+	var ids []string
+	if q.IDs != nil {
+		ids = []string{}
+		for _, id := range parseMovieIds(q.IDs) {
+			ids = append(ids, id.String())
+		}
+	}
+	for _, list := range []struct {
+		condition string
+		values    []string
+	}{
+		{"id in (select value from json_each(?%d))", ids},
+		{"director in (select value from json_each(?%d))", q.Directors},
+	} {
+		if list.values == nil {
+			continue
+		}
+		values, err := json.Marshal(list.values)
+		if err != nil {
+			return "", nil, err
+		}
+		add(list.condition, string(values))
+	}
+	if q.Filter.Query != "" {
+		add("(instr(lower(name), lower(?%[1]d)) > 0 or instr(lower(director), lower(?%[1]d)) > 0)", q.Filter.Query)
+	}
+	if q.Filter.Genre != "" {
+		add("exists (select 1 from json_each(genres) where lower(value) = lower(?%d))", q.Filter.Genre)
+	}
+	if q.Filter.MinReleaseYear != 0 {
+		add("release_year >= ?%d", q.Filter.MinReleaseYear)
+	}
+	if q.Filter.MaxReleaseYear != 0 {
+		add("release_year <= ?%d", q.Filter.MaxReleaseYear)
+	}
+	if q.Filter.MinRating != nil {
+		add("coalesce(cast(rating as real), 0) >= ?%d", q.Filter.MinRating.InexactFloat64())
+	}
+	return whereClause(conditions), params, nil
+}
+
+// queryMovies fetches movies selected by provided query.
+func (mdb SQLiteMovieDatabase) queryMovies(ctx context.Context, q string, args ...any) ([]Movie, error) {
+	rows, err := mdb.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []Movie{}
+	for rows.Next() {
+		row := sqliteRow{}
+		if err := rows.Scan(row.fields()...); err != nil {
+			return nil, err
+		}
+		movie, err := row.movie()
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, movie)
+	}
+	return movies, rows.Err()
+}
+
+func (mdb SQLiteMovieDatabase) Insert(ctx context.Context, movie *Movie) (string, error) {
+	if movie.Genres == nil {
+		return "", fmt.Errorf("genres must not be null")
+	}
+	rating, err := normalizeRating(movie.Rating)
+	if err != nil {
+		return "", err
+	}
+	genres, err := json.Marshal(movie.Genres)
+	if err != nil {
+		return "", err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = mdb.db.ExecContext(
+		ctx,
+		"insert into movie("+sqliteMovieColumns+") values (?, ?, ?, ?, ?, ?)",
+		id.String(),
+		movie.Name,
+		movie.ReleaseYear,
+		rating.String(),
+		string(genres),
+		movie.Director,
+	)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// Update reuses MovieDatabase.buildUpdateQuery, so partial update rules are the same.
+// PostgreSql $N placeholders are replaced with SQLite ?N ones.
+func (mdb SQLiteMovieDatabase) Update(ctx context.Context, id string, movie *Movie) error {
+	movieId, err := parseMovieId(id)
+	if err != nil {
+		return err
+	}
+	rating, err := normalizeRating(movie.Rating)
+	if err != nil {
+		return err
+	}
+	normalized := *movie
+	normalized.Rating = rating
+
+	q, params, err := MovieDatabase{}.buildUpdateQuery(&normalized, movieId.String())
+	if err != nil {
+		return err
+	}
+	for i, p := range params {
+		switch v := p.(type) {
+		case decimal.Decimal:
+			params[i] = v.String()
+		case []string:
+			genres, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			params[i] = string(genres)
+		}
+	}
+
+	res, err := mdb.db.ExecContext(ctx, strings.ReplaceAll(q, "$", "?"), params...)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (mdb SQLiteMovieDatabase) Delete(ctx context.Context, id string) error {
+	movieId, err := parseMovieId(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := mdb.db.ExecContext(ctx, "delete from movie where id = ?", movieId.String())
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// expectAffected returns ErrMovieNotFound, if no rows were affected by the statement.
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMovieNotFound
+	}
+	return nil
+}
+
+// sqliteMigrationStore is an SQLite implementation of the migrationStore.
+// SQLite does not have advisory locks, but it allows only one writer at a time,
+// and every migration is applied in transaction along with its record,
+// so concurrent runners can not apply the same migration twice.
+type sqliteMigrationStore struct {
+	db *sql.DB
+}
+
+func (s sqliteMigrationStore) lock(ctx context.Context) error {
+	q := `
+	create table if not exists schema_migrations (
+		version integer primary key,
+		name text not null,
+		applied_at text not null
+	)
+	`
+	_, err := s.db.ExecContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+func (s sqliteMigrationStore) unlock(context.Context) error {
+	return nil
+}
+
+func (s sqliteMigrationStore) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version], err = time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return applied, rows.Err()
+}
+
+func (s sqliteMigrationStore) apply(ctx context.Context, mig Migration) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+			return fmt.Errorf("error applying migration %d_%s: %v", mig.Version, mig.Name, err)
+		}
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into schema_migrations(version, name, applied_at) values (?, ?, ?)",
+			mig.Version,
+			mig.Name,
+			time.Now().UTC().Format(time.RFC3339),
+		)
+		return err
+	})
+}
+
+func (s sqliteMigrationStore) rollback(ctx context.Context, mig Migration) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+			return fmt.Errorf("error rolling back migration %d_%s: %v", mig.Version, mig.Name, err)
+		}
+		_, err := tx.ExecContext(ctx, "delete from schema_migrations where version = ?", mig.Version)
+		return err
+	})
+}
+
+func (s sqliteMigrationStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		switch err {
+		case nil:
+			err = tx.Commit()
+		default:
+			tx.Rollback()
+		}
+	}()
+
+	return fn(tx)
+}
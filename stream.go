@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// eventsChannel is the PostgreSql notification channel, id of every event written
+// into the outbox is sent to it.
+const eventsChannel = "movie_events"
+
+// EventLog is responsible for reading persisted movie change events.
+type EventLog interface {
+	// EventsAfter fetches up to limit events with ids greater than provided one, ordered by id.
+	// Events following an id, that may still be committed, are not returned, so the id of
+	// the last returned event can be used to fetch the next ones without missing any.
+	EventsAfter(ctx context.Context, id int64, limit int) ([]Event, error)
+}
+
+// PgEventLog is a PostgreSql implementation of the EventLog, that reads events from the outbox.
+type PgEventLog struct {
+	conn       databaseConn
+	gapTimeout time.Duration
+}
+
+// NewPgEventLog creates an instance of the PgEventLog. Missing id, which is followed by events
+// inserted more than gapTimeout ago, is considered rolled back.
+func NewPgEventLog(conn databaseConn, gapTimeout time.Duration) EventLog {
+	return PgEventLog{
+		conn:       conn,
+		gapTimeout: gapTimeout,
+	}
+}
+
+func (l PgEventLog) EventsAfter(ctx context.Context, id int64, limit int) ([]Event, error) {
+	q := `
+	select id, aggregate_id, event_type, payload, created_at, now()
+	from outbox
+	where id > $1
+	order by id
+	limit $2
+	`
+	rows, err := l.conn.Query(ctx, q, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	var now time.Time
+	for rows.Next() {
+		ev := Event{}
+		var eventType string
+		var payload []byte
+		if err := rows.Scan(&ev.ID, &ev.MovieID, &eventType, &payload, &ev.OccurredAt, &now); err != nil {
+			return nil, err
+		}
+		ev.Type = EventType(eventType)
+		if payload != nil {
+			ev.Movie = &Movie{}
+			if err := json.Unmarshal(payload, ev.Movie); err != nil {
+				return nil, fmt.Errorf("error decoding payload of event %d: %v", ev.ID, err)
+			}
+		}
+		events = append(events, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return committedEvents(events, id, now, l.gapTimeout), nil
+}
+
+// committedEvents returns events, that follow the event with provided id without gaps.
+// Outbox ids are allocated before the transaction is committed, so the event with lower id
+// can be committed after the event with higher id has been read. Gap is skipped only when
+// the event after it was inserted at least gapTimeout before now, since the transaction,
+// which allocated the missing id, was rolled back then.
+func committedEvents(events []Event, after int64, now time.Time, gapTimeout time.Duration) []Event {
+	next := after + 1
+	for i, ev := range events {
+		if ev.ID != next && now.Sub(ev.OccurredAt) < gapTimeout {
+			return events[:i]
+		}
+		next = ev.ID + 1
+	}
+	return events
+}
+
+// EventBroker fans out movie change events to all subscribers in process.
+// Publish never blocks: subscriber, that does not keep up and has full buffer,
+// is dropped, and should resume from the EventLog.
+type EventBroker struct {
+	mu     sync.Mutex
+	subs   map[*EventSubscription]struct{}
+	buffer int
+}
+
+// EventSubscription receives events published after it was created.
+type EventSubscription struct {
+	// Events receives published events, it is never closed.
+	Events chan Event
+	// Dropped is closed, when subscriber is dropped for being too slow.
+	Dropped chan struct{}
+}
+
+// NewEventBroker creates an instance of the EventBroker, every subscriber can have
+// up to buffer not received events.
+func NewEventBroker(buffer int) *EventBroker {
+	return &EventBroker{
+		subs:   map[*EventSubscription]struct{}{},
+		buffer: buffer,
+	}
+}
+
+// Subscribe creates subscription, that must be released with Unsubscribe.
+func (b *EventBroker) Subscribe() *EventSubscription {
+	sub := &EventSubscription{
+		Events:  make(chan Event, b.buffer),
+		Dropped: make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe releases subscription, it is safe to call it for already dropped one.
+func (b *EventBroker) Unsubscribe(sub *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+}
+
+// Publish sends event to all subscribers, dropping ones with full buffer.
+func (b *EventBroker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		select {
+		case sub.Events <- event:
+		default:
+			close(sub.Dropped)
+			delete(b.subs, sub)
+		}
+	}
+}
+
+// Subscribers returns the number of current subscribers.
+func (b *EventBroker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// PgEventListener listens for notifications about new events in the outbox
+// and publishes them to the EventBroker in order of their ids.
+type PgEventListener struct {
+	pool       *pgxpool.Pool
+	log        EventLog
+	broker     *EventBroker
+	gapTimeout time.Duration
+	logger     *slog.Logger
+}
+
+// NewPgEventListener creates an instance of the PgEventListener, that reads events from the log
+// created with the same gapTimeout.
+func NewPgEventListener(
+	pool *pgxpool.Pool,
+	log EventLog,
+	broker *EventBroker,
+	gapTimeout time.Duration,
+	logger *slog.Logger,
+) PgEventListener {
+	return PgEventListener{
+		pool:       pool,
+		log:        log,
+		broker:     broker,
+		gapTimeout: gapTimeout,
+		logger:     logger,
+	}
+}
+
+// Run publishes new events until ctx is canceled, reconnecting when connection is lost.
+// Publishing starts before the events, which may still be followed by uncommitted ones.
+func (l PgEventListener) Run(ctx context.Context) error {
+	var last int64
+	err := l.pool.QueryRow(
+		ctx,
+		"select coalesce(max(id), 0) from outbox where created_at < now() - make_interval(secs => $1)",
+		l.gapTimeout.Seconds(),
+	).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	for {
+		last, err = l.listen(ctx, last)
+		if ctx.Err() != nil {
+			return nil
+		}
+		l.logger.Warn("event notifications are not received", slog.String("error", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// listen holds a dedicated connection, waiting for notifications.
+// Notification payload is not trusted, all events after the last published one are fetched,
+// so events are not lost, if connection was lost between notifications. Events are fetched
+// again after gapTimeout without notification, since events held back by the id of rolled
+// back transaction are not followed by one.
+func (l PgEventListener) listen(ctx context.Context, last int64) (int64, error) {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return last, err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "listen "+eventsChannel)
+	if err != nil {
+		return last, err
+	}
+	for {
+		last, err = l.publishAfter(ctx, last)
+		if err != nil {
+			return last, err
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, l.gapTimeout)
+		_, err = conn.Conn().WaitForNotification(waitCtx)
+		cancel()
+		if err != nil && (ctx.Err() != nil || !errors.Is(waitCtx.Err(), context.DeadlineExceeded)) {
+			return last, err
+		}
+	}
+}
+
+func (l PgEventListener) publishAfter(ctx context.Context, last int64) (int64, error) {
+	for {
+		events, err := l.log.EventsAfter(ctx, last, 100)
+		if err != nil {
+			return last, err
+		}
+		for _, ev := range events {
+			l.broker.Publish(ev)
+			last = ev.ID
+		}
+		if len(events) < 100 {
+			return last, nil
+		}
+	}
+}
+
+// StreamOptions describes the behavior of the event stream endpoint.
+type StreamOptions struct {
+	// Heartbeat is the interval between comments sent to keep idle connection open.
+	Heartbeat time.Duration
+	// WriteTimeout limits a single write, client is disconnected, if it is exceeded.
+	WriteTimeout time.Duration
+	// ReplayBatch is the number of events fetched at once, when client resumes the stream.
+	ReplayBatch int
+}
+
+// eventStream contains dependencies of the event stream endpoint.
+type eventStream struct {
+	broker *EventBroker
+	log    EventLog
+	opts   StreamOptions
+}
+
+// handleMovieStream streams movie change events as Server-Sent Events. Id of every message
+// is the id of the event, so the client resumes stream from the Last-Event-ID header,
+// receiving missed events from the EventLog. New client receives only events published after
+// it connected. Client, that does not keep up with the events, is disconnected, and should
+// reconnect to resume.
+func (s Server) handleMovieStream(w http.ResponseWriter, r *http.Request) {
+	var last int64
+	v := r.Header.Get("Last-Event-ID")
+	resume := v != ""
+	if resume {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			writeJson(w, http.StatusBadRequest, map[string]any{"error": "invalid Last-Event-ID"})
+			return
+		}
+		last = id
+	}
+
+	// Subscription is created before replay, so events published during it are not missed.
+	sub := s.stream.broker.Subscribe()
+	defer s.stream.broker.Unsubscribe(sub)
+
+	// Stream outlives server read and write timeouts, every write is limited separately instead.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...any) bool {
+		rc.SetWriteDeadline(time.Now().Add(s.stream.opts.WriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	send := func(ev Event) bool {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return false
+		}
+		last = ev.ID
+		return write("id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	}
+
+	if !write("retry: 3000\n\n") {
+		return
+	}
+	for resume {
+		events, err := s.stream.log.EventsAfter(r.Context(), last, s.stream.opts.ReplayBatch)
+		if err != nil {
+			return
+		}
+		for _, ev := range events {
+			if !send(ev) {
+				return
+			}
+		}
+		if len(events) < s.stream.opts.ReplayBatch {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(s.stream.opts.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Dropped:
+			return
+		case ev := <-sub.Events:
+			if ev.ID <= last {
+				continue
+			}
+			if !send(ev) {
+				return
+			}
+		case <-heartbeat.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		}
+	}
+}
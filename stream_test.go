@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// memoryEventLog is an EventLog, that returns events from the slice.
+type memoryEventLog []Event
+
+func (l memoryEventLog) EventsAfter(_ context.Context, id int64, limit int) ([]Event, error) {
+	events := []Event{}
+	for _, ev := range l {
+		if ev.ID > id && len(events) < limit {
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+func TestCommittedEvents(t *testing.T) {
+	now := time.Now()
+	ids := func(events []Event) []int64 {
+		ids := []int64{}
+		for _, ev := range events {
+			ids = append(ids, ev.ID)
+		}
+		return ids
+	}
+
+	// Writer A allocated id 2 and writer B id 3, but B committed first.
+	events := []Event{{ID: 1, OccurredAt: now}, {ID: 3, OccurredAt: now}}
+	got := committedEvents(events, 0, now, time.Minute)
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("event after uncommitted id was returned; expected: [1], got: %v", ids(got))
+	}
+
+	// Writer A committed, so both events are returned in order.
+	events = []Event{{ID: 2, OccurredAt: now}, {ID: 3, OccurredAt: now}}
+	got = committedEvents(events, 1, now, time.Minute)
+	if len(got) != 2 || got[0].ID != 2 || got[1].ID != 3 {
+		t.Errorf("wrong events after gap is filled; expected: [2 3], got: %v", ids(got))
+	}
+
+	// Writer A rolled back, so the gap is skipped after timeout.
+	events = []Event{{ID: 3, OccurredAt: now.Add(-time.Minute)}, {ID: 5, OccurredAt: now}}
+	got = committedEvents(events, 1, now, time.Minute)
+	if len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("wrong events after rolled back id; expected: [3], got: %v", ids(got))
+	}
+}
+
+// TestPgEventLogInterleavedWriters is run against PostgreSql,
+// if its connection string is provided in TEST_DATABASE_URL variable.
+func TestPgEventLogInterleavedWriters(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	cfg := DefaultConfig().Database
+	cfg.URL = url
+	cfg.ConnectAttempts = 1
+	pool, err := ConnectDB(ctx, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if err := migratePostgres(ctx, pool, []string{"up"}); err != nil {
+		t.Fatal(err)
+	}
+	var last int64
+	if err := pool.QueryRow(ctx, "select coalesce(max(id), 0) from outbox").Scan(&last); err != nil {
+		t.Fatal(err)
+	}
+	log := NewPgEventLog(pool, time.Minute)
+	slowId, fastId := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	// Slow writer allocates the lower id, but commits after the fast one.
+	slow, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Rollback(ctx)
+	if err := writeEvent(ctx, slow, MovieDeleted, slowId, nil); err != nil {
+		t.Fatal(err)
+	}
+	fast, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Rollback(ctx)
+	if err := writeEvent(ctx, fast, MovieDeleted, fastId, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := fast.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := log.EventsAfter(ctx, last, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("event after uncommitted one was returned; got: %v", events)
+	}
+
+	if err := slow.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events, err = log.EventsAfter(ctx, last, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].MovieID != slowId || events[1].MovieID != fastId {
+		t.Errorf("wrong events after both writers committed; expected: slow, fast, got: %v", events)
+	}
+}
+
+func TestEventBrokerDropsSlowSubscriber(t *testing.T) {
+	b := NewEventBroker(1)
+	fast := b.Subscribe()
+	slow := b.Subscribe()
+
+	b.Publish(Event{ID: 1})
+	<-fast.Events
+	b.Publish(Event{ID: 2})
+
+	select {
+	case <-slow.Dropped:
+	default:
+		t.Fatalf("slow subscriber was not dropped")
+	}
+	select {
+	case <-fast.Dropped:
+		t.Errorf("fast subscriber was dropped")
+	default:
+	}
+	if got := b.Subscribers(); got != 1 {
+		t.Errorf("wrong number of subscribers; expected: 1, got: %d", got)
+	}
+	b.Unsubscribe(slow)
+	b.Unsubscribe(fast)
+	if got := b.Subscribers(); got != 0 {
+		t.Errorf("wrong number of subscribers; expected: 0, got: %d", got)
+	}
+}
+
+func TestHandleMovieStream(t *testing.T) {
+	log := memoryEventLog{
+		{ID: 1, Type: MovieCreated},
+		{ID: 2, Type: MovieUpdated},
+		{ID: 3, Type: MovieDeleted},
+	}
+	broker := NewEventBroker(10)
+	opts := StreamOptions{Heartbeat: 50 * time.Millisecond, WriteTimeout: time.Second, ReplayBatch: 2}
+	srv := httptest.NewServer(NewServer(nil).WithEventStream(broker, log, opts).Handler())
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/movies/stream", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("error connecting to stream: %v", err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("wrong content type; expected: text/event-stream, got: %s", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	next := func(prefix string) string {
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case line := <-lines:
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+			case <-timeout:
+				t.Fatalf("%q line was not received", prefix)
+			}
+		}
+	}
+
+	// Missed events are replayed in batches.
+	for _, expected := range []string{"id: 2", "id: 3"} {
+		if got := next("id: "); got != expected {
+			t.Errorf("wrong replayed event; expected: %s, got: %s", expected, got)
+		}
+	}
+
+	for broker.Subscribers() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Event, which was already replayed, is not sent again.
+	broker.Publish(Event{ID: 3, Type: MovieDeleted})
+	broker.Publish(Event{ID: 4, Type: MovieCreated, Movie: testMovie()})
+	if got := next("id: "); got != "id: 4" {
+		t.Errorf("wrong live event; expected: id: 4, got: %s", got)
+	}
+	if got := next("event: "); got != "event: MovieCreated" {
+		t.Errorf("wrong event type; expected: event: MovieCreated, got: %s", got)
+	}
+	next(": heartbeat")
+}
+
+func TestHandleMovieStreamWithoutLastEventID(t *testing.T) {
+	log := memoryEventLog{{ID: 1, Type: MovieCreated}, {ID: 2, Type: MovieUpdated}}
+	broker := NewEventBroker(10)
+	opts := StreamOptions{Heartbeat: time.Minute, WriteTimeout: time.Second, ReplayBatch: 10}
+	srv := httptest.NewServer(NewServer(nil).WithEventStream(broker, log, opts).Handler())
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL + "/movies/stream")
+	if err != nil {
+		t.Fatalf("error connecting to stream: %v", err)
+	}
+	defer res.Body.Close()
+	for broker.Subscribers() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	broker.Publish(Event{ID: 3, Type: MovieDeleted})
+
+	// History is not replayed, so the first received event is the live one.
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "id: ") {
+			if line != "id: 3" {
+				t.Errorf("wrong first event; expected: id: 3, got: %s", line)
+			}
+			return
+		}
+	}
+	t.Fatalf("event was not received: %v", scanner.Err())
+}
+
+func TestHandleMovieStreamInvalidLastEventID(t *testing.T) {
+	s := NewServer(nil).WithEventStream(NewEventBroker(1), memoryEventLog{}, StreamOptions{})
+	req := httptest.NewRequest(http.MethodGet, "/movies/stream", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("wrong status; expected: %d, got: %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -6,10 +6,10 @@ import (
 )
 
 type Movie struct {
-	Id          uuid.UUID       `json:"id"`
-	Name        string          `json:"name"`
-	ReleaseYear int             `json:"release_year"`
-	Rating      decimal.Decimal `json:"rating"`
-	Genres      []string        `json:"genres"`
-	Director    string          `json:"director"`
+	Id          uuid.UUID       `json:"id" xml:"id"`
+	Name        string          `json:"name" xml:"name"`
+	ReleaseYear int             `json:"release_year" xml:"release_year"`
+	Rating      decimal.Decimal `json:"rating" xml:"rating"`
+	Genres      []string        `json:"genres" xml:"genres>genre"`
+	Director    string          `json:"director" xml:"director"`
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is the current version of the API, its endpoints are served under apiVersionPrefix.
+// Unversioned endpoints are deprecated aliases of the current version.
+const (
+	apiVersion       = 1
+	apiVersionPrefix = "/v1"
+)
+
+// vendorMediaType matches media type, that requests the version of the API,
+// e.g. application/vnd.movies.v1+json.
+var vendorMediaType = regexp.MustCompile(`^application/vnd\.movies\.v(\d+)(\+json)?$`)
+
+// VersionOptions configure headers of the deprecated unversioned endpoints,
+// zero dates are not sent.
+type VersionOptions struct {
+	// Deprecation is the date, since which unversioned endpoints are deprecated.
+	Deprecation time.Time
+	// Sunset is the date, after which unversioned endpoints may stop responding.
+	Sunset time.Time
+}
+
+// acceptedVersion returns version of the API requested by Accept header, either with vendor
+// media type, e.g. application/vnd.movies.v1+json, or with version parameter, e.g.
+// application/json; version=1. The current version is preferred, if several versions are
+// accepted, and zero is returned, if no version is requested.
+func acceptedVersion(r *http.Request) (int, error) {
+	versions := []int{}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+			version := params["version"]
+			if m := vendorMediaType.FindStringSubmatch(mediaType); m != nil {
+				version = m[1]
+			}
+			if version == "" {
+				continue
+			}
+			v, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid API version: %q", version)
+			}
+			versions = append(versions, v)
+		}
+	}
+	for _, v := range versions {
+		if v == apiVersion {
+			return v, nil
+		}
+	}
+	if len(versions) > 0 {
+		return versions[0], nil
+	}
+	return 0, nil
+}
+
+// versioned returns handler, that responds with 406, if the version requested by Accept header
+// is not the current version. Served version is written to API-Version header.
+func (s Server) versioned(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v, err := acceptedVersion(r)
+		if err == nil && v != 0 && v != apiVersion {
+			err = fmt.Errorf("unsupported API version: %d, supported versions: %d", v, apiVersion)
+		}
+		if err != nil {
+			writeJson(w, http.StatusNotAcceptable, map[string]any{"error": err.Error()})
+			return
+		}
+		w.Header().Set("API-Version", strconv.Itoa(apiVersion))
+		next(w, r)
+	}
+}
+
+// unversioned returns handler of the deprecated alias of the versioned endpoint. Unless client
+// requests the version by Accept header, response has Deprecation and Sunset headers and links
+// to the versioned endpoint.
+func (s Server) unversioned(next http.HandlerFunc) http.HandlerFunc {
+	versioned := s.versioned(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if v, err := acceptedVersion(r); err == nil && v == 0 {
+			if !s.version.Deprecation.IsZero() {
+				w.Header().Set("Deprecation", "@"+strconv.FormatInt(s.version.Deprecation.Unix(), 10))
+			}
+			if !s.version.Sunset.IsZero() {
+				w.Header().Set("Sunset", s.version.Sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, apiVersionPrefix, r.URL.EscapedPath()))
+		}
+		versioned(w, r)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAcceptedVersion(t *testing.T) {
+	tests := []struct {
+		accept  string
+		version int
+		err     bool
+	}{
+		{"", 0, false},
+		{"application/json", 0, false},
+		{"application/vnd.movies.v1+json", 1, false},
+		{"application/json; version=2", 2, false},
+		{"application/vnd.movies.v2+json, application/vnd.movies.v1+json;q=0.5", 1, false},
+		{"text/event-stream", 0, false},
+		{"application/json; version=latest", 0, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/movies", nil)
+		r.Header.Set("Accept", tt.accept)
+		v, err := acceptedVersion(r)
+		if v != tt.version || (err != nil) != tt.err {
+			t.Errorf("wrong version of %q; expected: %d, error: %v, got: %d, error: %v", tt.accept, tt.version, tt.err, v, err)
+		}
+	}
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	opts := VersionOptions{
+		Deprecation: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		Sunset:      time.Date(2027, 4, 18, 0, 0, 0, 0, time.UTC),
+	}
+	h := NewServer(NewMovieService(NewMemoryDatabase())).WithVersionOptions(opts).Handler()
+
+	tests := []struct {
+		name       string
+		path       string
+		accept     string
+		status     int
+		deprecated bool
+	}{
+		{"versioned path", "/v1/movies", "", http.StatusOK, false},
+		{"unversioned path", "/movies", "application/json", http.StatusOK, true},
+		{"version in accept", "/movies", "application/vnd.movies.v1+json", http.StatusOK, false},
+		{"unsupported version", "/v1/movies", "application/json; version=2", http.StatusNotAcceptable, false},
+		{"unsupported version of unversioned path", "/movies", "application/vnd.movies.v2+json", http.StatusNotAcceptable, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Header.Set("Accept", tt.accept)
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: wrong status; expected: %d, got: %d", tt.name, tt.status, w.Code)
+		}
+		if deprecated := w.Header().Get("Deprecation") != ""; deprecated != tt.deprecated {
+			t.Errorf("%s: wrong deprecation; expected: %v, got: %v", tt.name, tt.deprecated, deprecated)
+		}
+		if tt.status == http.StatusOK && w.Header().Get("API-Version") != "1" {
+			t.Errorf("%s: wrong API-Version; expected: 1, got: %q", tt.name, w.Header().Get("API-Version"))
+		}
+		if !tt.deprecated {
+			continue
+		}
+		headers := map[string]string{
+			"Deprecation": "@1792281600",
+			"Sunset":      "Sun, 18 Apr 2027 00:00:00 GMT",
+			"Link":        `</v1/movies>; rel="successor-version"`,
+		}
+		for name, expected := range headers {
+			if got := w.Header().Get(name); got != expected {
+				t.Errorf("%s: wrong %s header; expected: %q, got: %q", tt.name, name, expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// ErrSubscriptionNotFound is returned by WebhookStore implementations,
+// when subscription with provided id does not exist.
+var ErrSubscriptionNotFound = errors.New("subscription with such id does not exist")
+
+// ErrPrivateAddress is returned, when webhook is not delivered, since its URL resolves
+// to loopback, link-local or private address.
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// WebhookSubscription describes the URL, that receives movie change events.
+// Empty EventTypes or Genres match all events. Genres are not checked for MovieDeleted
+// events, because they do not contain the movie.
+type WebhookSubscription struct {
+	ID         uuid.UUID   `json:"id" xml:"id"`
+	URL        string      `json:"url" xml:"url"`
+	Secret     string      `json:"secret,omitempty" xml:"secret,omitempty"`
+	EventTypes []EventType `json:"event_types" xml:"event_types>event_type"`
+	Genres     []string    `json:"genres" xml:"genres>genre"`
+	CreatedAt  time.Time   `json:"created_at" xml:"created_at"`
+}
+
+// Validate checks, that subscription has absolute http(s) URL and known event types.
+func (s WebhookSubscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be absolute http or https URL")
+	}
+	for _, t := range s.EventTypes {
+		if t != MovieCreated && t != MovieUpdated && t != MovieDeleted {
+			return fmt.Errorf("unsupported event type: %s", t)
+		}
+	}
+	return nil
+}
+
+// Matches reports, whether the event passes subscription filters.
+func (s WebhookSubscription) Matches(event Event) bool {
+	if len(s.EventTypes) > 0 && !slices.Contains(s.EventTypes, event.Type) {
+		return false
+	}
+	if len(s.Genres) == 0 || event.Movie == nil {
+		return true
+	}
+	for _, g := range event.Movie.Genres {
+		if slices.Contains(s.Genres, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryState is the state of the event delivery to the subscription.
+type DeliveryState string
+
+const (
+	DeliveryPending   DeliveryState = "pending"
+	DeliveryDelivered DeliveryState = "delivered"
+	// DeliveryDead is the state of the delivery, which failed all attempts.
+	DeliveryDead DeliveryState = "dead"
+)
+
+// WebhookDelivery is a single event, that should be delivered to the subscription,
+// with the result of the last attempt.
+type WebhookDelivery struct {
+	ID             int64         `json:"id" xml:"id"`
+	SubscriptionID uuid.UUID     `json:"subscription_id" xml:"subscription_id"`
+	Event          Event         `json:"event" xml:"event"`
+	State          DeliveryState `json:"state" xml:"state"`
+	Attempts       int           `json:"attempts" xml:"attempts"`
+	LastStatus     int           `json:"last_status,omitempty" xml:"last_status,omitempty"`
+	LastError      string        `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	NextAttemptAt  *time.Time    `json:"next_attempt_at,omitempty" xml:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time     `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at" xml:"updated_at"`
+}
+
+// WebhookDispatcher is an EventSink, that enqueues delivery of the event
+// for every subscription matching it. Deliveries are sent by the WebhookDeliverer.
+type WebhookDispatcher struct {
+	store WebhookStore
+}
+
+// NewWebhookDispatcher creates an instance of the WebhookDispatcher.
+func NewWebhookDispatcher(store WebhookStore) EventSink {
+	return WebhookDispatcher{
+		store: store,
+	}
+}
+
+func (d WebhookDispatcher) Publish(ctx context.Context, event Event) error {
+	subs, err := d.store.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	ids := []uuid.UUID{}
+	for _, s := range subs {
+		if s.Matches(event) {
+			ids = append(ids, s.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return d.store.Enqueue(ctx, event, ids)
+}
+
+// WebhookOptions describes how deliveries are sent and retried by the WebhookDeliverer.
+type WebhookOptions struct {
+	// BatchSize is the maximum number of deliveries sent at once.
+	BatchSize int
+	// PollInterval is the delay between fetches, when there are no due deliveries.
+	PollInterval time.Duration
+	// Timeout limits a single attempt. Deliveries of the batch are sent one by one,
+	// so they are not fetched again, until the batch could have been sent.
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts, after which delivery becomes dead.
+	MaxAttempts int
+	// RetryBackoff is the delay before the second attempt, it is doubled for every next one,
+	// but never exceeds MaxRetryBackoff.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// AllowPrivateURLs allows deliveries to loopback, link-local and private addresses,
+	// which are refused by default, so subscriptions can not reach internal services.
+	AllowPrivateURLs bool
+}
+
+// WebhookDeliverer sends due deliveries to the subscribed URLs.
+//
+// Every request contains JSON encoded Event and the following headers:
+// X-Webhook-Id with the delivery id, X-Webhook-Event with the event type,
+// X-Webhook-Timestamp with the unix time of the attempt, and X-Webhook-Signature
+// with the HMAC-SHA256 signature of the timestamp and body, created by SignWebhook.
+type WebhookDeliverer struct {
+	store  WebhookStore
+	client *http.Client
+	opts   WebhookOptions
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// NewWebhookDeliverer creates an instance of the WebhookDeliverer.
+func NewWebhookDeliverer(store WebhookStore, opts WebhookOptions, logger *slog.Logger) WebhookDeliverer {
+	return WebhookDeliverer{
+		store:  store,
+		client: newWebhookClient(opts),
+		opts:   opts,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// newWebhookClient creates client, that checks every address it connects to, including
+// the ones of redirects, since host of the subscription URL may resolve to any of them.
+// Proxies are not used, because the address of the subscription can not be checked then.
+func newWebhookClient(opts WebhookOptions) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !opts.AllowPrivateURLs {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   refusePrivateAddress,
+		}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+	return &http.Client{Timeout: opts.Timeout, Transport: transport}
+}
+
+// refusePrivateAddress is a net.Dialer Control function, that fails connection to
+// the resolved address, unless it is a public unicast one.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.Is4() && cgnatPrefix.Contains(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// cgnatPrefix is the shared address space of carrier-grade NAT, which is not routed publicly.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// Run sends due deliveries until ctx is canceled.
+func (wd WebhookDeliverer) Run(ctx context.Context) error {
+	for {
+		n, err := wd.deliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			wd.logger.Error("error delivering webhooks", slog.String("error", err.Error()))
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wd.opts.PollInterval):
+		}
+	}
+}
+
+// deliverDue sends a single batch of due deliveries and returns the number of sent ones.
+func (wd WebhookDeliverer) deliverDue(ctx context.Context) (int, error) {
+	due, err := wd.store.ClaimDue(ctx, wd.now(), wd.lease(), wd.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	subs := map[uuid.UUID]*WebhookSubscription{}
+	for _, d := range due {
+		sub, ok := subs[d.SubscriptionID]
+		if !ok {
+			sub, err = wd.store.Subscription(ctx, d.SubscriptionID.String())
+			if err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+				return 0, err
+			}
+			subs[d.SubscriptionID] = sub
+		}
+		// Deliveries of the deleted subscription are removed along with it.
+		if sub == nil {
+			continue
+		}
+
+		status, sendErr := wd.send(ctx, *sub, d)
+		if err := wd.store.UpdateDelivery(ctx, wd.result(d, status, sendErr)); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// lease returns the duration, claimed deliveries are not fetched again for. It covers sending
+// of the whole batch, since all deliveries are claimed at once, and an extra timeout for
+// loading subscriptions and storing results.
+func (wd WebhookDeliverer) lease() time.Duration {
+	return time.Duration(wd.opts.BatchSize+1) * wd.opts.Timeout
+}
+
+// result returns delivery updated with the result of the attempt.
+func (wd WebhookDeliverer) result(d WebhookDelivery, status int, err error) WebhookDelivery {
+	d.Attempts++
+	d.LastStatus = status
+	d.UpdatedAt = wd.now()
+	d.NextAttemptAt = nil
+	d.LastError = ""
+	switch {
+	case err == nil:
+		d.State = DeliveryDelivered
+	case d.Attempts >= wd.opts.MaxAttempts:
+		d.State = DeliveryDead
+		d.LastError = err.Error()
+	default:
+		next := wd.now().Add(wd.backoff(d.Attempts))
+		d.NextAttemptAt = &next
+		d.LastError = err.Error()
+	}
+
+	if err != nil {
+		wd.logger.Warn(
+			"webhook was not delivered",
+			slog.Int64("delivery_id", d.ID),
+			slog.String("subscription_id", d.SubscriptionID.String()),
+			slog.Int("attempt", d.Attempts),
+			slog.String("state", string(d.State)),
+			slog.String("error", err.Error()),
+		)
+	}
+	return d
+}
+
+// send posts the event to the subscription URL and returns response status.
+func (wd WebhookDeliverer) send(ctx context.Context, sub WebhookSubscription, d WebhookDelivery) (int, error) {
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := wd.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Webhook-Event", string(d.Event.Type))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", SignWebhook(sub.Secret, timestamp, body))
+
+	res, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt.
+func (wd WebhookDeliverer) backoff(attempt int) time.Duration {
+	delay := wd.opts.RetryBackoff
+	for i := 1; i < attempt && delay < wd.opts.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, wd.opts.MaxRetryBackoff)
+}
+
+// SignWebhook returns the value of X-Webhook-Signature header: hex encoded HMAC-SHA256
+// of the timestamp and body joined with dot, prefixed with "sha256=".
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature of the received webhook in constant time.
+func VerifyWebhook(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, timestamp, body)), []byte(signature))
+}
+
+// newWebhookSecret generates random secret for the subscription, that did not provide one.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
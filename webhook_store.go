@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// WebhookStore is responsible for storing webhook subscriptions and their deliveries.
+type WebhookStore interface {
+	// CreateSubscription stores subscription, setting its id and creation time.
+	CreateSubscription(ctx context.Context, sub *WebhookSubscription) error
+	// Subscriptions fetches all subscriptions ordered by creation time.
+	Subscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	// Subscription fetches subscription with provided id.
+	Subscription(ctx context.Context, id string) (*WebhookSubscription, error)
+	// DeleteSubscription deletes subscription with provided id along with its deliveries.
+	DeleteSubscription(ctx context.Context, id string) error
+	// Enqueue creates pending deliveries of the event for provided subscriptions.
+	// Event, that was already enqueued for the subscription, is ignored.
+	Enqueue(ctx context.Context, event Event, subscriptionIDs []uuid.UUID) error
+	// ClaimDue fetches pending deliveries, which next attempt is due at now, and postpones
+	// their next attempt by lease, so they are not fetched again while being sent.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	// UpdateDelivery stores the result of the delivery attempt.
+	UpdateDelivery(ctx context.Context, d WebhookDelivery) error
+	// Deliveries fetches the latest deliveries of the subscription, newest first.
+	Deliveries(ctx context.Context, subscriptionID string, limit int) ([]WebhookDelivery, error)
+}
+
+// MemoryWebhookStore is a concurrency-safe in-memory implementation of the WebhookStore.
+type MemoryWebhookStore struct {
+	mu         sync.Mutex
+	subs       []WebhookSubscription
+	deliveries []WebhookDelivery
+	nextID     int64
+}
+
+// NewMemoryWebhookStore creates an empty instance of the MemoryWebhookStore.
+func NewMemoryWebhookStore() WebhookStore {
+	return &MemoryWebhookStore{}
+}
+
+func (s *MemoryWebhookStore) CreateSubscription(_ context.Context, sub *WebhookSubscription) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	sub.ID = id
+	sub.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, copySubscription(*sub))
+	return nil
+}
+
+func (s *MemoryWebhookStore) Subscriptions(_ context.Context) ([]WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs := make([]WebhookSubscription, len(s.subs))
+	for i, sub := range s.subs {
+		subs[i] = copySubscription(sub)
+	}
+	return subs, nil
+}
+
+func (s *MemoryWebhookStore) Subscription(_ context.Context, id string) (*WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.subscriptionIndex(id)
+	if i < 0 {
+		return nil, ErrSubscriptionNotFound
+	}
+	sub := copySubscription(s.subs[i])
+	return &sub, nil
+}
+
+func (s *MemoryWebhookStore) DeleteSubscription(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.subscriptionIndex(id)
+	if i < 0 {
+		return ErrSubscriptionNotFound
+	}
+	subID := s.subs[i].ID
+	s.subs = slices.Delete(s.subs, i, i+1)
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(d WebhookDelivery) bool {
+		return d.SubscriptionID == subID
+	})
+	return nil
+}
+
+func (s *MemoryWebhookStore) Enqueue(_ context.Context, event Event, subscriptionIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, subID := range subscriptionIDs {
+		exists := slices.ContainsFunc(s.deliveries, func(d WebhookDelivery) bool {
+			return d.SubscriptionID == subID && d.Event.ID == event.ID
+		})
+		if exists {
+			continue
+		}
+		s.nextID++
+		next := now
+		s.deliveries = append(s.deliveries, WebhookDelivery{
+			ID:             s.nextID,
+			SubscriptionID: subID,
+			Event:          event,
+			State:          DeliveryPending,
+			NextAttemptAt:  &next,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	return nil
+}
+
+func (s *MemoryWebhookStore) ClaimDue(
+	_ context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := []WebhookDelivery{}
+	for i := range s.deliveries {
+		d := &s.deliveries[i]
+		if len(due) == limit {
+			break
+		}
+		if d.State != DeliveryPending || d.NextAttemptAt == nil || d.NextAttemptAt.After(now) {
+			continue
+		}
+		due = append(due, *d)
+		next := now.Add(lease)
+		d.NextAttemptAt = &next
+	}
+	return due, nil
+}
+
+func (s *MemoryWebhookStore) UpdateDelivery(_ context.Context, d WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == d.ID {
+			s.deliveries[i] = d
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *MemoryWebhookStore) Deliveries(
+	_ context.Context,
+	subscriptionID string,
+	limit int,
+) ([]WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscriptionIndex(subscriptionID) < 0 {
+		return nil, ErrSubscriptionNotFound
+	}
+	deliveries := []WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if s.deliveries[i].SubscriptionID.String() == subscriptionID {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryWebhookStore) subscriptionIndex(id string) int {
+	subID, err := uuid.FromString(id)
+	if err != nil {
+		return -1
+	}
+	return slices.IndexFunc(s.subs, func(sub WebhookSubscription) bool {
+		return sub.ID == subID
+	})
+}
+
+// copySubscription returns a copy of the subscription, that does not share filters with the original.
+func copySubscription(sub WebhookSubscription) WebhookSubscription {
+	sub.EventTypes = slices.Clone(sub.EventTypes)
+	sub.Genres = slices.Clone(sub.Genres)
+	return sub
+}
+
+// PgWebhookStore is a PostgreSql implementation of the WebhookStore.
+// Due deliveries are claimed with "for update skip locked", so several instances
+// of the service never send the same delivery at the same time.
+type PgWebhookStore struct {
+	conn databaseConn
+}
+
+// NewPgWebhookStore creates an instance of the PgWebhookStore.
+func NewPgWebhookStore(conn databaseConn) WebhookStore {
+	return PgWebhookStore{
+		conn: conn,
+	}
+}
+
+const webhookSubscriptionColumns = "id, url, secret, event_types, genres, created_at"
+
+const webhookDeliveryColumns = `id, subscription_id, event, state, attempts, last_status, last_error,
+	next_attempt_at, created_at, updated_at`
+
+func (s PgWebhookStore) CreateSubscription(ctx context.Context, sub *WebhookSubscription) error {
+	q := `
+	insert into webhook_subscription(url, secret, event_types, genres)
+	values ($1, $2, $3, $4)
+	returning id, created_at
+	`
+	return s.conn.QueryRow(ctx, q, sub.URL, sub.Secret, eventTypeStrings(sub.EventTypes), nonNil(sub.Genres)).
+		Scan(&sub.ID, &sub.CreatedAt)
+}
+
+func (s PgWebhookStore) Subscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := s.conn.Query(
+		ctx,
+		"select "+webhookSubscriptionColumns+" from webhook_subscription order by created_at",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (s PgWebhookStore) Subscription(ctx context.Context, id string) (*WebhookSubscription, error) {
+	if _, err := uuid.FromString(id); err != nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	row := s.conn.QueryRow(
+		ctx,
+		"select "+webhookSubscriptionColumns+" from webhook_subscription where id = $1",
+		id,
+	)
+	sub, err := scanSubscription(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s PgWebhookStore) DeleteSubscription(ctx context.Context, id string) error {
+	if _, err := uuid.FromString(id); err != nil {
+		return ErrSubscriptionNotFound
+	}
+	var deleted uuid.UUID
+	err := s.conn.QueryRow(ctx, "delete from webhook_subscription where id = $1 returning id", id).
+		Scan(&deleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSubscriptionNotFound
+	}
+	return err
+}
+
+func (s PgWebhookStore) Enqueue(ctx context.Context, event Event, subscriptionIDs []uuid.UUID) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	q := `
+	insert into webhook_delivery(subscription_id, event_id, event)
+	select unnest($1::uuid[]), $2, $3
+	on conflict (subscription_id, event_id) do nothing
+	`
+	rows, err := s.conn.Query(ctx, q, subscriptionIDs, event.ID, data)
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+func (s PgWebhookStore) ClaimDue(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]WebhookDelivery, error) {
+	q := `
+	update webhook_delivery set next_attempt_at = $2
+	where id in (
+		select id from webhook_delivery
+		where state = 'pending' and next_attempt_at <= $1
+		order by id
+		limit $3
+		for update skip locked
+	)
+	returning ` + webhookDeliveryColumns
+	return s.queryDeliveries(ctx, q, now, now.Add(lease), limit)
+}
+
+func (s PgWebhookStore) UpdateDelivery(ctx context.Context, d WebhookDelivery) error {
+	q := `
+	update webhook_delivery
+	set state = $1, attempts = $2, last_status = $3, last_error = $4, next_attempt_at = $5, updated_at = $6
+	where id = $7
+	`
+	rows, err := s.conn.Query(
+		ctx,
+		q,
+		string(d.State),
+		d.Attempts,
+		d.LastStatus,
+		d.LastError,
+		d.NextAttemptAt,
+		d.UpdatedAt,
+		d.ID,
+	)
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+func (s PgWebhookStore) Deliveries(
+	ctx context.Context,
+	subscriptionID string,
+	limit int,
+) ([]WebhookDelivery, error) {
+	if _, err := s.Subscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	q := "select " + webhookDeliveryColumns + `
+	from webhook_delivery
+	where subscription_id = $1
+	order by id desc
+	limit $2
+	`
+	return s.queryDeliveries(ctx, q, subscriptionID, limit)
+}
+
+func (s PgWebhookStore) queryDeliveries(ctx context.Context, q string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := s.conn.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d := WebhookDelivery{}
+		var event []byte
+		var state string
+		err := rows.Scan(
+			&d.ID,
+			&d.SubscriptionID,
+			&event,
+			&state,
+			&d.Attempts,
+			&d.LastStatus,
+			&d.LastError,
+			&d.NextAttemptAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		d.State = DeliveryState(state)
+		if err := json.Unmarshal(event, &d.Event); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanSubscription(row pgx.Row) (WebhookSubscription, error) {
+	sub := WebhookSubscription{}
+	var eventTypes []string
+	err := row.Scan(&sub.ID, &sub.URL, &sub.Secret, &eventTypes, &sub.Genres, &sub.CreatedAt)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	sub.EventTypes = make([]EventType, len(eventTypes))
+	for i, t := range eventTypes {
+		sub.EventTypes[i] = EventType(t)
+	}
+	return sub, nil
+}
+
+func eventTypeStrings(types []EventType) []string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = string(t)
+	}
+	return s
+}
+
+// nonNil returns empty slice instead of nil one, so it is stored as empty array instead of null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
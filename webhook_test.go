@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func TestWebhookSubscriptionMatches(t *testing.T) {
+	movie := testMovie()
+	movie.Genres = []string{"horror", "comedy"}
+	created := Event{Type: MovieCreated, Movie: movie}
+	deleted := Event{Type: MovieDeleted}
+
+	tests := []struct {
+		name     string
+		sub      WebhookSubscription
+		event    Event
+		expected bool
+	}{
+		{"no filters", WebhookSubscription{}, created, true},
+		{"event type", WebhookSubscription{EventTypes: []EventType{MovieCreated}}, created, true},
+		{"other event type", WebhookSubscription{EventTypes: []EventType{MovieUpdated}}, created, false},
+		{"genre", WebhookSubscription{Genres: []string{"horror"}}, created, true},
+		{"other genre", WebhookSubscription{Genres: []string{"drama"}}, created, false},
+		{"genre of deleted movie", WebhookSubscription{Genres: []string{"drama"}}, deleted, true},
+	}
+	for _, tt := range tests {
+		if got := tt.sub.Matches(tt.event); got != tt.expected {
+			t.Errorf("%s: wrong match; expected: %v, got: %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	ctx := context.Background()
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		if !VerifyWebhook("secret", timestamp, body, r.Header.Get("X-Webhook-Signature")) {
+			t.Errorf("wrong signature: %s", r.Header.Get("X-Webhook-Signature"))
+		}
+		if r.Header.Get("X-Webhook-Event") != string(MovieCreated) {
+			t.Errorf("wrong event header: %s", r.Header.Get("X-Webhook-Event"))
+		}
+		event := Event{}
+		json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer srv.Close()
+
+	store := NewMemoryWebhookStore()
+	matching := &WebhookSubscription{URL: srv.URL, Secret: "secret", Genres: []string{"test"}}
+	other := &WebhookSubscription{URL: srv.URL, Secret: "secret", EventTypes: []EventType{MovieDeleted}}
+	store.CreateSubscription(ctx, matching)
+	store.CreateSubscription(ctx, other)
+
+	event := Event{ID: 1, Type: MovieCreated, MovieID: testUUID(t), Movie: testMovie()}
+	dispatcher := NewWebhookDispatcher(store)
+	// Event published twice by the relay is delivered once.
+	for i := 0; i < 2; i++ {
+		if err := dispatcher.Publish(ctx, event); err != nil {
+			t.Fatalf("error dispatching: %v", err)
+		}
+	}
+
+	wd := NewWebhookDeliverer(store, testWebhookOptions(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	n, err := wd.deliverDue(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("one delivery was expected; got: %d, err: %v", n, err)
+	}
+	if got := <-received; got.ID != event.ID || got.MovieID != event.MovieID {
+		t.Errorf("wrong event received; expected: %+v, got: %+v", event, got)
+	}
+
+	deliveries, _ := store.Deliveries(ctx, matching.ID.String(), 10)
+	if len(deliveries) != 1 || deliveries[0].State != DeliveryDelivered || deliveries[0].LastStatus != 200 {
+		t.Errorf("delivery was not logged as delivered: %+v", deliveries)
+	}
+	if deliveries, _ := store.Deliveries(ctx, other.ID.String(), 10); len(deliveries) != 0 {
+		t.Errorf("event was delivered to not matching subscription: %+v", deliveries)
+	}
+}
+
+func TestWebhookDeliveryDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	store := NewMemoryWebhookStore()
+	sub := &WebhookSubscription{URL: srv.URL, Secret: "secret"}
+	store.CreateSubscription(ctx, sub)
+	store.Enqueue(ctx, Event{ID: 1, Type: MovieDeleted, MovieID: testUUID(t)}, []uuid.UUID{sub.ID})
+
+	now := time.Now()
+	wd := NewWebhookDeliverer(store, testWebhookOptions(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	wd.now = func() time.Time { return now }
+
+	wd.deliverDue(ctx)
+	deliveries, _ := store.Deliveries(ctx, sub.ID.String(), 10)
+	d := deliveries[0]
+	if d.State != DeliveryPending || d.Attempts != 1 || d.LastStatus != http.StatusServiceUnavailable {
+		t.Errorf("delivery was expected to be retried: %+v", d)
+	}
+	if d.NextAttemptAt == nil || !d.NextAttemptAt.Equal(now.Add(time.Second)) {
+		t.Errorf("wrong next attempt; expected: %v, got: %v", now.Add(time.Second), d.NextAttemptAt)
+	}
+
+	if n, _ := wd.deliverDue(ctx); n != 0 {
+		t.Errorf("delivery was retried before backoff elapsed")
+	}
+	now = now.Add(time.Second)
+	wd.deliverDue(ctx)
+
+	deliveries, _ = store.Deliveries(ctx, sub.ID.String(), 10)
+	if d := deliveries[0]; d.State != DeliveryDead || d.Attempts != 2 || d.LastError == "" {
+		t.Errorf("delivery was expected to be dead after max attempts: %+v", d)
+	}
+	if calls != 2 {
+		t.Errorf("wrong number of calls; expected: 2, got: %d", calls)
+	}
+}
+
+func TestWebhookDeliveryLease(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryWebhookStore()
+	opts := testWebhookOptions()
+	var now time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every delivery of the batch may take the whole timeout, so the rest of them
+		// must stay claimed until the last one is sent.
+		claimed, err := store.ClaimDue(ctx, now.Add(time.Duration(opts.BatchSize)*opts.Timeout), 0, opts.BatchSize)
+		if err != nil || len(claimed) != 0 {
+			t.Errorf("deliveries were claimed again while being sent: %+v, err: %v", claimed, err)
+		}
+	}))
+	defer srv.Close()
+
+	sub := &WebhookSubscription{URL: srv.URL, Secret: "secret"}
+	store.CreateSubscription(ctx, sub)
+	for i := int64(1); i <= 2; i++ {
+		store.Enqueue(ctx, Event{ID: i, Type: MovieDeleted, MovieID: testUUID(t)}, []uuid.UUID{sub.ID})
+	}
+
+	now = time.Now()
+	wd := NewWebhookDeliverer(store, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	wd.now = func() time.Time { return now }
+	if n, err := wd.deliverDue(ctx); n != 2 || err != nil {
+		t.Errorf("two deliveries were expected; got: %d, err: %v", n, err)
+	}
+}
+
+func TestWebhookDeliveryRefusesPrivateAddress(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+
+	store := NewMemoryWebhookStore()
+	sub := &WebhookSubscription{URL: strings.Replace(srv.URL, "127.0.0.1", "localhost", 1), Secret: "secret"}
+	store.CreateSubscription(ctx, sub)
+	store.Enqueue(ctx, Event{ID: 1, Type: MovieDeleted, MovieID: testUUID(t)}, []uuid.UUID{sub.ID})
+
+	opts := testWebhookOptions()
+	opts.AllowPrivateURLs = false
+	wd := NewWebhookDeliverer(store, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	wd.deliverDue(ctx)
+
+	deliveries, _ := store.Deliveries(ctx, sub.ID.String(), 10)
+	if d := deliveries[0]; d.Attempts != 1 || !strings.Contains(d.LastError, ErrPrivateAddress.Error()) {
+		t.Errorf("delivery to private address was expected to fail: %+v", d)
+	}
+	if calls != 0 {
+		t.Errorf("private address was called %d times", calls)
+	}
+}
+
+func TestRefusePrivateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		refused bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{"127.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"10.0.0.1:80", true},
+		{"172.16.0.1:80", true},
+		{"192.168.1.1:80", true},
+		{"169.254.169.254:80", true},
+		{"100.64.0.1:80", true},
+		{"0.0.0.0:80", true},
+		{"[fd00::1]:80", true},
+		{"[fe80::1]:80", true},
+		{"[::ffff:127.0.0.1]:80", true},
+	}
+	for _, tt := range tests {
+		err := refusePrivateAddress("tcp", tt.address, nil)
+		if refused := errors.Is(err, ErrPrivateAddress); refused != tt.refused {
+			t.Errorf("wrong result for %s; expected refused: %v, got error: %v", tt.address, tt.refused, err)
+		}
+	}
+}
+
+func TestHandleWebhooks(t *testing.T) {
+	s := NewServer(nil).WithWebhooks(NewMemoryWebhookStore())
+	h := s.Handler()
+
+	w := httptest.NewRecorder()
+	body := `{"url": "ftp://example.com"}`
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid url was accepted; status: %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	body = `{"url": "http://example.com/hook", "event_types": ["MovieCreated"], "genres": ["horror"]}`
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))
+	created := WebhookSubscription{}
+	json.NewDecoder(w.Body).Decode(&created)
+	if w.Code != http.StatusCreated || created.Secret == "" {
+		t.Fatalf("subscription with secret was expected; status: %d, got: %+v", w.Code, created)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	subs := []WebhookSubscription{}
+	json.NewDecoder(w.Body).Decode(&subs)
+	if len(subs) != 1 || subs[0].ID != created.ID || subs[0].Secret != "" {
+		t.Errorf("subscription without secret was expected, got: %+v", subs)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks/"+created.ID.String()+"/deliveries", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("empty delivery log was expected; status: %d, body: %s", w.Code, w.Body)
+	}
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/webhooks/"+created.ID.String(), &bytes.Buffer{}))
+		if w.Code != status {
+			t.Errorf("wrong status on delete; expected: %d, got: %d", status, w.Code)
+		}
+	}
+}
+
+func testWebhookOptions() WebhookOptions {
+	return WebhookOptions{
+		BatchSize:        10,
+		PollInterval:     time.Second,
+		Timeout:          time.Second,
+		MaxAttempts:      2,
+		RetryBackoff:     time.Second,
+		MaxRetryBackoff:  time.Minute,
+		AllowPrivateURLs: true,
+	}
+}
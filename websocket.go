@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/websocket"
+)
+
+// Topics, which WebSocket clients can subscribe to.
+const (
+	// topicAll receives all events.
+	topicAll = "movies"
+	// topicMoviePrefix is followed by the movie id, topic receives all events of the movie.
+	topicMoviePrefix = "movie:"
+	// topicGenrePrefix is followed by the genre, topic receives created and updated events
+	// of movies with the genre.
+	topicGenrePrefix = "genre:"
+)
+
+// parseTopic validates topic and returns its canonical form: movie ids are formatted
+// as UUID and genres are lowercased.
+func parseTopic(topic string) (string, error) {
+	switch {
+	case topic == topicAll:
+		return topic, nil
+	case strings.HasPrefix(topic, topicMoviePrefix):
+		id, err := uuid.FromString(strings.TrimPrefix(topic, topicMoviePrefix))
+		if err != nil {
+			return "", fmt.Errorf("invalid movie id in topic: %s", topic)
+		}
+		return topicMoviePrefix + id.String(), nil
+	case strings.HasPrefix(topic, topicGenrePrefix) && len(topic) > len(topicGenrePrefix):
+		return strings.ToLower(topic), nil
+	}
+	return "", fmt.Errorf("unsupported topic: %s", topic)
+}
+
+// eventTopics returns all topics, that receive the event.
+func eventTopics(event Event) []string {
+	topics := []string{topicAll, topicMoviePrefix + event.MovieID.String()}
+	if event.Movie != nil {
+		for _, g := range event.Movie.Genres {
+			topics = append(topics, topicGenrePrefix+strings.ToLower(g))
+		}
+	}
+	return topics
+}
+
+// wsRequest is a message sent by the WebSocket client.
+type wsRequest struct {
+	// Type is either subscribe or unsubscribe.
+	Type   string   `json:"type"`
+	Topics []string `json:"topics"`
+}
+
+// wsMessage is a message sent to the WebSocket client.
+type wsMessage struct {
+	// Type is subscribed, unsubscribed, event or error.
+	Type string `json:"type"`
+	// Topics are the topics of the request, or the subscribed topics matching the event.
+	Topics []string `json:"topics,omitempty"`
+	Event  *Event   `json:"event,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// TopicRouter fans out movie change events to the subscribers of matching topics.
+// Every subscriber receives the event once, even if several of its topics match it.
+// Subscriber, that does not keep up and has full buffer, is dropped.
+type TopicRouter struct {
+	mu     sync.Mutex
+	topics map[string]map[*topicSubscriber]struct{}
+	buffer int
+}
+
+// topicSubscriber receives messages of the single WebSocket connection.
+type topicSubscriber struct {
+	messages chan wsMessage
+	// dropped is closed, when subscriber is dropped for being too slow.
+	dropped chan struct{}
+	// topics are guarded by the router mutex.
+	topics map[string]struct{}
+}
+
+// NewTopicRouter creates an instance of the TopicRouter, every subscriber can have
+// up to buffer not sent messages.
+func NewTopicRouter(buffer int) *TopicRouter {
+	return &TopicRouter{
+		topics: map[string]map[*topicSubscriber]struct{}{},
+		buffer: buffer,
+	}
+}
+
+// Run publishes events received from the broker until ctx is canceled.
+func (r *TopicRouter) Run(ctx context.Context, broker *EventBroker, logger *slog.Logger) {
+	for {
+		sub := broker.Subscribe()
+		dropped := r.consume(ctx, sub)
+		broker.Unsubscribe(sub)
+		if !dropped {
+			return
+		}
+		logger.Warn("topic router does not keep up with events, some of them were not sent")
+	}
+}
+
+// consume publishes events of the subscription and reports, whether it was dropped.
+func (r *TopicRouter) consume(ctx context.Context, sub *EventSubscription) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-sub.Dropped:
+			return true
+		case ev := <-sub.Events:
+			r.Publish(ev)
+		}
+	}
+}
+
+// Publish sends event to subscribers of all matching topics.
+func (r *TopicRouter) Publish(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order := []*topicSubscriber{}
+	matched := map[*topicSubscriber][]string{}
+	for _, topic := range eventTopics(event) {
+		for sub := range r.topics[topic] {
+			if _, ok := matched[sub]; !ok {
+				order = append(order, sub)
+			}
+			matched[sub] = append(matched[sub], topic)
+		}
+	}
+	for _, sub := range order {
+		r.send(sub, wsMessage{Type: "event", Topics: matched[sub], Event: &event})
+	}
+}
+
+func (r *TopicRouter) subscriber() *topicSubscriber {
+	return &topicSubscriber{
+		messages: make(chan wsMessage, r.buffer),
+		dropped:  make(chan struct{}),
+		topics:   map[string]struct{}{},
+	}
+}
+
+// subscribe adds topics to the subscriber, unless it would exceed limit of topics.
+func (r *TopicRouter) subscribe(sub *topicSubscriber, topics []string, limit int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := 0
+	for _, t := range topics {
+		if _, ok := sub.topics[t]; !ok {
+			added++
+		}
+	}
+	if len(sub.topics)+added > limit {
+		return fmt.Errorf("subscription is limited to %d topics", limit)
+	}
+	for _, t := range topics {
+		if r.topics[t] == nil {
+			r.topics[t] = map[*topicSubscriber]struct{}{}
+		}
+		r.topics[t][sub] = struct{}{}
+		sub.topics[t] = struct{}{}
+	}
+	return nil
+}
+
+// unsubscribe removes topics from the subscriber, all of them if topics are nil.
+func (r *TopicRouter) unsubscribe(sub *topicSubscriber, topics []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remove(sub, topics)
+}
+
+func (r *TopicRouter) remove(sub *topicSubscriber, topics []string) {
+	if topics == nil {
+		for t := range sub.topics {
+			topics = append(topics, t)
+		}
+	}
+	for _, t := range topics {
+		delete(r.topics[t], sub)
+		if len(r.topics[t]) == 0 {
+			delete(r.topics, t)
+		}
+		delete(sub.topics, t)
+	}
+}
+
+// reply sends the message to the single subscriber.
+func (r *TopicRouter) reply(sub *topicSubscriber, msg wsMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.send(sub, msg)
+}
+
+// send must be called with the mutex locked.
+func (r *TopicRouter) send(sub *topicSubscriber, msg wsMessage) {
+	select {
+	case <-sub.dropped:
+		return
+	default:
+	}
+	select {
+	case sub.messages <- msg:
+	default:
+		close(sub.dropped)
+		r.remove(sub, nil)
+	}
+}
+
+// Subscribers returns the number of subscribers of the topic.
+func (r *TopicRouter) Subscribers(topic string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.topics[topic])
+}
+
+// WebSocketOptions describes the behavior of the WebSocket endpoint.
+type WebSocketOptions struct {
+	// PingInterval is the interval between pings sent to the client.
+	PingInterval time.Duration
+	// PongWait is the time, during which any message or pong must be received from the client.
+	PongWait time.Duration
+	// WriteTimeout limits a single write, client is disconnected, if it is exceeded.
+	WriteTimeout time.Duration
+	// MaxTopics is the maximum number of topics of the single connection.
+	MaxTopics int
+}
+
+// maxWebSocketMessage is the maximum size of the message received from the client.
+const maxWebSocketMessage = 64 << 10
+
+// movieWebSocket contains dependencies of the WebSocket endpoint.
+type movieWebSocket struct {
+	router   *TopicRouter
+	opts     WebSocketOptions
+	upgrader websocket.Upgrader
+}
+
+// handleMovieWebSocket upgrades connection to WebSocket, which receives movie change events
+// of the subscribed topics. Client sends subscribe and unsubscribe messages, e.g.
+// {"type": "subscribe", "topics": ["movie:<id>", "genre:horror"]}, each of them is confirmed
+// with subscribed or unsubscribed message, or rejected with error message.
+// Client, that does not respond to pings or does not keep up with the events, is disconnected.
+func (s Server) handleMovieWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Upgrader writes error response itself.
+	conn, err := s.ws.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := s.ws.router.subscriber()
+	defer s.ws.router.unsubscribe(sub, nil)
+
+	conn.SetReadLimit(maxWebSocketMessage)
+	conn.SetReadDeadline(time.Now().Add(s.ws.opts.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.ws.opts.PongWait))
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.readWebSocket(conn, sub)
+	}()
+
+	ping := time.NewTicker(s.ws.opts.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-sub.dropped:
+			msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer")
+			conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(s.ws.opts.WriteTimeout))
+			return
+		case msg := <-sub.messages:
+			conn.SetWriteDeadline(time.Now().Add(s.ws.opts.WriteTimeout))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.ws.opts.WriteTimeout))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readWebSocket handles client messages, until connection is closed.
+func (s Server) readWebSocket(conn *websocket.Conn, sub *topicSubscriber) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(s.ws.opts.PongWait))
+
+		req := wsRequest{}
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.ws.router.reply(sub, wsMessage{Type: "error", Error: err.Error()})
+			continue
+		}
+		s.ws.router.reply(sub, s.handleWebSocketRequest(sub, req))
+	}
+}
+
+// handleWebSocketRequest applies the client request and returns the reply.
+func (s Server) handleWebSocketRequest(sub *topicSubscriber, req wsRequest) wsMessage {
+	if req.Type != "subscribe" && req.Type != "unsubscribe" {
+		return wsMessage{Type: "error", Error: fmt.Sprintf("unsupported message type: %s", req.Type)}
+	}
+	if len(req.Topics) == 0 {
+		return wsMessage{Type: "error", Error: "topics must not be empty"}
+	}
+	topics := make([]string, len(req.Topics))
+	for i, t := range req.Topics {
+		topic, err := parseTopic(t)
+		if err != nil {
+			return wsMessage{Type: "error", Topics: req.Topics, Error: err.Error()}
+		}
+		topics[i] = topic
+	}
+
+	if req.Type == "unsubscribe" {
+		s.ws.router.unsubscribe(sub, topics)
+		return wsMessage{Type: "unsubscribed", Topics: topics}
+	}
+	if err := s.ws.router.subscribe(sub, topics, s.ws.opts.MaxTopics); err != nil {
+		return wsMessage{Type: "error", Topics: req.Topics, Error: err.Error()}
+	}
+	return wsMessage{Type: "subscribed", Topics: topics}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseTopic(t *testing.T) {
+	tests := []struct {
+		topic    string
+		expected string
+		err      bool
+	}{
+		{"movies", "movies", false},
+		{"movie:6BA7B810-9DAD-11D1-80B4-00C04FD430C8", "movie:6ba7b810-9dad-11d1-80b4-00c04fd430c8", false},
+		{"genre:Horror", "genre:horror", false},
+		{"movie:1", "", true},
+		{"genre:", "", true},
+		{"actor:someone", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseTopic(tt.topic)
+		if got != tt.expected || (err != nil) != tt.err {
+			t.Errorf("%s: wrong topic; expected: %q (error: %v), got: %q (error: %v)", tt.topic, tt.expected, tt.err, got, err)
+		}
+	}
+}
+
+func TestTopicRouterDropsSlowSubscriber(t *testing.T) {
+	r := NewTopicRouter(1)
+	sub := r.subscriber()
+	r.subscribe(sub, []string{topicAll}, 10)
+
+	r.Publish(Event{ID: 1})
+	r.Publish(Event{ID: 2})
+	select {
+	case <-sub.dropped:
+	default:
+		t.Fatalf("slow subscriber was not dropped")
+	}
+	if n := r.Subscribers(topicAll); n != 0 {
+		t.Errorf("wrong number of subscribers; expected: 0, got: %d", n)
+	}
+}
+
+func TestHandleMovieWebSocket(t *testing.T) {
+	router := NewTopicRouter(10)
+	opts := WebSocketOptions{PingInterval: time.Second, PongWait: 2 * time.Second, WriteTimeout: time.Second, MaxTopics: 2}
+	// Access log wraps the response writer, which must still allow to hijack the connection.
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(nil, DefaultMiddlewares(logger, FeaturesConfig{AccessLog: true})...)
+	srv := httptest.NewServer(s.WithWebSocket(router, opts).Handler())
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/movies/ws", nil)
+	if err != nil {
+		t.Fatalf("error connecting: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	movie := testMovie()
+	movie.Genres = []string{"Horror"}
+	id := testUUID(t)
+	movieTopic := "movie:" + id.String()
+
+	requests := []struct {
+		request  wsRequest
+		expected string
+	}{
+		{wsRequest{Type: "subscribe", Topics: []string{"actor:someone"}}, "error"},
+		{wsRequest{Type: "subscribe", Topics: []string{movieTopic, "genre:horror"}}, "subscribed"},
+		{wsRequest{Type: "subscribe", Topics: []string{"movies"}}, "error"},
+		{wsRequest{Type: "watch", Topics: []string{"movies"}}, "error"},
+	}
+	for _, r := range requests {
+		conn.WriteJSON(r.request)
+		reply := wsMessage{}
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("error reading reply: %v", err)
+		}
+		if reply.Type != r.expected {
+			t.Errorf("wrong reply to %+v; expected: %s, got: %+v", r.request, r.expected, reply)
+		}
+	}
+
+	// Event matching both topics is received once, not matching one is not received.
+	router.Publish(Event{ID: 1, Type: MovieCreated, MovieID: id, Movie: movie})
+	router.Publish(Event{ID: 2, Type: MovieDeleted, MovieID: testUUID(t)})
+	router.Publish(Event{ID: 3, Type: MovieDeleted, MovieID: id})
+	for _, expected := range []struct {
+		id     int64
+		topics int
+	}{{1, 2}, {3, 1}} {
+		msg := wsMessage{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("error reading event: %v", err)
+		}
+		if msg.Type != "event" || msg.Event == nil || msg.Event.ID != expected.id || len(msg.Topics) != expected.topics {
+			t.Errorf("wrong event; expected id: %d with %d topics, got: %+v", expected.id, expected.topics, msg)
+		}
+	}
+
+	conn.WriteJSON(wsRequest{Type: "unsubscribe", Topics: []string{movieTopic, "genre:horror"}})
+	reply := wsMessage{}
+	conn.ReadJSON(&reply)
+	if reply.Type != "unsubscribed" || router.Subscribers(movieTopic) != 0 {
+		t.Errorf("topics were not unsubscribed; got: %+v", reply)
+	}
+}